@@ -1,50 +1,180 @@
 package main
 
 import (
+	"context"
 	"encoding/gob"
 	"flag"
 	"fmt"
 	"github.com/psanodiya94/gobooking.com/internal/config"
 	"github.com/psanodiya94/gobooking.com/internal/driver"
 	"github.com/psanodiya94/gobooking.com/internal/handlers"
+	"github.com/psanodiya94/gobooking.com/internal/health"
 	"github.com/psanodiya94/gobooking.com/internal/helpers"
+	"github.com/psanodiya94/gobooking.com/internal/logging"
+	"github.com/psanodiya94/gobooking.com/internal/mailer"
+	"github.com/psanodiya94/gobooking.com/internal/metrics"
 	"github.com/psanodiya94/gobooking.com/internal/models"
+	"github.com/psanodiya94/gobooking.com/internal/ratelimit"
 	"github.com/psanodiya94/gobooking.com/internal/render"
-	"log"
+	"github.com/psanodiya94/gobooking.com/internal/scheduler"
+	"github.com/psanodiya94/gobooking.com/internal/sessionstore"
+	"github.com/psanodiya94/gobooking.com/internal/sms"
+	"github.com/psanodiya94/gobooking.com/migrations"
+	"github.com/psanodiya94/gobooking.com/static"
+	"github.com/psanodiya94/gobooking.com/templates"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
 )
 
-const port = ":8080"
-
 var app config.AppConfig
 var session *scs.SessionManager
-var infoLog *log.Logger
-var errorLog *log.Logger
+var logger *slog.Logger
+var jobs *scheduler.Scheduler
+var smsSender sms.Sender
+var settings config.Settings
+var probes *health.Checker
+var sessionStore *sessionstore.PostgresStore
+var proxies ratelimit.Proxies
+var limits rateLimits
+
+// rateLimits holds the limiters for the routes that hit the database or the
+// logs, nil when rate limiting is off
+type rateLimits struct {
+	search      *ratelimit.Limiter
+	reservation *ratelimit.Limiter
+	login       *ratelimit.Limiter
+	cspReport   *ratelimit.Limiter
+}
+
+// size of the mail and sms queues
+const queueSize = 100
 
 func main() {
 	db, err := run()
 	if err != nil {
-		log.Fatal(err)
+		logger.Error("can't start application", "error", err)
+		os.Exit(1)
 	}
-	defer db.SQL.Close()
-	defer close(app.MailChan)
 
-	log.Println("Starting mail listener")
+	logger.Info("starting mail listener")
 
-	listenForMail()
+	mailDone := listenForMail()
 
-	log.Println("Starting application on port", port)
+	logger.Info("starting sms listener")
+
+	smsDone := listenForSMS()
+
+	if jobs != nil {
+		logger.Info("starting scheduler")
+		jobs.Start()
+	}
+
+	logger.Info("starting application", "addr", settings.Addr())
 
 	server := &http.Server{
-		Addr:    port,
-		Handler: routes(&app),
+		Addr:         settings.Addr(),
+		Handler:      routes(&app),
+		ReadTimeout:  settings.Server.ReadTimeout,
+		WriteTimeout: settings.Server.WriteTimeout,
+		IdleTimeout:  settings.Server.IdleTimeout,
+		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelError),
+	}
+
+	err = serve(server)
+	if err != nil {
+		logger.Error("http server failed", "error", err)
+	}
+
+	shutdown(server, db, mailDone, smsDone)
+}
+
+// serve runs the server until it fails or the process is asked to stop
+func serve(server *http.Server) error {
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	select {
+	case err := <-serverErr:
+		return err
+	case sig := <-quit:
+		logger.Info("shutting down", "signal", sig.String())
+		return nil
+	}
+}
+
+// shutdown stops the application in order: in-flight requests are finished,
+// background jobs stopped, queued messages sent, and the database closed last
+func shutdown(server *http.Server, db *driver.DataBase, mailDone, smsDone <-chan struct{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), settings.Server.ShutdownTimeout)
+	defer cancel()
+
+	logger.Info("waiting for in-flight requests")
+	err := server.Shutdown(ctx)
+	handlersDone := err == nil
+	if err != nil {
+		logger.Error("http server shutdown", "error", err)
+		_ = server.Close()
+	}
+
+	if jobs != nil {
+		logger.Info("stopping scheduler")
+		jobs.Stop()
+	}
+
+	if sessionStore != nil {
+		sessionStore.StopCleanup()
+	}
+
+	// Close doesn't wait for handlers, and one still running could queue a
+	// message, so the queues are only closed once every request has finished
+	if handlersDone {
+		drainQueues(mailDone, smsDone)
+	} else {
+		logger.Error("requests still running, not waiting for queued messages")
+	}
+
+	logger.Info("closing database connections")
+	err = db.SQL.Close()
+	if err != nil {
+		logger.Error("can't close database", "error", err)
 	}
 
-	log.Fatal(server.ListenAndServe())
+	logger.Info("shutdown complete")
+}
+
+// drainQueues closes the mail and sms queues, which nothing sends on any more,
+// and waits for the listeners to send what is left
+func drainQueues(mailDone, smsDone <-chan struct{}) {
+	logger.Info("draining mail and sms queues")
+	close(app.MailChan)
+	close(app.SMSChan)
+
+	drain := time.NewTimer(settings.Server.ShutdownTimeout)
+	defer drain.Stop()
+
+	for _, done := range []<-chan struct{}{mailDone, smsDone} {
+		select {
+		case <-done:
+		case <-drain.C:
+			logger.Error("gave up draining queued messages")
+			return
+		}
+	}
 }
 
 func run() (*driver.DataBase, error) {
@@ -54,41 +184,83 @@ func run() (*driver.DataBase, error) {
 	gob.Register(models.Reservation{})
 	gob.Register(models.Restriction{})
 	gob.Register(map[string]int{})
+	gob.Register(time.Time{})
 
-	// read flags
-	inProduction := flag.Bool("production", true, "application is in production")
-	useCache := flag.Bool("cache", true, "use template cache")
-	dbHost := flag.String("dbhost", "localhost", "database name")
-	dbName := flag.String("dbname", "", "database name")
-	dbUser := flag.String("dbuser", "", "database user")
-	dbPass := flag.String("dbpass", "", "database password")
-	dbPort := flag.String("dbport", "5432", "database port")
-	dbSSL := flag.String("dbssl", "disable", "database ssl settings (disable, prefer, require)")
+	// log as text until the settings say otherwise
+	logger = logging.New(os.Stdout, "text", slog.LevelInfo)
 
-	flag.Parse()
+	// read settings from defaults, config file, environment and flags
+	var opts config.Options
+	var err error
+	settings, opts, err = config.LoadSettings(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		return nil, err
+	}
 
-	if *dbName == "" || *dbUser == "" {
-		fmt.Println("Missing Required Flags")
-		os.Exit(1)
+	if opts.PrintConfig {
+		fmt.Print(settings.Print())
+		if err = settings.Validate(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	err = settings.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
 	}
 
 	// setup mail channel
-	mailChan := make(chan models.MailData)
+	mailChan := make(chan models.MailData, queueSize)
 	app.MailChan = mailChan
 
-	// initialize loggers
-	infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	errorLog = log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+	// setup sms channel
+	smsChan := make(chan models.SMSData, queueSize)
+	app.SMSChan = smsChan
+	app.SMSCountryCode = settings.SMS.CountryCode
+
+	// initialize logger
+	level, err := logging.ParseLevel(settings.Log.Level)
+	if err != nil {
+		return nil, err
+	}
+	logger = logging.New(os.Stdout, settings.Log.Format, level)
+	slog.SetDefault(logger)
 
-	app.InfoLog = infoLog
-	app.ErrorLog = errorLog
+	app.Logger = logger
 
 	// change this to true when in production
-	app.InProduction = *inProduction
-	app.UseCache = *useCache
+	app.InProduction = settings.InProduction
+	app.UseCache = settings.UseCache
+	app.ReminderDays = settings.Scheduler.ReminderDays
+	app.ArrivalInstructions = settings.Scheduler.ArrivalInstructions
+	app.MailFrom = settings.Mail.From
+	app.OwnerEmail = settings.Mail.OwnerEmail
+	app.DigestAt = settings.Scheduler.DigestAt
+
+	location, err := time.LoadLocation(settings.Scheduler.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	app.Location = location
+
+	proxies, err = ratelimit.ParseProxies(settings.RateLimit.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	if settings.RateLimit.Enabled {
+		limits = rateLimits{
+			search:      ratelimit.New("search", settings.RateLimit.SearchRate, settings.RateLimit.SearchBurst),
+			reservation: ratelimit.New("reservation", settings.RateLimit.ReservationRate, settings.RateLimit.ReservationBurst),
+			login:       ratelimit.New("login", settings.RateLimit.LoginRate, settings.RateLimit.LoginBurst),
+			cspReport:   ratelimit.New("csp_report", settings.RateLimit.CSPReportRate, settings.RateLimit.CSPReportBurst),
+		}
+	}
 
 	session = scs.New()
-	session.Lifetime = 24 * time.Hour
+	session.Lifetime = settings.Session.Lifetime
 	session.Cookie.Persist = true
 	session.Cookie.SameSite = http.SameSiteLaxMode
 	session.Cookie.Secure = app.InProduction
@@ -96,31 +268,84 @@ func run() (*driver.DataBase, error) {
 	app.Session = session
 
 	// connect to database
-	log.Println("Connecting to database...")
-	conn := fmt.Sprintf(
-		"host=%s port=%s dbname=%s user=%s password=%s sslmode=%s",
-		*dbHost, *dbPort, *dbName, *dbUser, *dbPass, *dbSSL,
-	)
-	db, err := driver.ConnectSql(conn)
+	logger.Info("connecting to database", "host", settings.Database.Host, "name", settings.Database.Name)
+	db, err := driver.ConnectSql(settings.DSN())
 	if err != nil {
-		log.Fatal("Can't connect to database! Dying...")
-		return nil, err
+		return nil, fmt.Errorf("can't connect to database: %w", err)
 	}
-	log.Println("Connected to database!")
+	logger.Info("connected to database")
 
-	tmplCache, err := render.CreateTemplateCache()
+	// sessions in postgres survive restarts and are shared between instances
+	if settings.Session.Store == "postgres" {
+		sessionStore = sessionstore.NewPostgres(db.SQL, logger, settings.Session.CleanupInterval)
+		session.Store = sessionStore
+	}
+
+	metrics.RegisterDB(db.SQL)
+	metrics.RegisterQueue("mail", func() int { return len(app.MailChan) })
+	metrics.RegisterQueue("sms", func() int { return len(app.SMSChan) })
+
+	// templates and static files are served from the binary, or in
+	// development read from disk so changes show up without a restart
+	app.Templates = templates.FS
+	app.Static = static.FS
+	if !app.UseCache {
+		app.Templates = os.DirFS(filepath.Join(settings.AssetsDir, "templates"))
+		app.Static = os.DirFS(filepath.Join(settings.AssetsDir, "static"))
+	}
+
+	tmplCache, err := render.CreateTemplateCache(app.Templates)
 	if err != nil {
-		log.Fatal("Cannot create template cache")
-		return nil, err
+		return nil, fmt.Errorf("can't create template cache: %w", err)
 	}
 
 	app.TemplateCache = tmplCache
 
+	smsCache, err := sms.CreateTemplateCache(app.Templates)
+	if err != nil {
+		return nil, fmt.Errorf("can't create sms template cache: %w", err)
+	}
+
+	app.SMSTemplateCache = smsCache
+
+	if settings.SMS.Provider == "http" {
+		smsSender = sms.NewHTTPSender(settings.SMS.URL, settings.SMS.Token, settings.SMS.From)
+	} else {
+		smsSender = &sms.LogSender{Log: logger}
+	}
+
+	emailCache, err := mailer.CreateTemplateCache(app.Templates)
+	if err != nil {
+		return nil, fmt.Errorf("can't create email template cache: %w", err)
+	}
+
+	app.EmailTemplateCache = emailCache
+
+	probes = health.New(logger, 2*time.Second)
+	probes.Add("database", health.Database(db.SQL))
+	probes.Add("templates", health.Loaded("template caches", func() bool {
+		return len(app.TemplateCache) > 0 && len(app.EmailTemplateCache) > 0 && len(app.SMSTemplateCache) > 0
+	}))
+	probes.Add("mail", health.Dial(net.JoinHostPort(settings.Mail.Host, strconv.Itoa(settings.Mail.Port))))
+	if settings.Database.CheckMigrations {
+		probes.Add("migrations", health.Migrations(db.SQL, migrations.FS))
+	}
+
 	repo := handlers.NewRepo(&app, db)
 
 	handlers.NewHandlers(repo)
 	helpers.NewHelpers(&app)
 	render.NewRenderer(&app)
+	mailer.NewMailer(&app)
+	sms.NewSMS(&app)
+
+	if settings.Scheduler.Enabled {
+		jobs = scheduler.New(logger)
+		err = scheduler.NewJobs(&app, db).Register(jobs, settings.Scheduler.Interval)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return db, nil
 }
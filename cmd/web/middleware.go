@@ -1,16 +1,258 @@
 package main
 
 import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/psanodiya94/gobooking.com/internal/csp"
 	"github.com/psanodiya94/gobooking.com/internal/helpers"
+	"github.com/psanodiya94/gobooking.com/internal/logging"
+	"github.com/psanodiya94/gobooking.com/internal/metrics"
+	"github.com/psanodiya94/gobooking.com/internal/ratelimit"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/justinas/nosurf"
 )
 
+// header carrying the request id, both from a proxy and back to the client
+const requestIDHeader = "X-Request-Id"
+
+// RequestID gives every request an id, reusing the one set by a proxy in
+// front of the app, and returns it in the response header. The id is added
+// to every log line written with the request context.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// AccessLog logs every request with its status, size and latency
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+		}
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			attrs = append(attrs, slog.String("route", rctx.RoutePattern()))
+		}
+		attrs = append(attrs,
+			slog.Int("status", status),
+			slog.Int("bytes", ww.BytesWritten()),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote_addr", r.RemoteAddr),
+			slog.String("user_agent", r.UserAgent()),
+		)
+
+		app.Logger.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+// Metrics counts requests and observes their latency by chi route pattern
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		// label by pattern, not path, so ids in urls don't create new series
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		metrics.HTTPRequests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		metrics.HTTPDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// MetricsAuth asks for the basic auth credentials in the metrics settings,
+// letting anyone through when no password is set
+func MetricsAuth(next http.Handler) http.Handler {
+	if settings.Metrics.Password == "" {
+		return next
+	}
+
+	username := []byte(settings.Metrics.Username)
+	password := []byte(settings.Metrics.Password)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(u), username) != 1 || subtle.ConstantTimeCompare([]byte(p), password) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="metrics", charset="UTF-8"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Recover turns a panic in a handler into a logged server error and the error page
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+
+			// the server uses this panic to abort a response on purpose
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			err, ok := rec.(error)
+			if !ok {
+				err = fmt.Errorf("%v", rec)
+			}
+
+			helpers.ServerError(w, r, fmt.Errorf("panic: %w", err))
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SecureHeaders sets the security headers on every response, including a
+// Content-Security-Policy with a fresh nonce that templates put on their
+// inline scripts
+func SecureHeaders(next http.Handler) http.Handler {
+	sources := strings.Fields(settings.Security.CSPSources)
+
+	cspHeader := "Content-Security-Policy"
+	if settings.Security.CSPReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+
+	hsts := ""
+	if settings.Security.HSTSMaxAge > 0 {
+		hsts = fmt.Sprintf("max-age=%d; includeSubDomains", int(settings.Security.HSTSMaxAge.Seconds()))
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce := csp.NewNonce()
+
+		h := w.Header()
+		h.Set(cspHeader, csp.Policy(nonce, sources))
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+		h.Set("Permissions-Policy", "camera=(), microphone=(), geolocation=(), payment=()")
+		h.Set("Cross-Origin-Opener-Policy", "same-origin")
+		if hsts != "" {
+			h.Set("Strict-Transport-Security", hsts)
+		}
+
+		next.ServeHTTP(w, r.WithContext(csp.WithNonce(r.Context(), nonce)))
+	})
+}
+
+// RateLimit limits how often a client can call the routes it wraps, showing
+// the too many requests page once the limit is hit
+func RateLimit(l *ratelimit.Limiter) func(http.Handler) http.Handler {
+	return rateLimit(l, false)
+}
+
+// RateLimitJSON limits how often a client can call the api routes it wraps,
+// answering with a json error once the limit is hit
+func RateLimitJSON(l *ratelimit.Limiter) func(http.Handler) http.Handler {
+	return rateLimit(l, true)
+}
+
+func rateLimit(l *ratelimit.Limiter, api bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		// rate limiting is turned off
+		if l == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := proxies.ClientIP(r)
+
+			ok, wait := l.Allow(ip)
+			if ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			metrics.RateLimited.WithLabelValues(l.Name).Inc()
+
+			retry := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retry))
+
+			if !api {
+				helpers.ClientError(w, r, http.StatusTooManyRequests)
+				return
+			}
+
+			app.Logger.WarnContext(r.Context(), "rate limited", "limiter", l.Name, "client_ip", ip, "path", r.URL.Path)
+
+			out, _ := json.Marshal(map[string]interface{}{
+				"ok":          false,
+				"message":     "Too many requests, please try again later",
+				"retry_after": retry,
+			})
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write(out)
+		})
+	}
+}
+
+// NotFound renders the not found page
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	helpers.ClientError(w, r, http.StatusNotFound)
+}
+
+// MethodNotAllowed renders the method not allowed page
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	helpers.ClientError(w, r, http.StatusMethodNotAllowed)
+}
+
 // NoSurf adds CSRF protection to all POST requests
 func NoSurf(next http.Handler) http.Handler {
 	csrfHandler := nosurf.New(next)
 
+	csrfHandler.SetFailureHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		helpers.ClientError(w, r, http.StatusForbidden)
+	}))
+
 	csrfHandler.SetBaseCookie(http.Cookie{
 		HttpOnly: true,
 		Path:     "/",
@@ -1,8 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/psanodiya94/gobooking.com/internal/config"
+	"github.com/psanodiya94/gobooking.com/internal/csp"
+	"github.com/psanodiya94/gobooking.com/internal/logging"
+	"github.com/psanodiya94/gobooking.com/internal/metrics"
+	"github.com/psanodiya94/gobooking.com/internal/ratelimit"
+	"log/slog"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNoSurf(t *testing.T) {
@@ -26,3 +38,272 @@ func TestSessionLoad(t *testing.T) {
 		t.Errorf("NoSurf did not return an http.Handler, is %T", v)
 	}
 }
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = logging.RequestID(r.Context())
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	id := rr.Header().Get(requestIDHeader)
+	if id == "" || id != seen {
+		t.Errorf("expected the response header %q to match the context id %q", id, seen)
+	}
+
+	// a valid id from a proxy is kept
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(requestIDHeader, "proxy-id-1")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Header().Get(requestIDHeader) != "proxy-id-1" || seen != "proxy-id-1" {
+		t.Errorf("proxy request id not reused, got %q", rr.Header().Get(requestIDHeader))
+	}
+
+	// anything else is replaced
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(requestIDHeader, "bad id\n")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Header().Get(requestIDHeader) == "bad id\n" {
+		t.Error("invalid request id was reused")
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	buf := new(bytes.Buffer)
+	app.Logger = logging.New(buf, "text", slog.LevelInfo)
+
+	h := RequestID(AccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = w.Write([]byte("hello"))
+	})))
+
+	req := httptest.NewRequest("GET", "/about", nil)
+	req.Header.Set(requestIDHeader, "req-1")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	for _, want := range []string{"msg=request", "method=GET", "path=/about", "status=418", "bytes=5", "duration=", "request_id=req-1"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected %q in access log: %s", want, buf.String())
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	mux := chi.NewRouter()
+	mux.Use(Metrics)
+	mux.Get("/rooms/{id}", func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, path := range []string{"/rooms/1", "/rooms/2", "/missing"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	if n := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("GET", "/rooms/{id}", "200")); n != 2 {
+		t.Errorf("expected 2 requests counted for the route pattern, got %v", n)
+	}
+
+	if n := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("GET", "unmatched", "404")); n != 1 {
+		t.Errorf("expected 1 unmatched request, got %v", n)
+	}
+}
+
+func TestMetricsAuth(t *testing.T) {
+	defer func(saved config.MetricsSettings) { settings.Metrics = saved }(settings.Metrics)
+	settings.Metrics = config.MetricsSettings{Enabled: true, Username: "prometheus", Password: "secret"}
+
+	h := MetricsAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		expected int
+	}{
+		{"no credentials", "", "", http.StatusUnauthorized},
+		{"wrong password", "prometheus", "guess", http.StatusUnauthorized},
+		{"wrong username", "admin", "secret", http.StatusUnauthorized},
+		{"right credentials", "prometheus", "secret", http.StatusOK},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if e.username != "" {
+			req.SetBasicAuth(e.username, e.password)
+		}
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != e.expected {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.expected, rr.Code)
+		}
+	}
+
+	settings.Metrics.Enabled = false
+	rr := httptest.NewRecorder()
+	routes(&config.AppConfig{}).ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected no metrics when they are turned off, got status %d", rr.Code)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	h := Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("something broke")
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", rr.Code)
+	}
+
+	if !strings.Contains(rr.Body.String(), "Something went wrong") {
+		t.Error("expected the error page after a panic")
+	}
+}
+
+func TestNoSurf_Failure(t *testing.T) {
+	h := NoSurf(&testHandler{})
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("POST", "/make-reservation", nil))
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected a post without a csrf token to be forbidden, got %d", rr.Code)
+	}
+
+	if !strings.Contains(rr.Body.String(), "Forbidden") {
+		t.Error("expected the forbidden error page")
+	}
+}
+
+func TestSecureHeaders(t *testing.T) {
+	settings.Security.HSTSMaxAge = time.Hour
+	defer func() { settings.Security = config.SecuritySettings{} }()
+
+	var nonce string
+	h := SecureHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = csp.Nonce(r.Context())
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	if nonce == "" {
+		t.Fatal("expected a nonce in the request context")
+	}
+
+	policy := rr.Header().Get("Content-Security-Policy")
+	if !strings.Contains(policy, "'nonce-"+nonce+"'") {
+		t.Errorf("expected the context nonce in the policy, got %s", policy)
+	}
+
+	for header, value := range map[string]string{
+		"X-Frame-Options":           "DENY",
+		"X-Content-Type-Options":    "nosniff",
+		"Strict-Transport-Security": "max-age=3600; includeSubDomains",
+	} {
+		if rr.Header().Get(header) != value {
+			t.Errorf("expected %s: %s, got %q", header, value, rr.Header().Get(header))
+		}
+	}
+
+	// every response gets its own nonce
+	first := nonce
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if nonce == first || strings.Contains(rr.Header().Get("Content-Security-Policy"), "'nonce-"+first+"'") {
+		t.Error("nonce was reused")
+	}
+}
+
+func TestSecureHeaders_ReportOnly(t *testing.T) {
+	settings.Security.CSPReportOnly = true
+	defer func() { settings.Security = config.SecuritySettings{} }()
+
+	h := SecureHeaders(&testHandler{})
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	if rr.Header().Get("Content-Security-Policy") != "" {
+		t.Error("expected the policy not to be enforced")
+	}
+
+	if rr.Header().Get("Content-Security-Policy-Report-Only") == "" {
+		t.Error("expected a report only policy")
+	}
+
+	if rr.Header().Get("Strict-Transport-Security") != "" {
+		t.Error("expected no hsts header when max age is 0")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	proxies, _ = ratelimit.ParseProxies("10.0.0.1")
+	defer func() { proxies = nil }()
+
+	for _, api := range []bool{false, true} {
+		l := ratelimit.New("test", 1, 1)
+
+		h := RateLimit(l)(&testHandler{})
+		if api {
+			h = RateLimitJSON(l)(&testHandler{})
+		}
+
+		before := testutil.ToFloat64(metrics.RateLimited.WithLabelValues("test"))
+
+		send := func(remoteAddr, forwarded string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("POST", "/search-availability", nil)
+			req.RemoteAddr = remoteAddr
+			if forwarded != "" {
+				req.Header.Set("X-Forwarded-For", forwarded)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			return rr
+		}
+
+		if rr := send("10.0.0.1:1000", "203.0.113.1"); rr.Code != http.StatusOK {
+			t.Fatalf("first request was limited, got %d", rr.Code)
+		}
+
+		rr := send("10.0.0.1:1000", "203.0.113.1")
+		if rr.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected status 429, got %d", rr.Code)
+		}
+
+		if rr.Header().Get("Retry-After") != "60" {
+			t.Errorf("expected Retry-After 60, got %q", rr.Header().Get("Retry-After"))
+		}
+
+		isJSON := rr.Header().Get("Content-Type") == "application/json"
+		if isJSON != api {
+			t.Errorf("api %t: got content type %q", api, rr.Header().Get("Content-Type"))
+		}
+
+		if testutil.ToFloat64(metrics.RateLimited.WithLabelValues("test")) != before+1 {
+			t.Error("expected the limited request to be counted")
+		}
+
+		// another client behind the same proxy has its own bucket
+		if rr := send("10.0.0.1:1000", "203.0.113.2"); rr.Code != http.StatusOK {
+			t.Errorf("other client was limited, got %d", rr.Code)
+		}
+	}
+}
+
+func TestRateLimit_Disabled(t *testing.T) {
+	var handler testHandler
+	if RateLimit(nil)(&handler) != &handler {
+		t.Error("expected a nil limiter to leave the handler as is")
+	}
+}
@@ -2,64 +2,117 @@ package main
 
 import (
 	"github.com/psanodiya94/gobooking.com/internal/config"
+	"github.com/psanodiya94/gobooking.com/internal/csp"
 	"github.com/psanodiya94/gobooking.com/internal/handlers"
+	"github.com/psanodiya94/gobooking.com/internal/metrics"
 	"net/http"
-	"path/filepath"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
 )
 
 func routes(app *config.AppConfig) http.Handler {
 	mux := chi.NewRouter()
 
-	mux.Use(middleware.Recoverer)
-	mux.Use(SessionLoad)
-	mux.Use(NoSurf)
-
-	mux.Get("/", handlers.Repo.Home)
-	mux.Get("/about", handlers.Repo.About)
-	mux.Get("/contact", handlers.Repo.Contact)
-
-	mux.Get("/majors-suite", handlers.Repo.Majors)
-	mux.Get("/generals-quarters", handlers.Repo.Generals)
-
-	mux.Get("/search-availability", handlers.Repo.GetAvailability)
-	mux.Post("/search-availability", handlers.Repo.PostAvailability)
-	mux.Post("/search-availability-json", handlers.Repo.JsonAvailability)
-
-	mux.Get("/choose-room/{id}", handlers.Repo.ChooseRoom)
-	mux.Get("/book-room", handlers.Repo.BookRoom)
-
-	mux.Get("/make-reservation", handlers.Repo.GetReservation)
-	mux.Post("/make-reservation", handlers.Repo.PostReservation)
-
-	mux.Get("/reservation-summary", handlers.Repo.ReservationSummary)
-
-	mux.Get("/user/login", handlers.Repo.GetShowLogin)
-	mux.Post("/user/login", handlers.Repo.PostShowLogin)
-
-	mux.Get("/user/logout", handlers.Repo.GetLogout)
-
-	FileServer := http.FileServer(http.Dir(filepath.Join(".", "static")))
-	mux.Handle("/static/*", http.StripPrefix("/static", FileServer))
-
-	mux.Route("/admin", func(mux chi.Router) {
-		mux.Use(Auth)
-
-		mux.Get("/dashboard", handlers.Repo.GetAdminDashboard)
-		mux.Get("/reservations-all", handlers.Repo.GetAdminAllReservations)
-		mux.Get("/reservations-new", handlers.Repo.GetAdminNewReservations)
-
-		mux.Get("/process-reservations/{src}/{id}/do", handlers.Repo.GetAdminProcessReservation)
-		mux.Get("/delete-reservations/{src}/{id}/do", handlers.Repo.GetAdminDeleteReservation)
-
-		mux.Get("/reservations/{src}/{id}/show", handlers.Repo.GetAdminShowReservation)
-		mux.Post("/reservations/{src}/{id}", handlers.Repo.PostAdminShowReservation)
-
-		mux.Get("/reservations-calendar", handlers.Repo.GetAdminReservationsCalendar)
-		mux.Post("/reservations-calendar", handlers.Repo.PostAdminReservationsCalendar)
-
+	mux.Use(RequestID)
+	mux.Use(AccessLog)
+	mux.Use(Metrics)
+	// inside SecureHeaders, so the error page after a panic has the nonce
+	mux.Use(SecureHeaders)
+	mux.Use(Recover)
+
+	mux.NotFound(NotFound)
+	mux.MethodNotAllowed(MethodNotAllowed)
+
+	// probes and scrapes must not create sessions or csrf cookies
+	mux.Get("/healthz", probes.Healthz)
+	mux.Get("/readyz", probes.Readyz)
+	if settings.Metrics.Enabled {
+		mux.With(MetricsAuth).Handle("/metrics", metrics.Handler())
+	}
+
+	// browsers post violation reports without cookies or csrf tokens
+	mux.With(RateLimitJSON(limits.cspReport)).Post(csp.ReportPath, handlers.Repo.PostCSPReport)
+
+	mux.Group(func(mux chi.Router) {
+		mux.Use(SessionLoad)
+		mux.Use(NoSurf)
+
+		mux.Get("/", handlers.Repo.Home)
+		mux.Get("/about", handlers.Repo.About)
+		mux.Get("/contact", handlers.Repo.Contact)
+
+		mux.Get("/majors-suite", handlers.Repo.Majors)
+		mux.Get("/generals-quarters", handlers.Repo.Generals)
+
+		mux.Get("/search-availability", handlers.Repo.GetAvailability)
+		mux.With(RateLimit(limits.search)).Post("/search-availability", handlers.Repo.PostAvailability)
+		mux.With(RateLimitJSON(limits.search)).Post("/search-availability-json", handlers.Repo.JsonAvailability)
+
+		mux.Get("/choose-room/{id}", handlers.Repo.ChooseRoom)
+		mux.Get("/book-room", handlers.Repo.BookRoom)
+
+		mux.Get("/make-reservation", handlers.Repo.GetReservation)
+		mux.With(RateLimit(limits.reservation)).Post("/make-reservation", handlers.Repo.PostReservation)
+
+		mux.Get("/reservation-summary", handlers.Repo.ReservationSummary)
+
+		mux.Get("/user/login", handlers.Repo.GetShowLogin)
+		mux.With(RateLimit(limits.login)).Post("/user/login", handlers.Repo.PostShowLogin)
+
+		mux.Get("/user/logout", handlers.Repo.GetLogout)
+
+		FileServer := http.FileServer(http.FS(app.Static))
+		mux.Handle("/static/*", http.StripPrefix("/static", FileServer))
+
+		mux.Route("/admin", func(mux chi.Router) {
+			mux.Use(Auth)
+
+			mux.Get("/dashboard", handlers.Repo.GetAdminDashboard)
+			mux.Get("/dashboard/json", handlers.Repo.GetAdminDashboardJSON)
+			mux.Get("/reports/{report}", handlers.Repo.GetAdminReport)
+			mux.Get("/reports/{report}/csv", handlers.Repo.GetAdminReportCSV)
+			mux.Post("/reports/{report}/{id}/check-in", handlers.Repo.PostAdminCheckIn)
+			mux.Post("/reports/{report}/{id}/check-out", handlers.Repo.PostAdminCheckOut)
+			mux.Get("/reservations-all", handlers.Repo.GetAdminAllReservations)
+			mux.Get("/reservations-new", handlers.Repo.GetAdminNewReservations)
+			mux.Get("/reservations-json", handlers.Repo.GetAdminReservationsJSON)
+			mux.Get("/reservations-csv", handlers.Repo.GetAdminReservationsCSV)
+			mux.Get("/reservations-import", handlers.Repo.GetAdminImportReservations)
+			mux.Post("/reservations-import", handlers.Repo.PostAdminImportReservations)
+			mux.Get("/search", handlers.Repo.GetAdminSearch)
+
+			mux.Get("/process-reservations/{src}/{id}/do", handlers.Repo.GetAdminProcessReservation)
+			mux.Get("/delete-reservations/{src}/{id}/do", handlers.Repo.GetAdminDeleteReservation)
+
+			mux.Get("/reservations/{src}/{id}/show", handlers.Repo.GetAdminShowReservation)
+			mux.Post("/reservations/{src}/{id}", handlers.Repo.PostAdminShowReservation)
+
+			mux.Get("/reservations-calendar", handlers.Repo.GetAdminReservationsCalendar)
+			mux.Post("/reservations-calendar", handlers.Repo.PostAdminReservationsCalendar)
+
+			mux.Get("/reservations-timeline", handlers.Repo.GetAdminReservationsTimeline)
+			mux.Get("/reservations-timeline/events", handlers.Repo.GetAdminTimelineEvents)
+			mux.Get("/reservations-timeline/rooms", handlers.Repo.GetAdminTimelineRooms)
+
+			mux.Get("/blocks", handlers.Repo.GetAdminBlocks)
+			mux.Get("/blocks/new", handlers.Repo.GetAdminNewBlock)
+			mux.Post("/blocks/new", handlers.Repo.PostAdminNewBlock)
+			mux.Get("/blocks/{id}/edit", handlers.Repo.GetAdminEditBlock)
+			mux.Post("/blocks/{id}/edit", handlers.Repo.PostAdminEditBlock)
+			mux.Post("/blocks/{id}/delete", handlers.Repo.PostAdminDeleteBlock)
+			mux.Post("/block-rules/{id}/delete", handlers.Repo.PostAdminDeleteBlockRule)
+
+			mux.Get("/restrictions", handlers.Repo.GetAdminRestrictions)
+			mux.Get("/restrictions/new", handlers.Repo.GetAdminNewRestriction)
+			mux.Post("/restrictions/new", handlers.Repo.PostAdminNewRestriction)
+			mux.Get("/restrictions/{id}/edit", handlers.Repo.GetAdminEditRestriction)
+			mux.Post("/restrictions/{id}/edit", handlers.Repo.PostAdminEditRestriction)
+			mux.Post("/restrictions/{id}/delete", handlers.Repo.PostAdminDeleteRestriction)
+
+			mux.Get("/sessions", handlers.Repo.GetAdminSessions)
+			mux.Post("/sessions/{id}/revoke", handlers.Repo.PostAdminRevokeSession)
+
+		})
 	})
 
 	return mux
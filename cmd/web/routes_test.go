@@ -4,7 +4,19 @@ import (
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/psanodiya94/gobooking.com/internal/config"
+	"github.com/psanodiya94/gobooking.com/internal/health"
+	"github.com/psanodiya94/gobooking.com/internal/logging"
+	"github.com/psanodiya94/gobooking.com/static"
+	"html"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
 )
 
 func TestRoutes(t *testing.T) {
@@ -17,3 +29,94 @@ func TestRoutes(t *testing.T) {
 		t.Error(fmt.Sprintf("type is not *chi.Mux, type is %T", v))
 	}
 }
+
+func TestRoutes_Probes(t *testing.T) {
+	session = scs.New()
+	probes = health.New(logging.New(os.Stdout, "text", slog.LevelInfo), time.Second)
+
+	var app config.AppConfig
+	mux := routes(&app)
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: expected status 200, got %d", path, rr.Code)
+		}
+
+		if cookies := rr.Result().Cookies(); len(cookies) != 0 {
+			t.Errorf("%s: probe set cookies %v", path, cookies)
+		}
+	}
+}
+
+func TestRoutes_Static(t *testing.T) {
+	session = scs.New()
+
+	app := config.AppConfig{Static: static.FS}
+	mux := routes(&app)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/static/css/styles.css", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected the embedded stylesheet to be served, got status %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/static/static.go", nil))
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected files outside the embedded folders to be missing, got status %d", rr.Code)
+	}
+}
+
+func TestRoutes_NotFound(t *testing.T) {
+	session = scs.New()
+
+	var app config.AppConfig
+	mux := routes(&app)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/no-such-page", nil))
+
+	if rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), "Page not found") {
+		t.Errorf("expected the not found page, got status %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("DELETE", "/about", nil))
+
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405, got %d", rr.Code)
+	}
+}
+
+func TestRoutes_PanicNonce(t *testing.T) {
+	session = scs.New()
+
+	var app config.AppConfig
+	mux := routes(&app).(*chi.Mux)
+	mux.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("something broke")
+	})
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/panic", nil))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status 500, got %d", rr.Code)
+	}
+
+	_, nonce, _ := strings.Cut(rr.Header().Get("Content-Security-Policy"), "'nonce-")
+	nonce, _, _ = strings.Cut(nonce, "'")
+	if nonce == "" {
+		t.Fatal("expected a nonce in the policy")
+	}
+
+	// the template escapes the nonce's base64 characters, which browsers undo
+	if !strings.Contains(html.UnescapeString(rr.Body.String()), `nonce="`+nonce+`"`) {
+		t.Error("expected the error page scripts to carry the policy's nonce")
+	}
+}
@@ -1,34 +1,43 @@
 package main
 
 import (
+	"github.com/psanodiya94/gobooking.com/internal/mailer"
+	"github.com/psanodiya94/gobooking.com/internal/metrics"
 	"github.com/psanodiya94/gobooking.com/internal/models"
 	mail "github.com/xhit/go-simple-mail/v2"
-	"os"
-	"path/filepath"
-	"strings"
 	"time"
 )
 
-func listenForMail() {
+// listenForMail sends queued messages until the channel is closed and drained,
+// then closes the returned channel
+func listenForMail() <-chan struct{} {
+	done := make(chan struct{})
+
 	go func() {
-		for {
-			msg := <-app.MailChan
+		defer close(done)
+		for msg := range app.MailChan {
 			sendMessage(msg)
 		}
 	}()
+
+	return done
 }
 
 func sendMessage(m models.MailData) {
 	server := mail.NewSMTPClient()
-	server.Host = "localhost"
-	server.Port = 1025
+	server.Host = settings.Mail.Host
+	server.Port = settings.Mail.Port
+	server.Username = settings.Mail.Username
+	server.Password = settings.Mail.Password
 	server.KeepAlive = false
 	server.ConnectTimeout = 10 * time.Second
 	server.SendTimeout = 10 * time.Second
 
 	client, err := server.Connect()
 	if err != nil {
-		app.ErrorLog.Println(err)
+		metrics.MessageSendFailures.WithLabelValues("mail").Inc()
+		app.Logger.Error("can't connect to mail server", "to", m.To, "subject", m.Subject, "error", err)
+		failed(m, err)
 	} else {
 		email := mail.NewMSG()
 		email.SetFrom(m.From).AddTo(m.To).SetSubject(m.Subject)
@@ -36,23 +45,31 @@ func sendMessage(m models.MailData) {
 		if m.Template == "" {
 			email.SetBody(mail.TextPlain, m.Content)
 		} else {
-			data, err := os.ReadFile(
-				filepath.Join("./templates/emails", m.Template),
-			)
+			htmlBody, textBody, err := mailer.Render(m.Template, m.Data)
 			if err != nil {
-				app.ErrorLog.Println(err)
-			} else {
-				mailTemplate := string(data)
-				msgToSend := strings.Replace(mailTemplate, "[%body%]", m.Content, 1)
-				email.SetBody(mail.TextHTML, msgToSend)
+				metrics.MessageSendFailures.WithLabelValues("mail").Inc()
+				app.Logger.Error("can't render email", "template", m.Template, "error", err)
+				failed(m, err)
+				return
 			}
+			email.SetBody(mail.TextPlain, textBody)
+			email.AddAlternative(mail.TextHTML, htmlBody)
 		}
 
 		err = email.Send(client)
 		if err != nil {
-			app.ErrorLog.Println(err)
+			metrics.MessageSendFailures.WithLabelValues("mail").Inc()
+			app.Logger.Error("can't send email", "to", m.To, "subject", m.Subject, "error", err)
+			failed(m, err)
 		} else {
-			app.InfoLog.Println("Email sent!")
+			app.Logger.Info("email sent", "to", m.To, "subject", m.Subject)
 		}
 	}
 }
+
+// failed tells the sender of m, if it asked, that m couldn't be sent
+func failed(m models.MailData, err error) {
+	if m.Failed != nil {
+		m.Failed(err)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/psanodiya94/gobooking.com/internal/models"
+	"testing"
+	"time"
+)
+
+func TestListenForMail(t *testing.T) {
+	app.MailChan = make(chan models.MailData, 1)
+	done := listenForMail()
+
+	close(app.MailChan)
+
+	select {
+	case <-done:
+		// do nothing; test passed
+	case <-time.After(time.Second):
+		t.Error("mail listener did not stop after the channel was closed")
+	}
+}
+
+func TestListenForSMS(t *testing.T) {
+	app.SMSChan = make(chan models.SMSData, 1)
+	done := listenForSMS()
+
+	close(app.SMSChan)
+
+	select {
+	case <-done:
+		// do nothing; test passed
+	case <-time.After(time.Second):
+		t.Error("sms listener did not stop after the channel was closed")
+	}
+}
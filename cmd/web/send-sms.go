@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"github.com/psanodiya94/gobooking.com/internal/metrics"
+	"github.com/psanodiya94/gobooking.com/internal/models"
+	"github.com/psanodiya94/gobooking.com/internal/sms"
+	"time"
+)
+
+// listenForSMS sends queued messages until the channel is closed and drained,
+// then closes the returned channel
+func listenForSMS() <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for msg := range app.SMSChan {
+			sendSMS(msg)
+		}
+	}()
+
+	return done
+}
+
+func sendSMS(m models.SMSData) {
+	to, err := sms.NormalizePhone(m.To, app.SMSCountryCode)
+	if err != nil {
+		metrics.MessageSendFailures.WithLabelValues("sms").Inc()
+		app.Logger.Error("can't send sms", "error", err)
+		return
+	}
+
+	body := m.Content
+	if m.Template != "" {
+		body, err = sms.Render(m.Template, m.Data)
+		if err != nil {
+			metrics.MessageSendFailures.WithLabelValues("sms").Inc()
+			app.Logger.Error("can't render sms", "template", m.Template, "error", err)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = smsSender.Send(ctx, sms.Message{To: to, Body: body})
+	if err != nil {
+		metrics.MessageSendFailures.WithLabelValues("sms").Inc()
+		app.Logger.Error("can't send sms", "to", to, "error", err)
+	} else {
+		app.Logger.Info("sms sent", "to", to)
+	}
+}
@@ -1,12 +1,23 @@
 package main
 
 import (
+	"github.com/psanodiya94/gobooking.com/internal/helpers"
+	"github.com/psanodiya94/gobooking.com/internal/logging"
+	"github.com/psanodiya94/gobooking.com/internal/render"
+	"github.com/psanodiya94/gobooking.com/templates"
+	"log/slog"
 	"net/http"
 	"os"
 	"testing"
 )
 
 func TestMain(m *testing.M) {
+	app.Logger = logging.New(os.Stdout, "text", slog.LevelInfo)
+	app.Templates = templates.FS
+
+	helpers.NewHelpers(&app)
+	render.NewRenderer(&app)
+
 	os.Exit(m.Run())
 }
 
@@ -0,0 +1,109 @@
+package assets
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"sync"
+)
+
+// Watcher reports when the files in a file system change, so caches built
+// from files read from disk in development can be rebuilt only when needed
+type Watcher struct {
+	fsys  fs.FS
+	mu    sync.Mutex
+	stamp uint64
+	seen  bool
+}
+
+// NewWatcher creates a watcher for the files in fsys
+func NewWatcher(fsys fs.FS) *Watcher {
+	return &Watcher{fsys: fsys}
+}
+
+// Changed reports whether a file has been added, removed or modified since
+// the previous call. The first call always reports a change.
+func (w *Watcher) Changed() (bool, error) {
+	stamp, err := stampOf(w.fsys)
+	if err != nil {
+		return false, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	changed := !w.seen || stamp != w.stamp
+	w.stamp = stamp
+	w.seen = true
+
+	return changed, nil
+}
+
+// stampOf hashes the name, size and modification time of every file in fsys
+func stampOf(fsys fs.FS) (uint64, error) {
+	h := fnv.New64a()
+
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		_, _ = fmt.Fprintf(h, "%s:%d:%d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+
+	return h.Sum64(), err
+}
+
+// Cache holds what is built from the files of a file system, such as parsed
+// templates, and builds it again only after a file has changed
+type Cache[T any] struct {
+	build   func(fs.FS) (T, error)
+	mu      sync.Mutex
+	watcher *Watcher
+	value   T
+	built   bool
+}
+
+// NewCache creates a cache that builds its value with build
+func NewCache[T any](build func(fs.FS) (T, error)) *Cache[T] {
+	return &Cache[T]{build: build}
+}
+
+// Get returns the value built from fsys, building it again if a file has
+// changed since or the last build failed
+func (c *Cache[T]) Get(fsys fs.FS) (T, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.watcher == nil {
+		c.watcher = NewWatcher(fsys)
+	}
+
+	changed, err := c.watcher.Changed()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	if changed || !c.built {
+		value, err := c.build(fsys)
+		if err != nil {
+			c.built = false
+			return value, err
+		}
+		c.value = value
+		c.built = true
+	}
+
+	return c.value, nil
+}
@@ -0,0 +1,105 @@
+package assets
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher_Changed(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "home.page.tmpl")
+
+	err := os.WriteFile(file, []byte("home"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWatcher(os.DirFS(dir))
+
+	for i, expected := range []bool{true, false} {
+		changed, err := w.Changed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != expected {
+			t.Errorf("call %d: expected changed to be %v", i+1, expected)
+		}
+	}
+
+	// modified
+	err = os.WriteFile(file, []byte("new home"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	_ = os.Chtimes(file, later, later)
+
+	if changed, _ := w.Changed(); !changed {
+		t.Error("modified file not noticed")
+	}
+
+	// added
+	err = os.WriteFile(filepath.Join(dir, "about.page.tmpl"), []byte("about"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if changed, _ := w.Changed(); !changed {
+		t.Error("added file not noticed")
+	}
+
+	// removed
+	err = os.Remove(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if changed, _ := w.Changed(); !changed {
+		t.Error("removed file not noticed")
+	}
+
+	if changed, _ := w.Changed(); changed {
+		t.Error("reported a change when nothing changed")
+	}
+}
+
+func TestCache_Get(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "home.page.tmpl"), []byte("home"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builds := 0
+	fail := true
+	c := NewCache(func(fsys fs.FS) (int, error) {
+		builds++
+		if fail {
+			return 0, errors.New("bad template")
+		}
+		return builds, nil
+	})
+
+	fsys := os.DirFS(dir)
+
+	if _, err := c.Get(fsys); err == nil {
+		t.Fatal("expected the build error")
+	}
+
+	// built again after failing, though no file changed
+	fail = false
+	value, err := c.Get(fsys)
+	if err != nil || value != 2 {
+		t.Fatalf("expected the second build, got %d, %v", value, err)
+	}
+
+	// not built again when nothing changed
+	value, _ = c.Get(fsys)
+	if value != 2 || builds != 2 {
+		t.Errorf("expected the cached build, got %d after %d builds", value, builds)
+	}
+}
@@ -0,0 +1,135 @@
+package calendar
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/psanodiya94/gobooking.com/internal/models"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Day is one day in a room's row of the calendar
+type Day struct {
+	Date          time.Time
+	ReservationId int
+	GuestName     string
+	BlockId       int
+	// BlockNights is how many nights the block on this day lasts; blocks
+	// longer than one night are edited on their own page
+	BlockNights int
+	BlockLabel  string
+	BlockColour string
+}
+
+// Row is a room's days in the calendar window
+type Row struct {
+	Room models.Room
+	Days []Day
+	// Version identifies the room's restrictions, so changes made from a
+	// calendar that is out of date can be refused
+	Version string
+}
+
+// Date returns t as a date at midnight UTC, the way dates come from postgres
+func Date(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Days returns every date from start to end, inclusive
+func Days(start, end time.Time) []time.Time {
+	var days []time.Time
+	for d := Date(start); !d.After(Date(end)); d = d.AddDate(0, 0, 1) {
+		days = append(days, d)
+	}
+	return days
+}
+
+// Build lays the restrictions out as a row of days per room from start to
+// end. A reservation fills every day from check in to check out, a block
+// every night it lasts.
+func Build(rooms []models.Room, restrictions []models.RoomRestriction, start, end time.Time) []Row {
+	days := Days(start, end)
+	first := Date(start)
+
+	rows := make([]Row, len(rooms))
+	index := make(map[int]int, len(rooms))
+	byRoom := make(map[int][]models.RoomRestriction, len(rooms))
+
+	for i, room := range rooms {
+		rows[i] = Row{Room: room, Days: make([]Day, len(days))}
+		for j, d := range days {
+			rows[i].Days[j].Date = d
+		}
+		index[room.Id] = i
+	}
+
+	for _, x := range restrictions {
+		i, ok := index[x.RoomId]
+		if !ok {
+			continue
+		}
+		byRoom[x.RoomId] = append(byRoom[x.RoomId], x)
+
+		row := rows[i].Days
+
+		if x.ReservationId == 0 {
+			nights := max(dayIndex(Date(x.CheckIn), x.CheckOut), 1)
+			label := BlockLabel(x)
+			from := max(dayIndex(first, x.CheckIn), 0)
+			to := min(dayIndex(first, x.CheckIn)+nights-1, len(row)-1)
+			for j := from; j <= to; j++ {
+				row[j].BlockId = x.Id
+				row[j].BlockNights = nights
+				row[j].BlockLabel = label
+				row[j].BlockColour = x.Restriction.Colour
+			}
+			continue
+		}
+
+		name := strings.TrimSpace(x.Reservation.FirstName + " " + x.Reservation.LastName)
+		from := max(dayIndex(first, x.CheckIn), 0)
+		to := min(dayIndex(first, x.CheckOut), len(row)-1)
+		for j := from; j <= to; j++ {
+			row[j].ReservationId = x.ReservationId
+			row[j].GuestName = name
+		}
+	}
+
+	for i := range rows {
+		rows[i].Version = Version(byRoom[rows[i].Room.Id])
+	}
+
+	return rows
+}
+
+// BlockLabel describes a block by its type and note
+func BlockLabel(x models.RoomRestriction) string {
+	label := x.Restriction.RestrictionName
+	if label == "" {
+		label = "Blocked"
+	}
+	if x.Note != "" {
+		label += ": " + x.Note
+	}
+	return label
+}
+
+// Version identifies the state of a set of restrictions
+func Version(restrictions []models.RoomRestriction) string {
+	lines := make([]string, 0, len(restrictions))
+	for _, x := range restrictions {
+		lines = append(lines, fmt.Sprintf("%d:%d:%d:%s:%s:%s",
+			x.Id, x.ReservationId, x.RestrictionId, x.CheckIn.Format("2006-01-02"), x.CheckOut.Format("2006-01-02"), x.Note))
+	}
+	sort.Strings(lines)
+
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// dayIndex returns how many days t is after first
+func dayIndex(first, t time.Time) int {
+	return int(Date(t).Sub(first).Hours() / 24)
+}
@@ -0,0 +1,96 @@
+package calendar
+
+import (
+	"github.com/psanodiya94/gobooking.com/internal/models"
+	"testing"
+	"time"
+)
+
+func TestDays(t *testing.T) {
+	start := time.Date(2024, 2, 27, 15, 0, 0, 0, time.Local)
+	days := Days(start, time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC))
+
+	if len(days) != 5 {
+		t.Fatalf("expected 5 days across the leap day, got %d", len(days))
+	}
+
+	if !days[0].Equal(time.Date(2024, 2, 27, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected days to start at midnight utc, got %s", days[0])
+	}
+}
+
+func TestBuild(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	rooms := []models.Room{{Id: 1}, {Id: 2}}
+	restrictions := []models.RoomRestriction{
+		// starts before the window
+		{
+			Id:            1,
+			RoomId:        1,
+			ReservationId: 7,
+			CheckIn:       time.Date(2024, 2, 27, 0, 0, 0, 0, time.UTC),
+			CheckOut:      time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC),
+			Reservation:   models.Reservation{FirstName: "John", LastName: "Smith"},
+		},
+		{Id: 2, RoomId: 2, CheckIn: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), CheckOut: time.Date(2024, 3, 6, 0, 0, 0, 0, time.UTC)},
+		// a room that isn't shown
+		{Id: 3, RoomId: 9, CheckIn: start, CheckOut: end},
+		// three nights of maintenance
+		{
+			Id:          4,
+			RoomId:      2,
+			CheckIn:     time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC),
+			CheckOut:    time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC),
+			Note:        "Repaint",
+			Restriction: models.Restriction{RestrictionName: "Maintenance"},
+		},
+	}
+
+	rows := Build(rooms, restrictions, start, end)
+	if len(rows) != 2 || len(rows[0].Days) != 10 {
+		t.Fatalf("expected 2 rows of 10 days, got %d rows", len(rows))
+	}
+
+	for j, day := range rows[0].Days {
+		reserved := j <= 1
+		if (day.ReservationId == 7) != reserved {
+			t.Errorf("day %d: expected reserved %t", j+1, reserved)
+		}
+		if reserved && day.GuestName != "John Smith" {
+			t.Errorf("day %d: expected the guest name, got %q", j+1, day.GuestName)
+		}
+	}
+
+	if rows[1].Days[4].BlockId != 2 || rows[1].Days[4].BlockNights != 1 || rows[1].Days[5].BlockId != 0 {
+		t.Error("expected the one night block on its first day only")
+	}
+
+	for _, day := range rows[1].Days[7:] {
+		if day.BlockId != 4 || day.BlockNights != 3 || day.BlockLabel != "Maintenance: Repaint" {
+			t.Errorf("%s: expected every night of the maintenance block, got %+v", day.Date.Format("2006-01-02"), day)
+		}
+	}
+
+	if rows[0].Version == rows[1].Version {
+		t.Error("expected rooms with different restrictions to have different versions")
+	}
+
+	if Build(rooms[1:], restrictions, start, end)[0].Version != rows[1].Version {
+		t.Error("expected a room's version to only depend on its own restrictions")
+	}
+}
+
+func TestVersion(t *testing.T) {
+	a := models.RoomRestriction{Id: 1, CheckIn: time.Now(), CheckOut: time.Now()}
+	b := models.RoomRestriction{Id: 2, CheckIn: time.Now(), CheckOut: time.Now()}
+
+	if Version([]models.RoomRestriction{a, b}) != Version([]models.RoomRestriction{b, a}) {
+		t.Error("expected the version not to depend on order")
+	}
+
+	if Version([]models.RoomRestriction{a}) == Version([]models.RoomRestriction{a, b}) {
+		t.Error("expected a new restriction to change the version")
+	}
+}
@@ -0,0 +1,56 @@
+package calendar
+
+import (
+	"github.com/psanodiya94/gobooking.com/internal/models"
+	"time"
+)
+
+// RuleYears is how far ahead of today the blocks of a recurring rule are made
+const RuleYears = 2
+
+// Occurrences returns the blocks a rule makes from from up to its until date,
+// or up to horizon if that is sooner or the rule has no end. Blocks that end
+// before from are left out and one that is under way starts on from.
+func Occurrences(rule models.BlockRule, from, horizon time.Time) []models.RoomRestriction {
+	first, last := Date(from), Date(horizon)
+	if !rule.Until.IsZero() && Date(rule.Until).Before(last) {
+		last = Date(rule.Until)
+	}
+
+	start, end := Date(rule.StartDate), Date(rule.EndDate)
+
+	var blocks []models.RoomRestriction
+	for i := 0; ; i++ {
+		var checkIn, checkOut time.Time
+		switch rule.Frequency {
+		case models.Weekly:
+			checkIn, checkOut = start.AddDate(0, 0, 7*i), end.AddDate(0, 0, 7*i)
+		case models.Yearly:
+			checkIn, checkOut = start.AddDate(i, 0, 0), end.AddDate(i, 0, 0)
+		default:
+			checkIn, checkOut = start, end
+		}
+
+		if checkIn.After(last) || (i > 0 && rule.Frequency != models.Weekly && rule.Frequency != models.Yearly) {
+			break
+		}
+
+		if !checkOut.After(first) {
+			continue
+		}
+		if checkIn.Before(first) {
+			checkIn = first
+		}
+
+		blocks = append(blocks, models.RoomRestriction{
+			RoomId:        rule.RoomId,
+			RestrictionId: rule.RestrictionId,
+			Note:          rule.Note,
+			BlockRuleId:   rule.Id,
+			CheckIn:       checkIn,
+			CheckOut:      checkOut,
+		})
+	}
+
+	return blocks
+}
@@ -0,0 +1,97 @@
+package calendar
+
+import (
+	"github.com/psanodiya94/gobooking.com/internal/models"
+	"testing"
+	"time"
+)
+
+func TestOccurrences(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		rule     models.BlockRule
+		from     time.Time
+		horizon  time.Time
+		expected []time.Time
+	}{
+		{
+			name:     "once",
+			rule:     models.BlockRule{StartDate: day(2024, 3, 4), EndDate: day(2024, 3, 5)},
+			from:     day(2024, 1, 1),
+			horizon:  day(2026, 1, 1),
+			expected: []time.Time{day(2024, 3, 4)},
+		},
+		{
+			name:     "every monday up to the horizon",
+			rule:     models.BlockRule{Frequency: models.Weekly, StartDate: day(2024, 3, 4), EndDate: day(2024, 3, 5)},
+			from:     day(2024, 1, 1),
+			horizon:  day(2024, 3, 25),
+			expected: []time.Time{day(2024, 3, 4), day(2024, 3, 11), day(2024, 3, 18), day(2024, 3, 25)},
+		},
+		{
+			name:     "every monday until",
+			rule:     models.BlockRule{Frequency: models.Weekly, StartDate: day(2024, 3, 4), EndDate: day(2024, 3, 5), Until: day(2024, 3, 17)},
+			from:     day(2024, 1, 1),
+			horizon:  day(2026, 1, 1),
+			expected: []time.Time{day(2024, 3, 4), day(2024, 3, 11)},
+		},
+		{
+			name:     "every december",
+			rule:     models.BlockRule{Frequency: models.Yearly, StartDate: day(2024, 12, 1), EndDate: day(2025, 1, 1)},
+			from:     day(2024, 1, 1),
+			horizon:  day(2026, 12, 31),
+			expected: []time.Time{day(2024, 12, 1), day(2025, 12, 1), day(2026, 12, 1)},
+		},
+		{
+			name:     "past mondays left out",
+			rule:     models.BlockRule{Frequency: models.Weekly, StartDate: day(2024, 3, 4), EndDate: day(2024, 3, 5)},
+			from:     day(2024, 3, 15),
+			horizon:  day(2024, 3, 25),
+			expected: []time.Time{day(2024, 3, 18), day(2024, 3, 25)},
+		},
+		{
+			name:     "december under way",
+			rule:     models.BlockRule{Frequency: models.Yearly, StartDate: day(2024, 12, 1), EndDate: day(2025, 1, 1)},
+			from:     day(2025, 12, 10),
+			horizon:  day(2026, 12, 31),
+			expected: []time.Time{day(2025, 12, 10), day(2026, 12, 1)},
+		},
+		{
+			name:     "once in the past",
+			rule:     models.BlockRule{StartDate: day(2024, 3, 4), EndDate: day(2024, 3, 5)},
+			from:     day(2024, 3, 5),
+			horizon:  day(2026, 1, 1),
+			expected: nil,
+		},
+	}
+
+	for _, e := range tests {
+		blocks := Occurrences(e.rule, e.from, e.horizon)
+		if len(blocks) != len(e.expected) {
+			t.Errorf("%s: expected %d blocks, got %d", e.name, len(e.expected), len(blocks))
+			continue
+		}
+
+		for i, block := range blocks {
+			if !block.CheckIn.Equal(e.expected[i]) || !block.CheckOut.Equal(ruleCheckOut(e.rule, block.CheckIn)) {
+				t.Errorf("%s: block %d: unexpected dates %s to %s", e.name, i, block.CheckIn.Format("2006-01-02"), block.CheckOut.Format("2006-01-02"))
+			}
+		}
+	}
+}
+
+// ruleCheckOut returns the end of the rule's block that covers checkIn
+func ruleCheckOut(rule models.BlockRule, checkIn time.Time) time.Time {
+	switch rule.Frequency {
+	case models.Weekly:
+		weeks := int(checkIn.Sub(rule.StartDate).Hours() / (24 * 7))
+		return rule.EndDate.AddDate(0, 0, 7*weeks)
+	case models.Yearly:
+		return rule.EndDate.AddDate(checkIn.Year()-rule.StartDate.Year(), 0, 0)
+	}
+	return rule.EndDate
+}
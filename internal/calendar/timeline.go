@@ -0,0 +1,138 @@
+package calendar
+
+import (
+	"github.com/psanodiya94/gobooking.com/internal/models"
+	"strings"
+	"time"
+)
+
+// Kinds of timeline segments
+const (
+	Free  = "free"
+	Stay  = "stay"
+	Block = "block"
+)
+
+// Segment is a run of days in a room's timeline: a stay, a block or a
+// single free day
+type Segment struct {
+	Kind          string
+	Span          int
+	RestrictionId int
+	ReservationId int
+	GuestName     string
+	// Label describes a block by its type and note
+	Label string
+	// Colour is the colour of the restriction's type
+	Colour   string
+	CheckIn  time.Time
+	CheckOut time.Time
+}
+
+// TimelineRow is a room's segments across the timeline
+type TimelineRow struct {
+	Room     models.Room
+	Segments []Segment
+}
+
+// Month is a month heading spanning its days in the timeline
+type Month struct {
+	Date time.Time
+	Span int
+}
+
+// Timeline lays out stays and blocks with rooms as rows and days as columns
+type Timeline struct {
+	Start  time.Time
+	End    time.Time
+	Days   []time.Time
+	Months []Month
+	Rows   []TimelineRow
+}
+
+// NewTimeline builds the timeline of rooms from start to end, inclusive.
+// Unlike the month grid, a stay covers the nights from check in up to the
+// day of check out, so back to back stays don't overlap.
+func NewTimeline(rooms []models.Room, restrictions []models.RoomRestriction, start, end time.Time) Timeline {
+	t := Timeline{
+		Start: Date(start),
+		End:   Date(end),
+		Days:  Days(start, end),
+	}
+
+	for _, d := range t.Days {
+		if n := len(t.Months); n > 0 && t.Months[n-1].Date.Month() == d.Month() {
+			t.Months[n-1].Span++
+			continue
+		}
+		t.Months = append(t.Months, Month{Date: d, Span: 1})
+	}
+
+	byRoom := make(map[int][]models.RoomRestriction, len(rooms))
+	for _, x := range restrictions {
+		byRoom[x.RoomId] = append(byRoom[x.RoomId], x)
+	}
+
+	for _, room := range rooms {
+		t.Rows = append(t.Rows, TimelineRow{
+			Room:     room,
+			Segments: segments(byRoom[room.Id], t.Start, len(t.Days)),
+		})
+	}
+
+	return t
+}
+
+// segments merges the days taken by each restriction into runs
+func segments(restrictions []models.RoomRestriction, first time.Time, days int) []Segment {
+	// the restriction taking each day, -1 when free
+	taken := make([]int, days)
+	for j := range taken {
+		taken[j] = -1
+	}
+
+	for i, x := range restrictions {
+		from := max(dayIndex(first, x.CheckIn), 0)
+		to := min(dayIndex(first, x.CheckOut), days)
+		if to <= from {
+			// a restriction must take at least the day it starts on
+			to = from + 1
+		}
+		for j := from; j < to && j < days; j++ {
+			taken[j] = i
+		}
+	}
+
+	var out []Segment
+	for j := 0; j < days; j++ {
+		i := taken[j]
+		if i < 0 {
+			out = append(out, Segment{Kind: Free, Span: 1})
+			continue
+		}
+
+		if n := len(out); n > 0 && j > 0 && taken[j-1] == i {
+			out[n-1].Span++
+			continue
+		}
+
+		x := restrictions[i]
+		segment := Segment{
+			Kind:          Block,
+			Span:          1,
+			RestrictionId: x.Id,
+			CheckIn:       x.CheckIn,
+			CheckOut:      x.CheckOut,
+			Label:         BlockLabel(x),
+			Colour:        x.Restriction.Colour,
+		}
+		if x.ReservationId > 0 {
+			segment.Kind = Stay
+			segment.ReservationId = x.ReservationId
+			segment.GuestName = strings.TrimSpace(x.Reservation.FirstName + " " + x.Reservation.LastName)
+		}
+		out = append(out, segment)
+	}
+
+	return out
+}
@@ -0,0 +1,65 @@
+package calendar
+
+import (
+	"github.com/psanodiya94/gobooking.com/internal/models"
+	"testing"
+	"time"
+)
+
+func TestNewTimeline(t *testing.T) {
+	day := func(m time.Month, d int) time.Time {
+		return time.Date(2024, m, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	rooms := []models.Room{{Id: 1}, {Id: 2}}
+	restrictions := []models.RoomRestriction{
+		{Id: 1, RoomId: 1, ReservationId: 5, CheckIn: day(1, 30), CheckOut: day(2, 2), Reservation: models.Reservation{FirstName: "Jane", LastName: "Doe"}},
+		// back to back with the first stay
+		{Id: 2, RoomId: 1, ReservationId: 6, CheckIn: day(2, 2), CheckOut: day(2, 4)},
+		{Id: 3, RoomId: 2, CheckIn: day(2, 3), CheckOut: day(2, 4)},
+	}
+
+	timeline := NewTimeline(rooms, restrictions, day(1, 31), day(2, 5))
+
+	if len(timeline.Days) != 6 {
+		t.Fatalf("expected 6 days, got %d", len(timeline.Days))
+	}
+
+	if len(timeline.Months) != 2 || timeline.Months[0].Span != 1 || timeline.Months[1].Span != 5 {
+		t.Errorf("expected january over 1 day and february over 5, got %+v", timeline.Months)
+	}
+
+	kinds := func(segments []Segment) []string {
+		var out []string
+		for _, s := range segments {
+			for i := 0; i < s.Span; i++ {
+				out = append(out, s.Kind)
+			}
+		}
+		return out
+	}
+
+	expected := [][]string{
+		{Stay, Stay, Stay, Stay, Free, Free},
+		{Free, Free, Free, Block, Free, Free},
+	}
+
+	for i, row := range timeline.Rows {
+		got := kinds(row.Segments)
+		for j := range expected[i] {
+			if got[j] != expected[i][j] {
+				t.Errorf("room %d: expected %v, got %v", row.Room.Id, expected[i], got)
+				break
+			}
+		}
+	}
+
+	first := timeline.Rows[0].Segments[0]
+	if first.Span != 2 || first.GuestName != "Jane Doe" || first.ReservationId != 5 {
+		t.Errorf("expected the first stay clipped to 2 days, got %+v", first)
+	}
+
+	if second := timeline.Rows[0].Segments[1]; second.ReservationId != 6 || second.Span != 2 {
+		t.Errorf("expected back to back stays as separate bars, got %+v", second)
+	}
+}
@@ -2,20 +2,34 @@ package config
 
 import (
 	"github.com/psanodiya94/gobooking.com/internal/models"
-	"log"
-	"text/template"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	texttemplate "text/template"
+	"time"
 
 	"github.com/alexedwards/scs/v2"
 )
 
 // AppConfig holds the application config
 type AppConfig struct {
-	UseCache      bool
-	InProduction  bool
-	TemplateCache map[string]*template.Template
-	InfoLog       *log.Logger
-	ErrorLog      *log.Logger
-	Session       *scs.SessionManager
-	MailChan      chan models.MailData
-	ConnString    string
+	UseCache            bool
+	InProduction        bool
+	Templates           fs.FS
+	Static              fs.FS
+	TemplateCache       map[string]*template.Template
+	EmailTemplateCache  map[string]*template.Template
+	Logger              *slog.Logger
+	Session             *scs.SessionManager
+	MailChan            chan models.MailData
+	SMSChan             chan models.SMSData
+	SMSTemplateCache    map[string]*texttemplate.Template
+	SMSCountryCode      string
+	ConnString          string
+	ReminderDays        int
+	ArrivalInstructions string
+	MailFrom            string
+	OwnerEmail          string
+	DigestAt            string
+	Location            *time.Location
 }
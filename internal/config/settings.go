@@ -0,0 +1,562 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/psanodiya94/gobooking.com/internal/logging"
+	"github.com/psanodiya94/gobooking.com/internal/ratelimit"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Settings holds the settings the application is started with. Each field is
+// read, in increasing order of precedence, from its default, the config file
+// (yaml tag), the environment (env tag) and the command line (flag tag).
+// Any env variable can instead be read from a file named by <env>_FILE.
+type Settings struct {
+	InProduction bool   `yaml:"production" env:"GOBOOKING_PRODUCTION" flag:"production" usage:"application is in production"`
+	UseCache     bool   `yaml:"cache" env:"GOBOOKING_CACHE" flag:"cache" usage:"use the embedded templates and static files, otherwise read them from disk and reload them on change"`
+	AssetsDir    string `yaml:"assets_dir" env:"GOBOOKING_ASSETS_DIR" flag:"assets-dir" usage:"folder holding the templates and static folders, read when not using the cache"`
+
+	Server    ServerSettings    `yaml:"server"`
+	Log       LogSettings       `yaml:"log"`
+	Security  SecuritySettings  `yaml:"security"`
+	RateLimit RateLimitSettings `yaml:"rate_limit"`
+	Session   SessionSettings   `yaml:"session"`
+	Database  DatabaseSettings  `yaml:"database"`
+	Mail      MailSettings      `yaml:"mail"`
+	SMS       SMSSettings       `yaml:"sms"`
+	Scheduler SchedulerSettings `yaml:"scheduler"`
+	Metrics   MetricsSettings   `yaml:"metrics"`
+}
+
+// ServerSettings holds the http server settings
+type ServerSettings struct {
+	Host            string        `yaml:"host" env:"GOBOOKING_HOST" flag:"host" usage:"interface to listen on"`
+	Port            int           `yaml:"port" env:"GOBOOKING_PORT" flag:"port" usage:"port to listen on"`
+	ReadTimeout     time.Duration `yaml:"read_timeout" env:"GOBOOKING_READ_TIMEOUT" flag:"read-timeout" usage:"maximum duration for reading a request"`
+	WriteTimeout    time.Duration `yaml:"write_timeout" env:"GOBOOKING_WRITE_TIMEOUT" flag:"write-timeout" usage:"maximum duration for writing a response"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" env:"GOBOOKING_IDLE_TIMEOUT" flag:"idle-timeout" usage:"maximum time to keep idle connections open"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"GOBOOKING_SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" usage:"maximum time to wait for requests and queued messages on shutdown"`
+}
+
+// LogSettings holds the application log settings
+type LogSettings struct {
+	Format string `yaml:"format" env:"GOBOOKING_LOG_FORMAT" flag:"log-format" usage:"log output format (text, json)"`
+	Level  string `yaml:"level" env:"GOBOOKING_LOG_LEVEL" flag:"log-level" usage:"minimum level to log (debug, info, warn, error)"`
+}
+
+// SecuritySettings holds the security header settings
+type SecuritySettings struct {
+	HSTSMaxAge    time.Duration `yaml:"hsts_max_age" env:"GOBOOKING_HSTS_MAX_AGE" flag:"hsts-max-age" usage:"max age sent in the Strict-Transport-Security header, 0 to leave it out"`
+	CSPReportOnly bool          `yaml:"csp_report_only" env:"GOBOOKING_CSP_REPORT_ONLY" flag:"csp-report-only" usage:"only report content security policy violations instead of blocking them"`
+	CSPSources    string        `yaml:"csp_sources" env:"GOBOOKING_CSP_SOURCES" flag:"csp-sources" usage:"space separated origins allowed to serve scripts, styles, fonts and images"`
+}
+
+// RateLimitSettings holds the limits on requests that hit the database, per
+// client ip
+type RateLimitSettings struct {
+	Enabled          bool   `yaml:"enabled" env:"GOBOOKING_RATE_LIMIT" flag:"rate-limit" usage:"limit how often a client can search, book, log in and report csp violations"`
+	TrustedProxies   string `yaml:"trusted_proxies" env:"GOBOOKING_TRUSTED_PROXIES" flag:"trusted-proxies" usage:"comma separated proxy addresses or cidr ranges whose X-Forwarded-For header is trusted"`
+	SearchRate       int    `yaml:"search_rate" env:"GOBOOKING_SEARCH_RATE" flag:"search-rate" usage:"availability searches a client can make per minute"`
+	SearchBurst      int    `yaml:"search_burst" env:"GOBOOKING_SEARCH_BURST" flag:"search-burst" usage:"availability searches a client can make at once"`
+	ReservationRate  int    `yaml:"reservation_rate" env:"GOBOOKING_RESERVATION_RATE" flag:"reservation-rate" usage:"reservations a client can submit per minute"`
+	ReservationBurst int    `yaml:"reservation_burst" env:"GOBOOKING_RESERVATION_BURST" flag:"reservation-burst" usage:"reservations a client can submit at once"`
+	LoginRate        int    `yaml:"login_rate" env:"GOBOOKING_LOGIN_RATE" flag:"login-rate" usage:"login attempts a client can make per minute"`
+	LoginBurst       int    `yaml:"login_burst" env:"GOBOOKING_LOGIN_BURST" flag:"login-burst" usage:"login attempts a client can make at once"`
+	CSPReportRate    int    `yaml:"csp_report_rate" env:"GOBOOKING_CSP_REPORT_RATE" flag:"csp-report-rate" usage:"csp violation reports a client can post per minute"`
+	CSPReportBurst   int    `yaml:"csp_report_burst" env:"GOBOOKING_CSP_REPORT_BURST" flag:"csp-report-burst" usage:"csp violation reports a client can post at once"`
+}
+
+// SessionSettings holds where sessions are kept and for how long
+type SessionSettings struct {
+	Store           string        `yaml:"store" env:"GOBOOKING_SESSION_STORE" flag:"session-store" usage:"where sessions are kept (memory, postgres)"`
+	Lifetime        time.Duration `yaml:"lifetime" env:"GOBOOKING_SESSION_LIFETIME" flag:"session-lifetime" usage:"how long a session lasts"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval" env:"GOBOOKING_SESSION_CLEANUP_INTERVAL" flag:"session-cleanup-interval" usage:"how often expired sessions are deleted from postgres"`
+}
+
+// DatabaseSettings holds the postgres connection settings
+type DatabaseSettings struct {
+	Host            string `yaml:"host" env:"GOBOOKING_DB_HOST" flag:"dbhost" usage:"database host"`
+	Port            int    `yaml:"port" env:"GOBOOKING_DB_PORT" flag:"dbport" usage:"database port"`
+	Name            string `yaml:"name" env:"GOBOOKING_DB_NAME" flag:"dbname" usage:"database name"`
+	User            string `yaml:"user" env:"GOBOOKING_DB_USER" flag:"dbuser" usage:"database user"`
+	Password        string `yaml:"password" env:"GOBOOKING_DB_PASSWORD" flag:"dbpass" usage:"database password" secret:"true"`
+	SSLMode         string `yaml:"ssl_mode" env:"GOBOOKING_DB_SSL" flag:"dbssl" usage:"database ssl settings (disable, prefer, require)"`
+	CheckMigrations bool   `yaml:"check_migrations" env:"GOBOOKING_DB_CHECK_MIGRATIONS" flag:"check-migrations" usage:"only report ready once the database is at the newest migration"`
+}
+
+// MailSettings holds the smtp server and email addresses
+type MailSettings struct {
+	Host       string `yaml:"host" env:"GOBOOKING_MAIL_HOST" flag:"mail-host" usage:"smtp server host"`
+	Port       int    `yaml:"port" env:"GOBOOKING_MAIL_PORT" flag:"mail-port" usage:"smtp server port"`
+	Username   string `yaml:"username" env:"GOBOOKING_MAIL_USERNAME" flag:"mail-username" usage:"smtp username"`
+	Password   string `yaml:"password" env:"GOBOOKING_MAIL_PASSWORD" flag:"mail-password" usage:"smtp password" secret:"true"`
+	From       string `yaml:"from" env:"GOBOOKING_MAIL_FROM" flag:"mail-from" usage:"address emails are sent from"`
+	OwnerEmail string `yaml:"owner_email" env:"GOBOOKING_OWNER_EMAIL" flag:"owner-email" usage:"email address of the property owner"`
+}
+
+// SMSSettings holds the text message provider settings
+type SMSSettings struct {
+	Provider    string `yaml:"provider" env:"GOBOOKING_SMS_PROVIDER" flag:"sms-provider" usage:"sms provider (log, http)"`
+	URL         string `yaml:"url" env:"GOBOOKING_SMS_URL" flag:"sms-url" usage:"url of the http sms provider api"`
+	Token       string `yaml:"token" env:"GOBOOKING_SMS_TOKEN" flag:"sms-token" usage:"api token for the http sms provider" secret:"true"`
+	From        string `yaml:"from" env:"GOBOOKING_SMS_FROM" flag:"sms-from" usage:"sender id for text messages"`
+	CountryCode string `yaml:"country_code" env:"GOBOOKING_SMS_COUNTRY_CODE" flag:"sms-country-code" usage:"country calling code for phone numbers without one"`
+}
+
+// SchedulerSettings holds the settings of the scheduled jobs
+type SchedulerSettings struct {
+	Enabled             bool          `yaml:"enabled" env:"GOBOOKING_SCHEDULER" flag:"scheduler" usage:"run scheduled guest emails in this process"`
+	Interval            time.Duration `yaml:"interval" env:"GOBOOKING_SCHEDULER_INTERVAL" flag:"scheduler-interval" usage:"how often scheduled jobs run"`
+	ReminderDays        int           `yaml:"reminder_days" env:"GOBOOKING_REMINDER_DAYS" flag:"reminder-days" usage:"days before check in to send the arrival reminder"`
+	ArrivalInstructions string        `yaml:"arrival_instructions" env:"GOBOOKING_ARRIVAL_INSTRUCTIONS" flag:"arrival-instructions" usage:"instructions sent to guests on the day of arrival"`
+	DigestAt            string        `yaml:"digest_at" env:"GOBOOKING_DIGEST_AT" flag:"digest-at" usage:"local time (HH:MM) to send the owner's daily digest, empty to disable"`
+	TimeZone            string        `yaml:"timezone" env:"GOBOOKING_TIMEZONE" flag:"timezone" usage:"time zone of the property"`
+}
+
+// MetricsSettings holds whether /metrics is served and to whom
+type MetricsSettings struct {
+	Enabled  bool   `yaml:"enabled" env:"GOBOOKING_METRICS" flag:"metrics" usage:"serve prometheus metrics on /metrics"`
+	Username string `yaml:"username" env:"GOBOOKING_METRICS_USERNAME" flag:"metrics-username" usage:"basic auth username for /metrics"`
+	Password string `yaml:"password" env:"GOBOOKING_METRICS_PASSWORD" flag:"metrics-password" usage:"basic auth password for /metrics, required in production" secret:"true"`
+}
+
+// DefaultSettings returns the settings used when nothing else is configured
+func DefaultSettings() Settings {
+	return Settings{
+		InProduction: true,
+		UseCache:     true,
+		AssetsDir:    ".",
+		Server: ServerSettings{
+			Port:            8080,
+			ReadTimeout:     10 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			IdleTimeout:     2 * time.Minute,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Security: SecuritySettings{
+			CSPSources: "https://cdn.jsdelivr.net https://code.jquery.com https://unpkg.com",
+		},
+		RateLimit: RateLimitSettings{
+			Enabled:          true,
+			SearchRate:       30,
+			SearchBurst:      10,
+			ReservationRate:  5,
+			ReservationBurst: 5,
+			LoginRate:        5,
+			LoginBurst:       5,
+			CSPReportRate:    30,
+			CSPReportBurst:   10,
+		},
+		Log: LogSettings{
+			Format: "text",
+			Level:  "info",
+		},
+		Session: SessionSettings{
+			Store:           "postgres",
+			Lifetime:        24 * time.Hour,
+			CleanupInterval: 5 * time.Minute,
+		},
+		Database: DatabaseSettings{
+			Host:            "localhost",
+			Port:            5432,
+			SSLMode:         "disable",
+			CheckMigrations: true,
+		},
+		Mail: MailSettings{
+			Host:       "localhost",
+			Port:       1025,
+			From:       "gobookings@mailhog.com",
+			OwnerEmail: "gobookings@mailhog.com",
+		},
+		SMS: SMSSettings{
+			Provider:    "log",
+			From:        "GoBooking",
+			CountryCode: "1",
+		},
+		Scheduler: SchedulerSettings{
+			Enabled:             true,
+			Interval:            time.Hour,
+			ReminderDays:        3,
+			ArrivalInstructions: "Check in is from 3pm at the front desk.",
+			DigestAt:            "07:00",
+			TimeZone:            "Local",
+		},
+	}
+}
+
+// Options are the command line options that are not settings themselves
+type Options struct {
+	ConfigFile  string
+	PrintConfig bool
+}
+
+// LoadSettings registers the settings flags on fs, parses args and merges
+// defaults, the config file, the environment and the flags that were set
+func LoadSettings(fs *flag.FlagSet, args []string) (Settings, Options, error) {
+	var opts Options
+	settings := DefaultSettings()
+
+	fs.StringVar(&opts.ConfigFile, "config", os.Getenv("GOBOOKING_CONFIG"), "path to a yaml config file")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "print the effective config with secrets redacted and exit")
+
+	// flags are parsed into their own copy, and only the ones set are applied
+	fromFlags := DefaultSettings()
+	for _, f := range settingFields(reflect.ValueOf(&fromFlags).Elem()) {
+		if f.flag != "" {
+			fs.Var(fieldValue{f.value}, f.flag, f.usage)
+		}
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return settings, opts, err
+	}
+
+	if opts.ConfigFile != "" {
+		err = settings.loadFile(opts.ConfigFile)
+		if err != nil {
+			return settings, opts, err
+		}
+	}
+
+	err = settings.loadEnv()
+	if err != nil {
+		return settings, opts, err
+	}
+
+	flagged := make(map[string]reflect.Value)
+	for _, f := range settingFields(reflect.ValueOf(&fromFlags).Elem()) {
+		flagged[f.flag] = f.value
+	}
+	targets := make(map[string]reflect.Value)
+	for _, f := range settingFields(reflect.ValueOf(&settings).Elem()) {
+		targets[f.flag] = f.value
+	}
+	fs.Visit(func(fl *flag.Flag) {
+		if target, ok := targets[fl.Name]; ok {
+			target.Set(flagged[fl.Name])
+		}
+	})
+
+	return settings, opts, nil
+}
+
+// loadFile merges the settings from a yaml config file
+func (s *Settings) loadFile(path string) error {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".yml" && ext != ".yaml" {
+		return fmt.Errorf("config file %s must be yaml", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+
+	err = decoder.Decode(s)
+	if err != nil {
+		return fmt.Errorf("reading config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// loadEnv merges the settings from environment variables
+func (s *Settings) loadEnv() error {
+	for _, f := range settingFields(reflect.ValueOf(s).Elem()) {
+		if f.env == "" {
+			continue
+		}
+
+		raw, ok := os.LookupEnv(f.env)
+		if file, isSet := os.LookupEnv(f.env + "_FILE"); isSet {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("reading %s_FILE: %w", f.env, err)
+			}
+			raw, ok = strings.TrimRight(string(data), "\r\n"), true
+		}
+
+		if !ok {
+			continue
+		}
+
+		err := fieldValue{f.value}.Set(raw)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %w", f.env, err)
+		}
+	}
+
+	return nil
+}
+
+// Addr returns the address the http server listens on
+func (s Settings) Addr() string {
+	return fmt.Sprintf("%s:%d", s.Server.Host, s.Server.Port)
+}
+
+// DSN returns the postgres connection string
+func (s Settings) DSN() string {
+	return fmt.Sprintf(
+		"host=%s port=%d dbname=%s user=%s password=%s sslmode=%s",
+		s.Database.Host, s.Database.Port, s.Database.Name, s.Database.User, s.Database.Password, s.Database.SSLMode,
+	)
+}
+
+// Validate checks the settings and returns all the problems found
+func (s Settings) Validate() error {
+	var errs []error
+
+	if s.Server.Port < 1 || s.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server port %d is out of range", s.Server.Port))
+	}
+
+	for name, d := range map[string]time.Duration{
+		"read timeout":     s.Server.ReadTimeout,
+		"write timeout":    s.Server.WriteTimeout,
+		"idle timeout":     s.Server.IdleTimeout,
+		"shutdown timeout": s.Server.ShutdownTimeout,
+	} {
+		if d <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", name))
+		}
+	}
+
+	switch s.Log.Format {
+	case "text", "json":
+	default:
+		errs = append(errs, fmt.Errorf("unknown log format %q", s.Log.Format))
+	}
+
+	if _, err := logging.ParseLevel(s.Log.Level); err != nil {
+		errs = append(errs, err)
+	}
+
+	if s.Security.HSTSMaxAge < 0 {
+		errs = append(errs, errors.New("hsts max age can't be negative"))
+	}
+
+	for _, source := range strings.Fields(s.Security.CSPSources) {
+		if !strings.HasPrefix(source, "https://") || strings.ContainsAny(source, ";'") {
+			errs = append(errs, fmt.Errorf("csp source %q must be an https origin", source))
+		}
+	}
+
+	if _, err := ratelimit.ParseProxies(s.RateLimit.TrustedProxies); err != nil {
+		errs = append(errs, err)
+	}
+
+	if s.RateLimit.Enabled {
+		for name, n := range map[string]int{
+			"search rate":       s.RateLimit.SearchRate,
+			"search burst":      s.RateLimit.SearchBurst,
+			"reservation rate":  s.RateLimit.ReservationRate,
+			"reservation burst": s.RateLimit.ReservationBurst,
+			"login rate":        s.RateLimit.LoginRate,
+			"login burst":       s.RateLimit.LoginBurst,
+			"csp report rate":   s.RateLimit.CSPReportRate,
+			"csp report burst":  s.RateLimit.CSPReportBurst,
+		} {
+			if n < 1 {
+				errs = append(errs, fmt.Errorf("%s must be at least 1", name))
+			}
+		}
+	}
+
+	switch s.Session.Store {
+	case "memory", "postgres":
+	default:
+		errs = append(errs, fmt.Errorf("unknown session store %q", s.Session.Store))
+	}
+
+	if s.Session.Lifetime <= 0 {
+		errs = append(errs, errors.New("session lifetime must be positive"))
+	}
+
+	if s.Session.CleanupInterval <= 0 {
+		errs = append(errs, errors.New("session cleanup interval must be positive"))
+	}
+
+	if s.Database.Name == "" {
+		errs = append(errs, errors.New("database name is required"))
+	}
+
+	if s.Database.User == "" {
+		errs = append(errs, errors.New("database user is required"))
+	}
+
+	switch s.Database.SSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		errs = append(errs, fmt.Errorf("unknown database ssl mode %q", s.Database.SSLMode))
+	}
+
+	if s.Mail.Port < 1 || s.Mail.Port > 65535 {
+		errs = append(errs, fmt.Errorf("mail port %d is out of range", s.Mail.Port))
+	}
+
+	switch s.SMS.Provider {
+	case "log":
+	case "http":
+		if s.SMS.URL == "" {
+			errs = append(errs, errors.New("the http sms provider needs a url"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown sms provider %q", s.SMS.Provider))
+	}
+
+	if s.Scheduler.Interval <= 0 {
+		errs = append(errs, errors.New("scheduler interval must be positive"))
+	}
+
+	if s.Scheduler.ReminderDays < 1 {
+		errs = append(errs, errors.New("reminder days must be at least 1"))
+	}
+
+	if s.Scheduler.DigestAt != "" {
+		if _, err := time.Parse("15:04", s.Scheduler.DigestAt); err != nil {
+			errs = append(errs, fmt.Errorf("invalid digest time %q, expected HH:MM", s.Scheduler.DigestAt))
+		}
+	}
+
+	if _, err := time.LoadLocation(s.Scheduler.TimeZone); err != nil {
+		errs = append(errs, fmt.Errorf("unknown time zone %q", s.Scheduler.TimeZone))
+	}
+
+	if s.Metrics.Enabled && s.Metrics.Password == "" && s.InProduction {
+		errs = append(errs, errors.New("metrics need a password in production"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Print returns the settings as yaml, with secret values redacted
+func (s Settings) Print() string {
+	var b strings.Builder
+	printFields(&b, reflect.ValueOf(s), 0)
+	return b.String()
+}
+
+func printFields(b *strings.Builder, v reflect.Value, depth int) {
+	indent := strings.Repeat("  ", depth)
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		value := v.Field(i)
+		name := field.Tag.Get("yaml")
+
+		if value.Kind() == reflect.Struct {
+			fmt.Fprintf(b, "%s%s:\n", indent, name)
+			printFields(b, value, depth+1)
+			continue
+		}
+
+		out := fmt.Sprint(value.Interface())
+		if d, ok := value.Interface().(time.Duration); ok {
+			out = d.String()
+		}
+		if field.Tag.Get("secret") == "true" && out != "" {
+			out = "[redacted]"
+		}
+		if value.Kind() == reflect.String {
+			out = strconv.Quote(out)
+		}
+
+		fmt.Fprintf(b, "%s%s: %s\n", indent, name, out)
+	}
+}
+
+// settingField is a settable field of Settings with its tags
+type settingField struct {
+	value reflect.Value
+	env   string
+	flag  string
+	usage string
+}
+
+// settingFields returns the leaf fields of the settings struct v
+func settingFields(v reflect.Value) []settingField {
+	var fields []settingField
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		value := v.Field(i)
+
+		if value.Kind() == reflect.Struct {
+			fields = append(fields, settingFields(value)...)
+			continue
+		}
+
+		fields = append(fields, settingField{
+			value: value,
+			env:   field.Tag.Get("env"),
+			flag:  field.Tag.Get("flag"),
+			usage: field.Tag.Get("usage"),
+		})
+	}
+
+	return fields
+}
+
+// fieldValue adapts a settings field to flag.Value
+type fieldValue struct {
+	v reflect.Value
+}
+
+// String returns the current value of the field
+func (f fieldValue) String() string {
+	if !f.v.IsValid() {
+		return ""
+	}
+	if d, ok := f.v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	return fmt.Sprint(f.v.Interface())
+}
+
+// Set parses raw into the field
+func (f fieldValue) Set(raw string) error {
+	switch f.v.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		f.v.SetInt(int64(d))
+	case string:
+		f.v.SetString(raw)
+	case int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		f.v.SetInt(int64(n))
+	case bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		f.v.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported setting type %s", f.v.Type())
+	}
+	return nil
+}
+
+// IsBoolFlag lets boolean settings be set with just -name
+func (f fieldValue) IsBoolFlag() bool {
+	return f.v.IsValid() && f.v.Kind() == reflect.Bool
+}
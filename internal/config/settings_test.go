@@ -0,0 +1,173 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadSettings_Defaults(t *testing.T) {
+	settings, opts, err := LoadSettings(flag.NewFlagSet("test", flag.ContinueOnError), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if settings != DefaultSettings() {
+		t.Error("settings without a config file, env or flags differ from the defaults")
+	}
+
+	if opts.ConfigFile != "" || opts.PrintConfig {
+		t.Errorf("unexpected options %+v", opts)
+	}
+}
+
+func TestLoadSettings_Precedence(t *testing.T) {
+	path := writeFile(t, "config.yml", `
+production: false
+server:
+  port: 9000
+  read_timeout: 5s
+database:
+  name: from-file
+  user: from-file
+  host: from-file
+`)
+
+	t.Setenv("GOBOOKING_DB_USER", "from-env")
+	t.Setenv("GOBOOKING_DB_HOST", "from-env")
+
+	args := []string{"-config", path, "-dbhost", "from-flag"}
+	settings, _, err := LoadSettings(flag.NewFlagSet("test", flag.ContinueOnError), args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if settings.InProduction {
+		t.Error("config file did not override the default")
+	}
+
+	if settings.Server.Port != 9000 || settings.Server.ReadTimeout != 5*time.Second {
+		t.Errorf("server settings not read from file: %+v", settings.Server)
+	}
+
+	if settings.Server.WriteTimeout != DefaultSettings().Server.WriteTimeout {
+		t.Error("setting missing from the config file lost its default")
+	}
+
+	if settings.Database.Name != "from-file" {
+		t.Errorf("expected database name from file but got %s", settings.Database.Name)
+	}
+
+	if settings.Database.User != "from-env" {
+		t.Errorf("expected env to override the file but got %s", settings.Database.User)
+	}
+
+	if settings.Database.Host != "from-flag" {
+		t.Errorf("expected flag to override env but got %s", settings.Database.Host)
+	}
+}
+
+func TestLoadSettings_SecretFile(t *testing.T) {
+	path := writeFile(t, "db_password", "s3cret\n")
+	t.Setenv("GOBOOKING_DB_PASSWORD", "ignored")
+	t.Setenv("GOBOOKING_DB_PASSWORD_FILE", path)
+
+	settings, _, err := LoadSettings(flag.NewFlagSet("test", flag.ContinueOnError), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if settings.Database.Password != "s3cret" {
+		t.Errorf("expected password from file but got %q", settings.Database.Password)
+	}
+}
+
+func TestLoadSettings_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+	}{
+		{"unknown-key", nil, []string{"-config", writeFile(t, "config.yml", "databse:\n  name: x\n")}},
+		{"not-yaml", nil, []string{"-config", writeFile(t, "config.toml", "port = 1\n")}},
+		{"missing-file", nil, []string{"-config", "does-not-exist.yml"}},
+		{"bad-env", map[string]string{"GOBOOKING_PORT": "eighty"}, nil},
+		{"bad-flag", nil, []string{"-read-timeout", "soon"}},
+		{"missing-secret-file", map[string]string{"GOBOOKING_SMS_TOKEN_FILE": "does-not-exist"}, nil},
+	}
+
+	for _, e := range tests {
+		t.Run(e.name, func(t *testing.T) {
+			for k, v := range e.env {
+				t.Setenv(k, v)
+			}
+
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(new(strings.Builder))
+
+			_, _, err := LoadSettings(fs, e.args)
+			if err == nil {
+				t.Error("expected an error but got none")
+			}
+		})
+	}
+}
+
+func TestSettings_Validate(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Database.Name = "gobookings"
+	settings.Database.User = "postgres"
+
+	err := settings.Validate()
+	if err != nil {
+		t.Errorf("valid settings failed validation: %v", err)
+	}
+
+	settings.Database.Name = ""
+	settings.Server.Port = 0
+	settings.SMS.Provider = "http"
+	settings.Scheduler.DigestAt = "7am"
+	settings.Log.Format = "xml"
+	settings.Log.Level = "loud"
+	settings.Metrics.Enabled = true
+
+	err = settings.Validate()
+	if err == nil {
+		t.Fatal("invalid settings passed validation")
+	}
+
+	for _, want := range []string{"database name", "server port", "sms provider needs a url", "digest time", "log format", "log level", "metrics need a password"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected a validation error about %s, got: %v", want, err)
+		}
+	}
+}
+
+func TestSettings_Print(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Database.Password = "s3cret"
+
+	out := settings.Print()
+
+	if strings.Contains(out, "s3cret") {
+		t.Error("secret printed in the config")
+	}
+
+	for _, want := range []string{"password: \"[redacted]\"", "read_timeout: 10s", "port: 8080"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in printed config:\n%s", want, out)
+		}
+	}
+}
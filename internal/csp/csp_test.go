@@ -0,0 +1,45 @@
+package csp
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestNewNonce(t *testing.T) {
+	a, b := NewNonce(), NewNonce()
+	if a == "" || a == b {
+		t.Errorf("expected two different nonces, got %q and %q", a, b)
+	}
+}
+
+func TestNonce(t *testing.T) {
+	if Nonce(context.Background()) != "" {
+		t.Error("expected no nonce in an empty context")
+	}
+
+	ctx := WithNonce(context.Background(), "abc")
+	if Nonce(ctx) != "abc" {
+		t.Errorf("expected nonce abc, got %q", Nonce(ctx))
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	policy := Policy("abc", []string{"https://cdn.example.com"})
+
+	for _, directive := range []string{
+		"default-src 'self'",
+		"script-src 'self' 'nonce-abc' https://cdn.example.com",
+		"object-src 'none'",
+		"frame-ancestors 'none'",
+		"report-uri " + ReportPath,
+	} {
+		if !strings.Contains(policy, directive) {
+			t.Errorf("expected %q in policy %s", directive, policy)
+		}
+	}
+
+	if strings.Contains(Policy("abc", nil), "'nonce-abc' ;") {
+		t.Error("expected no trailing space without sources")
+	}
+}
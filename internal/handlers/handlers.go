@@ -1,18 +1,36 @@
 package handlers
 
 import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
+	"github.com/psanodiya94/gobooking.com/internal/calendar"
 	"github.com/psanodiya94/gobooking.com/internal/config"
+	"github.com/psanodiya94/gobooking.com/internal/csp"
 	"github.com/psanodiya94/gobooking.com/internal/driver"
 	"github.com/psanodiya94/gobooking.com/internal/forms"
 	"github.com/psanodiya94/gobooking.com/internal/helpers"
+	"github.com/psanodiya94/gobooking.com/internal/mailer"
+	"github.com/psanodiya94/gobooking.com/internal/metrics"
 	"github.com/psanodiya94/gobooking.com/internal/models"
 	"github.com/psanodiya94/gobooking.com/internal/render"
 	"github.com/psanodiya94/gobooking.com/internal/repository"
 	"github.com/psanodiya94/gobooking.com/internal/repository/dbrepo"
+	"github.com/psanodiya94/gobooking.com/internal/reservationcsv"
+	"github.com/psanodiya94/gobooking.com/internal/sms"
+	"io"
+	"math"
 	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -50,38 +68,57 @@ func NewHandlers(r *Repository) {
 
 // Home is the homepage handler
 func (repo *Repository) Home(w http.ResponseWriter, r *http.Request) {
-	_ = render.Template(w, r, "home.page.tmpl", &models.TemplateData{})
+	err := render.Template(w, r, "home.page.tmpl", &models.TemplateData{})
+	if err != nil {
+		helpers.ServerError(w, r, err)
+	}
 }
 
 // About is the about page handler
 func (repo *Repository) About(w http.ResponseWriter, r *http.Request) {
-	_ = render.Template(w, r, "about.page.tmpl", &models.TemplateData{})
+	err := render.Template(w, r, "about.page.tmpl", &models.TemplateData{})
+	if err != nil {
+		helpers.ServerError(w, r, err)
+	}
 }
 
 // Contact is the contact page handler
 func (repo *Repository) Contact(w http.ResponseWriter, r *http.Request) {
-	_ = render.Template(w, r, "contact.page.tmpl", &models.TemplateData{})
+	err := render.Template(w, r, "contact.page.tmpl", &models.TemplateData{})
+	if err != nil {
+		helpers.ServerError(w, r, err)
+	}
 }
 
 // Majors is the majors page handler
 func (repo *Repository) Majors(w http.ResponseWriter, r *http.Request) {
-	_ = render.Template(w, r, "majors.page.tmpl", &models.TemplateData{})
+	err := render.Template(w, r, "majors.page.tmpl", &models.TemplateData{})
+	if err != nil {
+		helpers.ServerError(w, r, err)
+	}
 }
 
 // Generals is the generals page handler
 func (repo *Repository) Generals(w http.ResponseWriter, r *http.Request) {
-	_ = render.Template(w, r, "generals.page.tmpl", &models.TemplateData{})
+	err := render.Template(w, r, "generals.page.tmpl", &models.TemplateData{})
+	if err != nil {
+		helpers.ServerError(w, r, err)
+	}
 }
 
 // GetAvailability checks the availability of rooms for get request
 func (repo *Repository) GetAvailability(w http.ResponseWriter, r *http.Request) {
-	_ = render.Template(w, r, "search-availability.page.tmpl", &models.TemplateData{})
+	err := render.Template(w, r, "search-availability.page.tmpl", &models.TemplateData{})
+	if err != nil {
+		helpers.ServerError(w, r, err)
+	}
 }
 
 // PostAvailability checks the availability of rooms for post request
 func (repo *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
+		helpers.LogError(r, "can't parse form!", err)
 		repo.App.Session.Put(r.Context(), "error", "can't parse form!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
@@ -94,12 +131,14 @@ func (repo *Repository) PostAvailability(w http.ResponseWriter, r *http.Request)
 	layout := "2006-01-02"
 	checkinDate, err := time.Parse(layout, checkIn)
 	if err != nil {
+		helpers.LogError(r, "can't parse check out date!", err)
 		repo.App.Session.Put(r.Context(), "error", "can't parse check out date!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 	checkoutDate, err := time.Parse(layout, checkOut)
 	if err != nil {
+		helpers.LogError(r, "can't parse check in date!", err)
 		repo.App.Session.Put(r.Context(), "error", "can't parse check in date!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
@@ -107,12 +146,14 @@ func (repo *Repository) PostAvailability(w http.ResponseWriter, r *http.Request)
 
 	rooms, err := repo.DB.SearchAvailabilityForAllRooms(checkinDate, checkoutDate)
 	if err != nil {
+		helpers.LogError(r, "no room available!", err)
 		repo.App.Session.Put(r.Context(), "error", "no room available!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
 	if len(rooms) == 0 {
+		metrics.SearchesNoAvailability.Inc()
 		repo.App.Session.Put(r.Context(), "error", "No availability")
 		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
 		return
@@ -128,9 +169,12 @@ func (repo *Repository) PostAvailability(w http.ResponseWriter, r *http.Request)
 
 	repo.App.Session.Put(r.Context(), "reservation", res)
 
-	_ = render.Template(w, r, "choose-room.page.tmpl", &models.TemplateData{
+	err = render.Template(w, r, "choose-room.page.tmpl", &models.TemplateData{
 		Data: data,
 	})
+	if err != nil {
+		helpers.ServerError(w, r, err)
+	}
 }
 
 type jsonResponse struct {
@@ -145,6 +189,8 @@ type jsonResponse struct {
 func (repo *Repository) JsonAvailability(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
+		helpers.LogError(r, "Can't parse form", err)
+
 		// can't parse form, so return appropriate json
 		resp := jsonResponse{
 			OK:      false,
@@ -163,6 +209,7 @@ func (repo *Repository) JsonAvailability(w http.ResponseWriter, r *http.Request)
 	layout := "2006-01-02"
 	startDate, err := time.Parse(layout, sd)
 	if err != nil {
+		helpers.LogError(r, "Error parsing start date", err)
 		resp := jsonResponse{
 			OK:      false,
 			Message: "Error parsing start date",
@@ -176,6 +223,7 @@ func (repo *Repository) JsonAvailability(w http.ResponseWriter, r *http.Request)
 
 	endDate, err := time.Parse(layout, ed)
 	if err != nil {
+		helpers.LogError(r, "Error parsing end date", err)
 		resp := jsonResponse{
 			OK:      false,
 			Message: "Error parsing end date",
@@ -189,6 +237,7 @@ func (repo *Repository) JsonAvailability(w http.ResponseWriter, r *http.Request)
 
 	roomId, err := strconv.Atoi(r.Form.Get("room_id"))
 	if err != nil {
+		helpers.LogError(r, "Error parsing room id", err)
 		resp := jsonResponse{
 			OK:      false,
 			Message: "Error parsing room id",
@@ -202,6 +251,7 @@ func (repo *Repository) JsonAvailability(w http.ResponseWriter, r *http.Request)
 
 	available, err := repo.DB.SearchAvailabilityForDatesByRoomId(roomId, startDate, endDate)
 	if err != nil {
+		helpers.LogError(r, "Error querying database", err)
 		resp := jsonResponse{
 			OK:      false,
 			Message: "Error querying database",
@@ -213,6 +263,10 @@ func (repo *Repository) JsonAvailability(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if !available {
+		metrics.SearchesNoAvailability.Inc()
+	}
+
 	resp := jsonResponse{
 		OK:        available,
 		Message:   "",
@@ -231,6 +285,7 @@ func (repo *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request) {
 	exploded := strings.Split(r.RequestURI, "/")
 	roomId, err := strconv.Atoi(exploded[2])
 	if err != nil {
+		helpers.LogError(r, "missing url parameter", err)
 		repo.App.Session.Put(r.Context(), "error", "missing url parameter")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
@@ -254,6 +309,7 @@ func (repo *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request) {
 func (repo *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 	roomId, err := strconv.Atoi(r.URL.Query().Get("id"))
 	if err != nil {
+		helpers.LogError(r, "missing url parameter", err)
 		repo.App.Session.Put(r.Context(), "error", "missing url parameter")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
@@ -265,6 +321,7 @@ func (repo *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 	layout := "2006-01-02"
 	startDate, err := time.Parse(layout, sd)
 	if err != nil {
+		helpers.LogError(r, "Can't parse start date", err)
 		repo.App.Session.Put(r.Context(), "error", "Can't parse start date")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
@@ -272,6 +329,7 @@ func (repo *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 
 	endDate, err := time.Parse(layout, ed)
 	if err != nil {
+		helpers.LogError(r, "Can't parse end date", err)
 		repo.App.Session.Put(r.Context(), "error", "Can't parse end date")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
@@ -281,6 +339,7 @@ func (repo *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 
 	room, err := repo.DB.GetRoomById(roomId)
 	if err != nil {
+		helpers.LogError(r, "Can't get room id from database", err)
 		repo.App.Session.Put(r.Context(), "error", "Can't get room id from database")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
@@ -307,6 +366,7 @@ func (repo *Repository) GetReservation(w http.ResponseWriter, r *http.Request) {
 
 	room, err := repo.DB.GetRoomById(res.RoomId)
 	if err != nil {
+		helpers.LogError(r, "Can't find room!", err)
 		repo.App.Session.Put(r.Context(), "error", "Can't find room!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
@@ -326,17 +386,21 @@ func (repo *Repository) GetReservation(w http.ResponseWriter, r *http.Request) {
 	data := make(map[string]interface{})
 	data["reservation"] = res
 
-	_ = render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
+	err = render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
 		Form:      forms.New(nil),
 		Data:      data,
 		StringMap: stringMap,
 	})
+	if err != nil {
+		helpers.ServerError(w, r, err)
+	}
 }
 
 // PostReservation is the reservation page handler for post request
 func (repo *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
+		helpers.LogError(r, "Can't parse form!", err)
 		repo.App.Session.Put(r.Context(), "error", "Can't parse form!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
@@ -349,6 +413,7 @@ func (repo *Repository) PostReservation(w http.ResponseWriter, r *http.Request)
 
 	checkIn, err := time.Parse(layout, sd)
 	if err != nil {
+		helpers.LogError(r, "Can't parse check in date!", err)
 		repo.App.Session.Put(r.Context(), "error", "Can't parse check in date!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
@@ -356,6 +421,7 @@ func (repo *Repository) PostReservation(w http.ResponseWriter, r *http.Request)
 
 	checkOut, err := time.Parse(layout, ed)
 	if err != nil {
+		helpers.LogError(r, "Can't parse check out date!", err)
 		repo.App.Session.Put(r.Context(), "error", "Can't parse check out date!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
@@ -363,6 +429,7 @@ func (repo *Repository) PostReservation(w http.ResponseWriter, r *http.Request)
 
 	roomId, err := strconv.Atoi(r.Form.Get("room_id"))
 	if err != nil {
+		helpers.LogError(r, "Can't parse room id date!", err)
 		repo.App.Session.Put(r.Context(), "error", "Can't parse room id date!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
@@ -370,6 +437,7 @@ func (repo *Repository) PostReservation(w http.ResponseWriter, r *http.Request)
 
 	room, err := repo.DB.GetRoomById(roomId)
 	if err != nil {
+		helpers.LogError(r, fmt.Sprintf("No room available by id : %d", roomId), err)
 		repo.App.Session.Put(r.Context(), "error", fmt.Sprintf("No room available by id : %d", roomId))
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
@@ -384,6 +452,9 @@ func (repo *Repository) PostReservation(w http.ResponseWriter, r *http.Request)
 		CheckOut:  checkOut,
 		RoomId:    roomId,
 		Room:      room,
+		SMSOptIn:  r.Form.Get("sms_opt_in") == "1",
+
+		ConfirmationCode: helpers.ConfirmationCode(),
 	}
 
 	form := forms.New(r.PostForm)
@@ -391,21 +462,40 @@ func (repo *Repository) PostReservation(w http.ResponseWriter, r *http.Request)
 	form.MinLength("first_name", 3)
 	form.IsEmail("email")
 
+	if reservation.SMSOptIn {
+		_, err = sms.NormalizePhone(reservation.Phone, repo.App.SMSCountryCode)
+		if err != nil {
+			form.Errors.Add("phone", "A valid phone number is needed for text messages")
+		}
+	}
+
 	if !form.Valid() {
 		data := make(map[string]interface{})
 		data["reservation"] = reservation
 
 		http.Error(w, "Form is not valid", http.StatusSeeOther)
 
-		_ = render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
+		err = render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
 			Form: form,
 			Data: data,
 		})
+		if err != nil {
+			helpers.ServerError(w, r, err)
+		}
+		return
+	}
+
+	restrictionType, err := repo.DB.GetRestrictionByCode(models.RestrictionReservation)
+	if err != nil {
+		helpers.LogError(r, "Can't find the reservation restriction type!", err)
+		repo.App.Session.Put(r.Context(), "error", "Can't insert reservation into database!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
 	reservationId, err := repo.DB.InsertReservation(reservation)
 	if err != nil {
+		helpers.LogError(r, "Can't insert reservation into database!", err)
 		repo.App.Session.Put(r.Context(), "error", "Can't insert reservation into database!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
@@ -416,49 +506,43 @@ func (repo *Repository) PostReservation(w http.ResponseWriter, r *http.Request)
 		CheckOut:      reservation.CheckOut,
 		RoomId:        reservation.RoomId,
 		ReservationId: reservationId,
-		RestrictionId: 1,
+		RestrictionId: restrictionType.Id,
 	}
 
 	err = repo.DB.InsertRoomRestriction(restriction)
 	if err != nil {
+		helpers.LogError(r, "Can't insert room restriction into database!", err)
 		repo.App.Session.Put(r.Context(), "error", "Can't insert room restriction into database!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	// send notifications - first to guest
-	htmlMessage := fmt.Sprintf(
-		`<strong>Reservation confirmation</strong><br>
-		Dear %s, <br>
-		This is to confirm your reservation from %s to %s.`,
-		reservation.FirstName,
-		reservation.CheckIn.Format("2006-01-02"),
-		reservation.CheckOut.Format("2006-01-02"),
-	)
+	metrics.ReservationsCreated.Inc()
 
+	// send notifications - first to guest
 	repo.App.MailChan <- models.MailData{
 		To:       reservation.Email,
-		From:     "gobookings@mailhog.com",
+		From:     repo.App.MailFrom,
 		Subject:  "Reservation Confirmation",
-		Content:  htmlMessage,
-		Template: "basic.email.html",
+		Template: mailer.ReservationConfirmation,
+		Data:     mailer.ReservationData{Reservation: reservation},
 	}
 
 	// send notifications - property owner
-	ownerMessage := fmt.Sprintf(
-		`<strong>Reservation Notification</strong><br>
-		A reservation has been made for %s from %s to %s.`,
-		reservation.FirstName,
-		reservation.CheckIn.Format("2006-01-02"),
-		reservation.CheckOut.Format("2006-01-02"),
-	)
-
 	repo.App.MailChan <- models.MailData{
-		To:       "gobookings@mailhog.com",
-		From:     "gobookings@mailhog.com",
+		To:       repo.App.OwnerEmail,
+		From:     repo.App.MailFrom,
 		Subject:  "Reservation Notification",
-		Content:  ownerMessage,
-		Template: "basic.email.html",
+		Template: mailer.ReservationNotification,
+		Data:     mailer.ReservationData{Reservation: reservation},
+	}
+
+	if reservation.SMSOptIn {
+		repo.App.SMSChan <- models.SMSData{
+			To:       reservation.Phone,
+			Template: sms.ReservationConfirmation,
+			Data:     mailer.ReservationData{Reservation: reservation},
+		}
 	}
 
 	repo.App.Session.Put(r.Context(), "reservation", reservation)
@@ -486,17 +570,23 @@ func (repo *Repository) ReservationSummary(w http.ResponseWriter, r *http.Reques
 	stringMap["check_in"] = checkIn
 	stringMap["check_out"] = checkOut
 
-	_ = render.Template(w, r, "reservation-summary.page.tmpl", &models.TemplateData{
+	err := render.Template(w, r, "reservation-summary.page.tmpl", &models.TemplateData{
 		Data:      data,
 		StringMap: stringMap,
 	})
+	if err != nil {
+		helpers.ServerError(w, r, err)
+	}
 }
 
 // GetShowLogin displays the login page
 func (repo *Repository) GetShowLogin(w http.ResponseWriter, r *http.Request) {
-	_ = render.Template(w, r, "login.page.tmpl", &models.TemplateData{
+	err := render.Template(w, r, "login.page.tmpl", &models.TemplateData{
 		Form: forms.New(nil),
 	})
+	if err != nil {
+		helpers.ServerError(w, r, err)
+	}
 }
 
 // PostShowLogin is a login handler for post login
@@ -505,6 +595,7 @@ func (repo *Repository) PostShowLogin(w http.ResponseWriter, r *http.Request) {
 
 	err := r.ParseForm()
 	if err != nil {
+		helpers.LogError(r, "Can't parse form", err)
 		repo.App.Session.Put(r.Context(), "error", "Can't parse form")
 		http.Redirect(w, r, "/", http.StatusBadRequest)
 		return
@@ -518,20 +609,26 @@ func (repo *Repository) PostShowLogin(w http.ResponseWriter, r *http.Request) {
 	form.IsEmail("email")
 
 	if !form.Valid() {
-		_ = render.Template(w, r, "login.page.tmpl", &models.TemplateData{
+		err = render.Template(w, r, "login.page.tmpl", &models.TemplateData{
 			Form: form,
 		})
+		if err != nil {
+			helpers.ServerError(w, r, err)
+		}
 		return
 	}
 
 	id, _, err := repo.DB.Authenticate(email, password)
 	if err != nil {
+		helpers.LogError(r, "Invalid login credentials", err)
 		repo.App.Session.Put(r.Context(), "error", "Invalid login credentials")
 		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 		return
 	}
 
 	repo.App.Session.Put(r.Context(), "user_id", id)
+	repo.App.Session.Put(r.Context(), "user_agent", r.UserAgent())
+	repo.App.Session.Put(r.Context(), "logged_in_at", time.Now())
 	repo.App.Session.Put(r.Context(), "flash", "Login successful")
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -545,367 +642,2154 @@ func (repo *Repository) GetLogout(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 }
 
-// GetAdminDashboard displays the admin dashboard
-func (repo *Repository) GetAdminDashboard(w http.ResponseWriter, r *http.Request) {
-	_ = render.Template(w, r, "admin-dashboard.page.tmpl", &models.TemplateData{
-		Form: forms.New(nil),
-	})
+// the days ahead the dashboard shows occupancy for, the first also for revenue
+const (
+	dashboardShortDays = 30
+	dashboardLongDays  = 90
+)
+
+// dashboard is what the admin dashboard shows
+type dashboard struct {
+	Date  time.Time
+	Stats models.DashboardStats
+	// Revenue is over the next dashboardShortDays nights
+	Revenue models.Revenue
+	// Occupancy is for each of the next dashboardLongDays days
+	Occupancy []models.Occupancy
+	// ShortOccupancy and LongOccupancy are the percent of room nights
+	// occupied over the next dashboardShortDays and dashboardLongDays
+	ShortOccupancy int
+	LongOccupancy  int
 }
 
-// GetAdminAllReservations displays the admin all reservations
-func (repo *Repository) GetAdminAllReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := repo.DB.AllReservations()
+// dashboard gathers the figures for the admin dashboard on today
+func (repo *Repository) dashboard(today time.Time) (dashboard, error) {
+	d := dashboard{Date: today}
+
+	var err error
+	d.Stats, err = repo.DB.DashboardStats(today)
 	if err != nil {
-		helpers.ServerError(w, err)
-		return
+		return d, err
 	}
 
-	data := make(map[string]interface{})
-	data["reservations"] = reservations
+	d.Revenue, err = repo.DB.RevenueByDate(today, today.AddDate(0, 0, dashboardShortDays))
+	if err != nil {
+		return d, err
+	}
 
-	_ = render.Template(w, r, "admin-all-reservations.page.tmpl", &models.TemplateData{
-		Data: data,
-	})
+	d.Occupancy, err = repo.DB.OccupancyByDate(today, today.AddDate(0, 0, dashboardLongDays-1))
+	if err != nil {
+		return d, err
+	}
+
+	d.ShortOccupancy = occupancyPercent(d.Occupancy[:min(dashboardShortDays, len(d.Occupancy))])
+	d.LongOccupancy = occupancyPercent(d.Occupancy)
+
+	return d, nil
 }
 
-// GetAdminNewReservations displays the admin new reservations
-func (repo *Repository) GetAdminNewReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := repo.DB.AllReservations()
+// occupancyPercent returns the percent of room nights occupied over days
+func occupancyPercent(days []models.Occupancy) int {
+	var total models.Occupancy
+	for _, o := range days {
+		total.Occupied += o.Occupied
+		total.Rooms += o.Rooms
+	}
+	return total.Percent()
+}
+
+// GetAdminDashboard displays the admin dashboard
+func (repo *Repository) GetAdminDashboard(w http.ResponseWriter, r *http.Request) {
+	d, err := repo.dashboard(repo.today())
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
+	intMap := make(map[string]int)
+	intMap["short_days"] = dashboardShortDays
+	intMap["long_days"] = dashboardLongDays
+
 	data := make(map[string]interface{})
-	data["reservations"] = reservations
+	data["dashboard"] = d
 
-	_ = render.Template(w, r, "admin-new-reservations.page.tmpl", &models.TemplateData{
-		Data: data,
+	err = render.Template(w, r, "admin-dashboard.page.tmpl", &models.TemplateData{
+		IntMap: intMap,
+		Data:   data,
+		Form:   forms.New(nil),
 	})
+	if err != nil {
+		helpers.ServerError(w, r, err)
+	}
 }
 
-// GetAdminShowReservation displays the admin show reservation
-func (repo *Repository) GetAdminShowReservation(w http.ResponseWriter, r *http.Request) {
-	exploded := strings.Split(r.RequestURI, "/")
-	id, err := strconv.Atoi(exploded[4])
+// leadTimeLabels name the buckets of models.DashboardStats.LeadTimes
+var leadTimeLabels = [4]string{"Under a week", "1 to 4 weeks", "1 to 3 months", "3 months or more"}
+
+// dashboardJSON is the admin dashboard's figures, for its charts
+type dashboardJSON struct {
+	Date                string          `json:"date"`
+	ArrivalsToday       int             `json:"arrivals_today"`
+	DeparturesToday     int             `json:"departures_today"`
+	NewReservations     int             `json:"new_reservations"`
+	Bookings            int             `json:"bookings_30_days"`
+	Cancellations       int             `json:"cancellations_30_days"`
+	CancellationPercent int             `json:"cancellation_percent"`
+	LeadTimeDays        float64         `json:"lead_time_days"`
+	LeadTimes           []countJSON     `json:"lead_times"`
+	Occupancy30         int             `json:"occupancy_30_days"`
+	Occupancy90         int             `json:"occupancy_90_days"`
+	Occupancy           []occupancyJSON `json:"occupancy"`
+	// ADR and RevPAR are over the next 30 nights, null if no room has a rate
+	ADR    *float64 `json:"adr"`
+	RevPAR *float64 `json:"revpar"`
+}
+
+// countJSON is a labelled count in a chart
+type countJSON struct {
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+// occupancyJSON is the occupancy of a day
+type occupancyJSON struct {
+	Date     string `json:"date"`
+	Occupied int    `json:"occupied"`
+	Rooms    int    `json:"rooms"`
+	Percent  int    `json:"percent"`
+}
+
+// GetAdminDashboardJSON returns the admin dashboard's figures as json
+func (repo *Repository) GetAdminDashboardJSON(w http.ResponseWriter, r *http.Request) {
+	d, err := repo.dashboard(repo.today())
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.LogError(r, "Can't get dashboard", err)
+		writeJSON(w, http.StatusInternalServerError, jsonResponse{OK: false, Message: "Internal server error"})
 		return
 	}
 
-	src := exploded[3]
+	resp := dashboardJSON{
+		Date:                d.Date.Format("2006-01-02"),
+		ArrivalsToday:       d.Stats.ArrivalsToday,
+		DeparturesToday:     d.Stats.DeparturesToday,
+		NewReservations:     d.Stats.NewReservations,
+		Bookings:            d.Stats.Bookings,
+		Cancellations:       d.Stats.Cancellations,
+		CancellationPercent: d.Stats.CancellationPercent(),
+		LeadTimeDays:        math.Round(d.Stats.LeadTimeDays*10) / 10,
+		LeadTimes:           make([]countJSON, 0, len(leadTimeLabels)),
+		Occupancy30:         d.ShortOccupancy,
+		Occupancy90:         d.LongOccupancy,
+		Occupancy:           make([]occupancyJSON, 0, len(d.Occupancy)),
+	}
 
-	year := r.URL.Query().Get("y")
-	month := r.URL.Query().Get("m")
+	for i, label := range leadTimeLabels {
+		resp.LeadTimes = append(resp.LeadTimes, countJSON{Label: label, Count: d.Stats.LeadTimes[i]})
+	}
 
-	stringMap := make(map[string]string)
-	stringMap["src"] = src
-	stringMap["year"] = year
-	stringMap["month"] = month
+	for _, o := range d.Occupancy {
+		resp.Occupancy = append(resp.Occupancy, occupancyJSON{
+			Date:     o.Date.Format("2006-01-02"),
+			Occupied: o.Occupied,
+			Rooms:    o.Rooms,
+			Percent:  o.Percent(),
+		})
+	}
 
-	// get reservation by id
-	res, err := repo.DB.GetReservationById(id)
-	if err != nil {
-		helpers.ServerError(w, err)
-		return
+	if d.Revenue.Rated() {
+		adr := math.Round(d.Revenue.ADR()*100) / 100
+		revpar := math.Round(d.Revenue.RevPAR()*100) / 100
+		resp.ADR = &adr
+		resp.RevPAR = &revpar
 	}
 
-	data := make(map[string]interface{})
-	data["reservations"] = res
+	writeJSON(w, http.StatusOK, resp)
+}
 
-	_ = render.Template(w, r, "admin-show-reservation.page.tmpl", &models.TemplateData{
-		Data:      data,
-		StringMap: stringMap,
-		Form:      forms.New(nil),
-	})
+// GetAdminAllReservations displays a page of all reservations
+func (repo *Repository) GetAdminAllReservations(w http.ResponseWriter, r *http.Request) {
+	repo.renderReservationList(w, r, "all", "")
 }
 
-// PostAdminShowReservation is the admin show reservation handler for post request
-func (repo *Repository) PostAdminShowReservation(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+// GetAdminNewReservations displays a page of the reservations not yet processed
+func (repo *Repository) GetAdminNewReservations(w http.ResponseWriter, r *http.Request) {
+	repo.renderReservationList(w, r, "new", models.StatusNew)
+}
+
+// reservation list page sizes, the first is the default
+var pageSizes = []int{25, 10, 50, 100}
+
+// pager links the pages of a list
+type pager struct {
+	Page    int
+	Pages   int
+	Total   int
+	PerPage int
+	// Prev and Next are the urls of the neighbouring pages, empty at the ends
+	Prev string
+	Next string
+}
+
+// renderReservationList shows the reservations list src, limited to status
+// if it is not empty
+func (repo *Repository) renderReservationList(w http.ResponseWriter, r *http.Request, src, status string) {
+	filter, err := reservationFilter(r)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ClientError(w, r, http.StatusBadRequest)
 		return
 	}
+	if status != "" {
+		filter.Status = status
+	}
 
-	exploded := strings.Split(r.RequestURI, "/")
-	id, err := strconv.Atoi(exploded[4])
+	reservations, total, err := repo.DB.FilterReservations(filter)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	src := exploded[3]
-
-	stringMap := make(map[string]string)
-	stringMap["src"] = src
-
-	// get reservation by id
-	res, err := repo.DB.GetReservationById(id)
+	rooms, err := repo.DB.AllRooms()
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	res.FirstName = r.Form.Get("first_name")
-	res.LastName = r.Form.Get("last_name")
-	res.Email = r.Form.Get("email")
-	res.Phone = r.Form.Get("phone")
+	pages := max((total+filter.PerPage-1)/filter.PerPage, 1)
+	p := pager{Page: filter.Page, Pages: pages, Total: total, PerPage: filter.PerPage}
+	if filter.Page > 1 {
+		p.Prev = listURL(r, "page", strconv.Itoa(filter.Page-1))
+	}
+	if filter.Page < pages {
+		p.Next = listURL(r, "page", strconv.Itoa(filter.Page+1))
+	}
 
-	err = repo.DB.UpdateReservation(res)
-	if err != nil {
-		helpers.ServerError(w, err)
-		return
+	// each column header sorts by it, or reverses the order if it already does
+	sorts := make(map[string]string)
+	for _, key := range []string{models.SortArrival, models.SortCreated, models.SortName} {
+		dir := "asc"
+		if filter.Sort == key && !filter.Desc {
+			dir = "desc"
+		}
+		sorts[key] = listURL(r, "sort", key, "dir", dir, "page", "1")
 	}
 
-	year := r.Form.Get("year")
-	month := r.Form.Get("month")
+	// the csv export takes the list's filters and order, but not its page
+	csvQuery := r.URL.Query()
+	csvQuery.Del("page")
+	csvQuery.Del("per_page")
+	if status != "" {
+		csvQuery.Set("status", status)
+	}
 
-	repo.App.Session.Put(r.Context(), "flash", "Changes saved")
+	stringMap := make(map[string]string)
+	stringMap["src"] = src
+	stringMap["csv_url"] = "/admin/reservations-csv?" + csvQuery.Encode()
+	stringMap["sort"] = filter.Sort
+	stringMap["dir"] = "asc"
+	if filter.Desc {
+		stringMap["dir"] = "desc"
+	}
 
-	if year == "" {
-		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
-	} else {
-		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+	data := make(map[string]interface{})
+	data["reservations"] = reservations
+	data["rooms"] = rooms
+	data["pager"] = p
+	data["sorts"] = sorts
+	data["page_sizes"] = pageSizes
+	data["sources"] = models.Sources
+	data["filter"] = filter
+
+	err = render.Template(w, r, fmt.Sprintf("admin-%s-reservations.page.tmpl", src), &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      forms.New(r.URL.Query()),
+	})
+	if err != nil {
+		helpers.ServerError(w, r, err)
 	}
 }
 
-// GetAdminProcessReservation is the admin process reservation handler for get request
-func (repo *Repository) GetAdminProcessReservation(w http.ResponseWriter, r *http.Request) {
-	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+// reservationJSON is a reservation in the reservations feed
+type reservationJSON struct {
+	Id        int    `json:"id"`
+	Code      string `json:"confirmation_code"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+	CheckIn   string `json:"check_in"`
+	CheckOut  string `json:"check_out"`
+	RoomId    int    `json:"room_id"`
+	RoomName  string `json:"room_name"`
+	Processed bool   `json:"processed"`
+	Source    string `json:"source"`
+	CreatedAt string `json:"created_at"`
+}
+
+// reservationsPage is a page of the reservations feed
+type reservationsPage struct {
+	Reservations []reservationJSON `json:"reservations"`
+	Page         int               `json:"page"`
+	PerPage      int               `json:"per_page"`
+	Pages        int               `json:"pages"`
+	Total        int               `json:"total"`
+}
+
+// GetAdminReservationsJSON returns a page of reservations as json, taking the
+// same filters as the reservation lists
+func (repo *Repository) GetAdminReservationsJSON(w http.ResponseWriter, r *http.Request) {
+	filter, err := reservationFilter(r)
 	if err != nil {
-		helpers.ServerError(w, err)
+		writeJSON(w, http.StatusBadRequest, jsonResponse{OK: false, Message: err.Error()})
 		return
 	}
 
-	src := chi.URLParam(r, "src")
-
-	err = repo.DB.UpdateProcessedForReservation(id, 1)
+	reservations, total, err := repo.DB.FilterReservations(filter)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.LogError(r, "Can't get reservations", err)
+		writeJSON(w, http.StatusInternalServerError, jsonResponse{OK: false, Message: "Internal server error"})
 		return
 	}
 
-	year := r.URL.Query().Get("y")
-	month := r.URL.Query().Get("m")
-
-	repo.App.Session.Put(r.Context(), "flash", "Reservation marked as processed")
-
-	if year == "" {
-		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
-	} else {
-		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+	page := reservationsPage{
+		Reservations: make([]reservationJSON, 0, len(reservations)),
+		Page:         filter.Page,
+		PerPage:      filter.PerPage,
+		Pages:        max((total+filter.PerPage-1)/filter.PerPage, 1),
+		Total:        total,
+	}
+	for _, x := range reservations {
+		page.Reservations = append(page.Reservations, reservationJSON{
+			Id:        x.Id,
+			Code:      x.ConfirmationCode,
+			FirstName: x.FirstName,
+			LastName:  x.LastName,
+			Email:     x.Email,
+			Phone:     x.Phone,
+			CheckIn:   x.CheckIn.Format("2006-01-02"),
+			CheckOut:  x.CheckOut.Format("2006-01-02"),
+			RoomId:    x.RoomId,
+			RoomName:  x.Room.RoomName,
+			Processed: x.Processed == 1,
+			Source:    x.Source,
+			CreatedAt: x.CreatedAt.Format(time.RFC3339),
+		})
 	}
+
+	writeJSON(w, http.StatusOK, page)
 }
 
-// GetAdminDeleteReservation is the admin delete reservation handler for get request
-func (repo *Repository) GetAdminDeleteReservation(w http.ResponseWriter, r *http.Request) {
-	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+// GetAdminReservationsCSV downloads the reservations matching the list
+// filters as csv, all of them rather than a page
+func (repo *Repository) GetAdminReservationsCSV(w http.ResponseWriter, r *http.Request) {
+	filter, err := reservationFilter(r)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ClientError(w, r, http.StatusBadRequest)
 		return
 	}
+	filter.Page = 1
+	filter.PerPage = 0
 
-	src := chi.URLParam(r, "src")
-
-	err = repo.DB.DeleteReservation(id)
+	reservations, _, err := repo.DB.FilterReservations(filter)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	year := r.URL.Query().Get("y")
-	month := r.URL.Query().Get("m")
+	name := fmt.Sprintf("reservations-%s.csv", repo.today().Format("2006-01-02"))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
 
-	repo.App.Session.Put(r.Context(), "flash", "Reservation Deleted")
+	err = reservationcsv.Write(w, reservations)
+	if err != nil {
+		helpers.LogError(r, "Can't write reservations csv", err)
+	}
+}
 
-	if year == "" {
-		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
-	} else {
-		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+// the largest csv file and the most rows that can be imported at once
+const (
+	importMaxBytes = 1 << 20
+	importMaxRows  = 1000
+)
+
+// GetAdminImportReservations displays the form to import reservations from csv
+func (repo *Repository) GetAdminImportReservations(w http.ResponseWriter, r *http.Request) {
+	err := render.Template(w, r, "admin-import-reservations.page.tmpl", &models.TemplateData{
+		Data: make(map[string]interface{}),
+		Form: forms.New(nil),
+	})
+	if err != nil {
+		helpers.ServerError(w, r, err)
 	}
 }
 
-// GetAdminReservationsCalendar displays the admin reservations calendar
-func (repo *Repository) GetAdminReservationsCalendar(w http.ResponseWriter, r *http.Request) {
-	// assume there is no month/year specified
-	now := time.Now()
+// PostAdminImportReservations checks an uploaded csv file and shows what
+// importing it would do. Once every row is valid it can be posted back with
+// action import, which checks it again and imports all the rows or none.
+func (repo *Repository) PostAdminImportReservations(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, importMaxBytes+64<<10)
+	err := r.ParseMultipartForm(importMaxBytes)
+	if errors.Is(err, http.ErrNotMultipart) {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
 
-	if r.URL.Query().Get("y") != "" {
-		year, err := strconv.Atoi(r.URL.Query().Get("y"))
+	form := forms.New(r.PostForm)
+
+	// the preview posts the csv back in a field, a fresh import uploads it
+	content := r.Form.Get("csv")
+	if file, _, err := r.FormFile("file"); err == nil {
+		b, err := io.ReadAll(io.LimitReader(file, importMaxBytes+1))
+		_ = file.Close()
 		if err != nil {
-			helpers.ServerError(w, err)
+			helpers.ServerError(w, r, err)
 			return
 		}
+		content = string(b)
+	}
 
-		month, err := strconv.Atoi(r.URL.Query().Get("m"))
+	var rows []reservationcsv.Row
+	switch {
+	case strings.TrimSpace(content) == "":
+		form.Errors.Add("file", "Choose a csv file to import")
+	case len(content) > importMaxBytes:
+		form.Errors.Add("file", fmt.Sprintf("The file is larger than %d KB", importMaxBytes>>10))
+	default:
+		rows, err = reservationcsv.Read(strings.NewReader(content), importMaxRows)
 		if err != nil {
-			helpers.ServerError(w, err)
-			return
+			form.Errors.Add("file", fmt.Sprintf("Can't read the file: %s", err))
 		}
+	}
 
-		now = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	if form.Valid() {
+		err = repo.checkImport(rows)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
 	}
 
-	data := make(map[string]interface{})
-	data["now"] = now
+	valid := form.Valid()
+	for _, row := range rows {
+		if !row.Valid() {
+			valid = false
+		}
+	}
 
-	next := now.AddDate(0, 1, 0)
-	last := now.AddDate(0, -1, 0)
+	if valid && r.Form.Get("action") == "import" {
+		reservations := make([]models.Reservation, 0, len(rows))
+		for _, row := range rows {
+			if row.Reservation.ConfirmationCode == "" {
+				row.Reservation.ConfirmationCode = helpers.ConfirmationCode()
+			}
+			reservations = append(reservations, row.Reservation)
+		}
 
-	nextMonth := next.Format("01")
-	nextMonthYear := next.Format("2006")
+		err = repo.DB.ImportReservations(reservations)
+		if err == nil {
+			repo.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Imported %d reservations", len(reservations)))
+			http.Redirect(w, r, "/admin/reservations-all?source="+models.SourceImport, http.StatusSeeOther)
+			return
+		}
+		switch {
+		case errors.Is(err, repository.ErrConflict):
+			repo.App.Session.Put(r.Context(), "error", "Nothing was imported: a room was booked or a confirmation code used since the preview")
+		case errors.Is(err, repository.ErrUnknownRestriction):
+			repo.App.Session.Put(r.Context(), "error", "Nothing was imported: there is no reservation restriction type")
+		default:
+			helpers.ServerError(w, r, err)
+			return
+		}
+	}
 
-	lastMonth := last.Format("01")
-	lastMonthYear := last.Format("2006")
+	data := make(map[string]interface{})
+	data["rows"] = rows
+	data["valid"] = valid
 
 	stringMap := make(map[string]string)
-	stringMap["next_month"] = nextMonth
-	stringMap["next_month_year"] = nextMonthYear
-	stringMap["last_month"] = lastMonth
-	stringMap["last_month_year"] = lastMonthYear
-
-	stringMap["this_month"] = now.Format("01")
-	stringMap["this_month_year"] = now.Format("2006")
-
-	// get the first and last days of the month
-	currentYear, currentMonth, _ := now.Date()
-	currentLocation := now.Location()
-	firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, currentLocation)
-	lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
+	stringMap["csv"] = content
 
-	intMap := make(map[string]int)
-	intMap["days_in_month"] = lastOfMonth.Day()
+	err = render.Template(w, r, "admin-import-reservations.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      form,
+	})
+	if err != nil {
+		helpers.ServerError(w, r, err)
+	}
+}
 
+// checkImport finds the rooms of the rows of an import and records an error on
+// each row whose room doesn't exist, is already booked, or is booked by an
+// earlier row of the import
+func (repo *Repository) checkImport(rows []reservationcsv.Row) error {
 	rooms, err := repo.DB.AllRooms()
 	if err != nil {
-		helpers.ServerError(w, err)
-		return
+		return err
 	}
 
-	// get all reservations
-	data["rooms"] = rooms
-
-	for _, x := range rooms {
-		reservationMap := make(map[string]int)
-		blockMap := make(map[string]int)
+	for i := range rows {
+		row := &rows[i]
+		res := &row.Reservation
 
-		for d := firstOfMonth; d.After(lastOfMonth) == false; d = d.AddDate(0, 0, 1) {
-			reservationMap[d.Format("2006-01-2")] = 0
-			blockMap[d.Format("2006-01-2")] = 0
+		for _, other := range rows[:i] {
+			if res.ConfirmationCode != "" && other.Reservation.ConfirmationCode == res.ConfirmationCode {
+				row.Error("confirmation_code is also on line %d", other.Line)
+			}
 		}
 
-		// get all the restrictions for the current room
-		restrictions, err := repo.DB.GetRestrictionsForRoomByDate(x.Id, firstOfMonth, lastOfMonth)
-		if err != nil {
-			helpers.ServerError(w, err)
-			return
+		for _, room := range rooms {
+			if res.RoomId == room.Id || (res.RoomId == 0 && strings.EqualFold(row.RoomName, room.RoomName)) {
+				res.RoomId = room.Id
+				res.Room = room
+			}
 		}
 
-		for _, y := range restrictions {
-			if y.ReservationId > 0 {
-				// it's a reservation
-				for d := y.CheckIn; d.After(y.CheckOut) == false; d = d.AddDate(0, 0, 1) {
-					reservationMap[d.Format("2006-01-2")] = y.ReservationId
-				}
-			} else {
-				// it's a block
-				blockMap[y.CheckIn.Format("2006-01-2")] = y.Id
+		if res.Room.Id == 0 {
+			if res.RoomId != 0 || row.RoomName != "" {
+				row.Error("no room %s", cmp.Or(row.RoomName, strconv.Itoa(res.RoomId)))
 			}
+			continue
 		}
+		if row.RoomName != "" && !strings.EqualFold(row.RoomName, res.Room.RoomName) {
+			row.Error("room_id %d is %s, not %s", res.RoomId, res.Room.RoomName, row.RoomName)
+		}
+		if res.CheckIn.IsZero() || !res.CheckOut.After(res.CheckIn) {
+			continue
+		}
+
+		for _, other := range rows[:i] {
+			if other.Reservation.RoomId == res.RoomId && other.Reservation.CheckIn.Before(res.CheckOut) && other.Reservation.CheckOut.After(res.CheckIn) {
+				row.Error("overlaps line %d", other.Line)
+			}
+		}
+
+		available, err := repo.DB.SearchAvailabilityForDatesByRoomId(res.RoomId, res.CheckIn, res.CheckOut)
+		if err != nil {
+			return err
+		}
+		if !available {
+			row.Error("%s is not available for these dates", res.Room.RoomName)
+		}
+	}
+
+	return nil
+}
+
+// frontDeskReport is a front desk report of the guests for a day
+type frontDeskReport struct {
+	// Name is the report's name in its url
+	Name  string
+	Title string
+}
+
+// frontDeskReports are the front desk reports, in the order of their tabs
+var frontDeskReports = []frontDeskReport{
+	{"arrivals", "Arrivals"},
+	{"departures", "Departures"},
+	{"in-house", "In House"},
+}
 
-		data[fmt.Sprintf("reservation_map_%d", x.Id)] = reservationMap
-		data[fmt.Sprintf("block_map_%d", x.Id)] = blockMap
+// reservationsForReport returns the reservations in the front desk report
+// name for date, and false if there is no such report
+func (repo *Repository) reservationsForReport(name string, date time.Time) ([]models.Reservation, bool, error) {
+	var reservations []models.Reservation
+	var err error
+
+	switch name {
+	case "arrivals":
+		reservations, err = repo.DB.ReservationsByCheckIn(date, date)
+	case "departures":
+		reservations, err = repo.DB.ReservationsByCheckOut(date, date)
+	case "in-house":
+		reservations, err = repo.DB.InHouseReservations(date)
+	default:
+		return nil, false, nil
+	}
+
+	return reservations, true, err
+}
+
+// reportDate reads the day of a front desk report, today if it is not given
+func (repo *Repository) reportDate(v string) (time.Time, error) {
+	if v == "" {
+		return repo.today(), nil
+	}
+	return time.Parse("2006-01-02", v)
+}
+
+// GetAdminReport displays a front desk report of the guests arriving,
+// departing or staying on a day
+func (repo *Repository) GetAdminReport(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "report")
+
+	date, err := repo.reportDate(r.URL.Query().Get("date"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	reservations, ok, err := repo.reservationsForReport(name, date)
+	if !ok {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
 
-		repo.App.Session.Put(r.Context(), fmt.Sprintf("block_map_%d", x.Id), blockMap)
+	stringMap := make(map[string]string)
+	stringMap["report"] = name
+	stringMap["date"] = date.Format("2006-01-02")
+	stringMap["prev"] = date.AddDate(0, 0, -1).Format("2006-01-02")
+	stringMap["next"] = date.AddDate(0, 0, 1).Format("2006-01-02")
+	for _, report := range frontDeskReports {
+		if report.Name == name {
+			stringMap["title"] = report.Title
+		}
 	}
 
-	_ = render.Template(w, r, "admin-reservations-calendar.page.tmpl", &models.TemplateData{
+	data := make(map[string]interface{})
+	data["reservations"] = reservations
+	data["reports"] = frontDeskReports
+	data["date"] = date
+
+	err = render.Template(w, r, "admin-report.page.tmpl", &models.TemplateData{
 		StringMap: stringMap,
-		IntMap:    intMap,
 		Data:      data,
+		Form:      forms.New(nil),
 	})
+	if err != nil {
+		helpers.ServerError(w, r, err)
+	}
 }
 
-// PostAdminReservationsCalendar displays the admin show reservation calendar
-func (repo *Repository) PostAdminReservationsCalendar(w http.ResponseWriter, r *http.Request) {
+// GetAdminReportCSV downloads a front desk report as csv
+func (repo *Repository) GetAdminReportCSV(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "report")
+
+	date, err := repo.reportDate(r.URL.Query().Get("date"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	reservations, ok, err := repo.reservationsForReport(name, date)
+	if !ok {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%s.csv", name, date.Format("2006-01-02"))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	err = reservationcsv.Write(w, reservations)
+	if err != nil {
+		helpers.LogError(r, "Can't write report csv", err)
+	}
+}
+
+// PostAdminCheckIn checks in the guest of a reservation from a front desk report
+func (repo *Repository) PostAdminCheckIn(w http.ResponseWriter, r *http.Request) {
+	repo.frontDeskAction(w, r, repo.DB.CheckInReservation, "checked in")
+}
+
+// PostAdminCheckOut checks out the guest of a reservation from a front desk report
+func (repo *Repository) PostAdminCheckOut(w http.ResponseWriter, r *http.Request) {
+	repo.frontDeskAction(w, r, repo.DB.CheckOutReservation, "checked out")
+}
+
+// frontDeskAction records a check in or out with update and returns to the
+// report it was made from
+func (repo *Repository) frontDeskAction(w http.ResponseWriter, r *http.Request, update func(int, time.Time) error, done string) {
 	err := r.ParseForm()
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	year, err := strconv.Atoi(r.Form.Get("y"))
+	name := chi.URLParam(r, "report")
+	if !slices.ContainsFunc(frontDeskReports, func(report frontDeskReport) bool { return report.Name == name }) {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ClientError(w, r, http.StatusNotFound)
 		return
 	}
 
-	month, err := strconv.Atoi(r.Form.Get("m"))
+	date, err := repo.reportDate(r.Form.Get("date"))
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ClientError(w, r, http.StatusBadRequest)
 		return
 	}
 
-	rooms, err := repo.DB.AllRooms()
+	reportURL := fmt.Sprintf("/admin/reports/%s?date=%s", name, date.Format("2006-01-02"))
+
+	err = update(id, time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, repository.ErrConflict) {
+		repo.App.Session.Put(r.Context(), "error", "The guest can't be checked out before they have checked in")
+		http.Redirect(w, r, reportURL, http.StatusSeeOther)
+		return
+	}
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	form := forms.New(r.PostForm)
+	repo.App.Session.Put(r.Context(), "flash", "Guest "+done)
+	http.Redirect(w, r, reportURL, http.StatusSeeOther)
+}
+
+// the most reservations shown for a search, and the shortest query searched for
+const (
+	searchLimit     = 50
+	searchMinLength = 2
+)
 
-	for _, x := range rooms {
-		// Get the block map from the session
-		blockMap := repo.App.Session.Get(r.Context(), fmt.Sprintf("block_map_%d", x.Id)).(map[string]int)
-
-		// Loop through the block map
-		for key, value := range blockMap {
-			// ok will be false if the value is not in the map
-			if val, ok := blockMap[key]; ok {
-				// Only work on the values > 0, and that are not in the form post
-				// The rest are the blocks we have
-				if val > 0 {
-					if !form.Has(fmt.Sprintf("remove_block_%d_%s", x.Id, key)) {
-						// delete the restriction by id
-						err := repo.DB.DeleteBlockById(value)
-						if err != nil {
-							helpers.ServerError(w, err)
-							return
-						}
-					}
-				}
+// GetAdminSearch finds reservations by guest name, email, phone or
+// confirmation code, split into stays that are still to come or under way
+// and stays that are over
+func (repo *Repository) GetAdminSearch(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	var upcoming, past []models.Reservation
+	if len([]rune(q)) >= searchMinLength {
+		reservations, err := repo.DB.SearchReservations(q, searchLimit)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+
+		today := repo.today()
+		for _, x := range reservations {
+			if x.CheckOut.Before(today) {
+				past = append(past, x)
+			} else {
+				upcoming = append(upcoming, x)
 			}
 		}
 	}
 
-	// handle new blocks
-	for name, _ := range r.PostForm {
-		if strings.HasPrefix(name, "add_block") {
-			exploded := strings.Split(name, "_")
-			roomId, err := strconv.Atoi(exploded[2])
-			if err != nil {
-				helpers.ServerError(w, err)
-				return
-			}
+	stringMap := make(map[string]string)
+	stringMap["q"] = q
 
-			// get the date from the form
-			startDate, err := time.Parse("2006-01-2", exploded[3])
-			if err != nil {
-				helpers.ServerError(w, err)
-				return
-			}
+	data := make(map[string]interface{})
+	data["upcoming"] = upcoming
+	data["past"] = past
+	data["searched"] = len([]rune(q)) >= searchMinLength
+	data["limited"] = len(upcoming)+len(past) == searchLimit
 
-			// insert a new block
-			err = repo.DB.InsertBlockForRoom(roomId, startDate)
-			if err != nil {
-				helpers.ServerError(w, err)
-				return
-			}
+	err := render.Template(w, r, "admin-search.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+	})
+	if err != nil {
+		helpers.ServerError(w, r, err)
+	}
+}
+
+// reservationFilter reads a reservation list's page, order and filters from
+// the query string
+func reservationFilter(r *http.Request) (models.ReservationFilter, error) {
+	query := r.URL.Query()
+	filter := models.ReservationFilter{
+		Page:    1,
+		PerPage: pageSizes[0],
+		Sort:    models.SortArrival,
+		Status:  query.Get("status"),
+		Source:  query.Get("source"),
+	}
+
+	var err error
+	if v := query.Get("page"); v != "" {
+		filter.Page, err = strconv.Atoi(v)
+		if err != nil || filter.Page < 1 {
+			return filter, fmt.Errorf("invalid page %q", v)
+		}
+	}
+
+	if v := query.Get("per_page"); v != "" {
+		filter.PerPage, err = strconv.Atoi(v)
+		if err != nil || !slices.Contains(pageSizes, filter.PerPage) {
+			return filter, fmt.Errorf("per_page must be one of %v", pageSizes)
+		}
+	}
+
+	if v := query.Get("sort"); v != "" {
+		if v != models.SortArrival && v != models.SortCreated && v != models.SortName {
+			return filter, fmt.Errorf("can't sort by %q", v)
+		}
+		filter.Sort = v
+	}
+
+	switch query.Get("dir") {
+	case "", "asc":
+	case "desc":
+		filter.Desc = true
+	default:
+		return filter, fmt.Errorf("invalid sort direction %q", query.Get("dir"))
+	}
+
+	if v := query.Get("from"); v != "" {
+		filter.From, err = time.Parse("2006-01-02", v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid from date %q", v)
+		}
+	}
+
+	if v := query.Get("to"); v != "" {
+		filter.To, err = time.Parse("2006-01-02", v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid to date %q", v)
+		}
+	}
+
+	if v := query.Get("room"); v != "" {
+		filter.RoomId, err = strconv.Atoi(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid room %q", v)
 		}
 	}
 
+	if filter.Status != "" && filter.Status != models.StatusNew && filter.Status != models.StatusProcessed {
+		return filter, fmt.Errorf("invalid status %q", filter.Status)
+	}
+
+	return filter, nil
+}
+
+// listURL returns the url of the request with the query string values in
+// pairs changed
+func listURL(r *http.Request, pairs ...string) string {
+	query := r.URL.Query()
+	for i := 0; i+1 < len(pairs); i += 2 {
+		query.Set(pairs[i], pairs[i+1])
+	}
+
+	return r.URL.Path + "?" + query.Encode()
+}
+
+// GetAdminShowReservation displays the admin show reservation
+func (repo *Repository) GetAdminShowReservation(w http.ResponseWriter, r *http.Request) {
+	exploded := strings.Split(r.RequestURI, "/")
+	id, err := strconv.Atoi(exploded[4])
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	src := exploded[3]
+
+	year := r.URL.Query().Get("y")
+	month := r.URL.Query().Get("m")
+
+	stringMap := make(map[string]string)
+	stringMap["src"] = src
+	stringMap["year"] = year
+	stringMap["month"] = month
+
+	// get reservation by id
+	res, err := repo.DB.GetReservationById(id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["reservations"] = res
+
+	err = render.Template(w, r, "admin-show-reservation.page.tmpl", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+		Form:      forms.New(nil),
+	})
+	if err != nil {
+		helpers.ServerError(w, r, err)
+	}
+}
+
+// PostAdminShowReservation is the admin show reservation handler for post request
+func (repo *Repository) PostAdminShowReservation(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	exploded := strings.Split(r.RequestURI, "/")
+	id, err := strconv.Atoi(exploded[4])
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	src := exploded[3]
+
+	stringMap := make(map[string]string)
+	stringMap["src"] = src
+
+	// get reservation by id
+	res, err := repo.DB.GetReservationById(id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	res.FirstName = r.Form.Get("first_name")
+	res.LastName = r.Form.Get("last_name")
+	res.Email = r.Form.Get("email")
+	res.Phone = r.Form.Get("phone")
+
+	err = repo.DB.UpdateReservation(res)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	year := r.Form.Get("year")
+	month := r.Form.Get("month")
+
 	repo.App.Session.Put(r.Context(), "flash", "Changes saved")
 
-	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%d&m=%d", year, month), http.StatusSeeOther)
+	if year == "" {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+	}
+}
+
+// GetAdminProcessReservation is the admin process reservation handler for get request
+func (repo *Repository) GetAdminProcessReservation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	src := chi.URLParam(r, "src")
+
+	err = repo.DB.UpdateProcessedForReservation(id, 1)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	year := r.URL.Query().Get("y")
+	month := r.URL.Query().Get("m")
+
+	repo.App.Session.Put(r.Context(), "flash", "Reservation marked as processed")
+
+	if year == "" {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+	}
+}
+
+// GetAdminDeleteReservation is the admin delete reservation handler for get request
+func (repo *Repository) GetAdminDeleteReservation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	src := chi.URLParam(r, "src")
+
+	// the guest is only told the reservation is gone if the admin asked for it
+	notify := r.URL.Query().Get("notify") == "1"
+
+	var res models.Reservation
+	if notify {
+		res, err = repo.DB.GetReservationById(id)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+	}
+
+	err = repo.DB.DeleteReservation(id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	if notify {
+		repo.App.MailChan <- models.MailData{
+			To:       res.Email,
+			From:     repo.App.MailFrom,
+			Subject:  "Reservation Cancellation",
+			Template: mailer.ReservationCancellation,
+			Data:     mailer.ReservationData{Reservation: res},
+		}
+	}
+
+	year := r.URL.Query().Get("y")
+	month := r.URL.Query().Get("m")
+
+	repo.App.Session.Put(r.Context(), "flash", "Reservation Deleted")
+
+	if year == "" {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+	}
+}
+
+// GetAdminReservationsCalendar displays the admin reservations calendar
+func (repo *Repository) GetAdminReservationsCalendar(w http.ResponseWriter, r *http.Request) {
+	// assume there is no month/year specified
+	today := repo.today()
+	now := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	if r.URL.Query().Get("y") != "" {
+		year, err := strconv.Atoi(r.URL.Query().Get("y"))
+		if err != nil {
+			helpers.ClientError(w, r, http.StatusBadRequest)
+			return
+		}
+
+		month, err := strconv.Atoi(r.URL.Query().Get("m"))
+		if err != nil || month < 1 || month > 12 {
+			helpers.ClientError(w, r, http.StatusBadRequest)
+			return
+		}
+
+		now = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	data := make(map[string]interface{})
+	data["now"] = now
+
+	next := now.AddDate(0, 1, 0)
+	last := now.AddDate(0, -1, 0)
+
+	stringMap := make(map[string]string)
+	stringMap["next_month"] = next.Format("01")
+	stringMap["next_month_year"] = next.Format("2006")
+	stringMap["last_month"] = last.Format("01")
+	stringMap["last_month_year"] = last.Format("2006")
+
+	stringMap["this_month"] = now.Format("01")
+	stringMap["this_month_year"] = now.Format("2006")
+
+	// get the first and last days of the month
+	currentYear, currentMonth, _ := now.Date()
+	firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, time.UTC)
+	lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
+
+	rooms, err := repo.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	// every room's restrictions in one query
+	restrictions, err := repo.DB.GetRestrictionsForRoomsByDate(nil, firstOfMonth, lastOfMonth)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	data["days"] = calendar.Days(firstOfMonth, lastOfMonth)
+	data["rows"] = calendar.Build(rooms, restrictions, firstOfMonth, lastOfMonth)
+
+	err = render.Template(w, r, "admin-reservations-calendar.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+	})
+	if err != nil {
+		helpers.ServerError(w, r, err)
+	}
+}
+
+// PostAdminReservationsCalendar adds and removes the blocks changed on the
+// calendar. Nothing is saved if a room being changed was changed by someone
+// else since the calendar was loaded.
+func (repo *Repository) PostAdminReservationsCalendar(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	year, err := strconv.Atoi(r.Form.Get("y"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	month, err := strconv.Atoi(r.Form.Get("m"))
+	if err != nil || month < 1 || month > 12 {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	calendarURL := fmt.Sprintf("/admin/reservations-calendar?y=%d&m=%d", year, month)
+
+	firstOfMonth := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
+
+	rooms, err := repo.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	current, err := repo.DB.GetRestrictionsForRoomsByDate(nil, firstOfMonth, lastOfMonth)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	restrictions := make(map[int]models.RoomRestriction, len(current))
+	for _, x := range current {
+		restrictions[x.Id] = x
+	}
+
+	roomIds := make(map[int]bool, len(rooms))
+	for _, room := range rooms {
+		roomIds[room.Id] = true
+	}
+
+	// the version of each changed room the calendar was loaded with
+	versions := make(map[int]string)
+	loadedVersion := func(roomId int) {
+		versions[roomId] = r.Form.Get(fmt.Sprintf("version_%d", roomId))
+	}
+
+	conflict := false
+
+	var remove []int
+	for _, value := range r.Form["remove_block"] {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			helpers.ClientError(w, r, http.StatusBadRequest)
+			return
+		}
+
+		// only blocks can be removed here, and only if they still exist
+		restriction, ok := restrictions[id]
+		if !ok || restriction.ReservationId > 0 {
+			conflict = true
+			continue
+		}
+
+		// longer blocks are changed on their own page
+		if restriction.CheckOut.Sub(restriction.CheckIn) > 24*time.Hour {
+			helpers.ClientError(w, r, http.StatusBadRequest)
+			return
+		}
+
+		loadedVersion(restriction.RoomId)
+		remove = append(remove, id)
+	}
+
+	owner, err := repo.DB.GetRestrictionByCode(models.RestrictionOwner)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	var add []models.RoomRestriction
+	for _, value := range r.Form["add_block"] {
+		room, day, _ := strings.Cut(value, "_")
+
+		roomId, err := strconv.Atoi(room)
+		if err != nil {
+			helpers.ClientError(w, r, http.StatusBadRequest)
+			return
+		}
+
+		date, err := time.Parse("2006-01-2", day)
+		if err != nil || date.Before(firstOfMonth) || date.After(lastOfMonth) {
+			helpers.ClientError(w, r, http.StatusBadRequest)
+			return
+		}
+
+		if !roomIds[roomId] {
+			helpers.ClientError(w, r, http.StatusBadRequest)
+			return
+		}
+
+		loadedVersion(roomId)
+		add = append(add, models.RoomRestriction{
+			RoomId:        roomId,
+			RestrictionId: owner.Id,
+			CheckIn:       date,
+			CheckOut:      date.AddDate(0, 0, 1),
+		})
+	}
+
+	if !conflict && (len(add) > 0 || len(remove) > 0) {
+		err = repo.DB.UpdateBlocks(versions, firstOfMonth, lastOfMonth, add, remove)
+		if errors.Is(err, repository.ErrConflict) {
+			conflict = true
+		} else if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+	}
+
+	if conflict {
+		repo.App.Session.Put(r.Context(), "error", "The calendar was changed by someone else while you were editing it. Nothing was saved, please check it and make your changes again.")
+		http.Redirect(w, r, calendarURL, http.StatusSeeOther)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "Changes saved")
+
+	http.Redirect(w, r, calendarURL, http.StatusSeeOther)
+}
+
+// the longest range shown on the timeline or returned by its feed
+const maxTimelineDays = 366
+
+// GetAdminReservationsTimeline displays the rooms as rows and the days from
+// start to end as columns, with stays as bars
+func (repo *Repository) GetAdminReservationsTimeline(w http.ResponseWriter, r *http.Request) {
+	// default to this month and the next two
+	today := repo.today()
+	start := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 3, -1)
+
+	start, end, err := timelineRange(r, start, end, false)
+	if err != nil {
+		helpers.LogError(r, "Invalid timeline range", err)
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	rooms, err := repo.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	restrictions, err := repo.DB.GetRestrictionsForRoomsByDate(nil, start, end)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	// move back and forward by the length of the range
+	days := len(calendar.Days(start, end))
+
+	layout := "2006-01-02"
+	stringMap := make(map[string]string)
+	stringMap["start"] = start.Format(layout)
+	stringMap["end"] = end.Format(layout)
+	stringMap["prev_start"] = start.AddDate(0, 0, -days).Format(layout)
+	stringMap["prev_end"] = start.AddDate(0, 0, -1).Format(layout)
+	stringMap["next_start"] = end.AddDate(0, 0, 1).Format(layout)
+	stringMap["next_end"] = end.AddDate(0, 0, days).Format(layout)
+	for _, months := range []int{1, 3, 6, 12} {
+		stringMap[fmt.Sprintf("end_%d", months)] = start.AddDate(0, months, -1).Format(layout)
+	}
+
+	data := make(map[string]interface{})
+	data["timeline"] = calendar.NewTimeline(rooms, restrictions, start, end)
+
+	err = render.Template(w, r, "admin-reservations-timeline.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+	})
+	if err != nil {
+		helpers.ServerError(w, r, err)
+	}
+}
+
+// timelineEvent is a stay or block in the timeline feed, in the format
+// calendar widgets read
+type timelineEvent struct {
+	Id            string `json:"id"`
+	ResourceId    string `json:"resourceId"`
+	Title         string `json:"title"`
+	Start         string `json:"start"`
+	End           string `json:"end"`
+	Kind          string `json:"kind"`
+	ReservationId int    `json:"reservation_id,omitempty"`
+	URL           string `json:"url,omitempty"`
+	Color         string `json:"color,omitempty"`
+}
+
+// timelineResource is a room in the timeline feed
+type timelineResource struct {
+	Id    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// GetAdminTimelineEvents returns the stays and blocks from start up to end as
+// json, so a calendar widget can page through them. Rooms can be filtered
+// with one or more room parameters.
+func (repo *Repository) GetAdminTimelineEvents(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("start") == "" || r.URL.Query().Get("end") == "" {
+		writeJSON(w, http.StatusBadRequest, jsonResponse{OK: false, Message: "start and end are required"})
+		return
+	}
+
+	start, end, err := timelineRange(r, time.Time{}, time.Time{}, true)
+	if err != nil {
+		helpers.LogError(r, "Invalid timeline range", err)
+		writeJSON(w, http.StatusBadRequest, jsonResponse{OK: false, Message: err.Error()})
+		return
+	}
+
+	var roomIds []int
+	for _, value := range r.URL.Query()["room"] {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, jsonResponse{OK: false, Message: "invalid room " + value})
+			return
+		}
+		roomIds = append(roomIds, id)
+	}
+
+	restrictions, err := repo.DB.GetRestrictionsForRoomsByDate(roomIds, start, end)
+	if err != nil {
+		helpers.LogError(r, "Can't get timeline events", err)
+		writeJSON(w, http.StatusInternalServerError, jsonResponse{OK: false, Message: "Internal server error"})
+		return
+	}
+
+	events := make([]timelineEvent, 0, len(restrictions))
+	for _, x := range restrictions {
+		event := timelineEvent{
+			Id:         fmt.Sprintf("block-%d", x.Id),
+			ResourceId: strconv.Itoa(x.RoomId),
+			Title:      calendar.BlockLabel(x),
+			Start:      x.CheckIn.Format("2006-01-02"),
+			End:        x.CheckOut.Format("2006-01-02"),
+			Kind:       calendar.Block,
+			URL:        fmt.Sprintf("/admin/blocks/%d/edit", x.Id),
+			Color:      x.Restriction.Colour,
+		}
+
+		if x.ReservationId > 0 {
+			event.Id = fmt.Sprintf("reservation-%d", x.ReservationId)
+			event.Title = strings.TrimSpace(x.Reservation.FirstName + " " + x.Reservation.LastName)
+			event.Kind = calendar.Stay
+			event.ReservationId = x.ReservationId
+			event.URL = fmt.Sprintf("/admin/reservations/timeline/%d/show", x.ReservationId)
+		}
+
+		events = append(events, event)
+	}
+
+	writeJSON(w, http.StatusOK, events)
+}
+
+// GetAdminTimelineRooms returns the rooms as json, for the rows of a calendar widget
+func (repo *Repository) GetAdminTimelineRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := repo.DB.AllRooms()
+	if err != nil {
+		helpers.LogError(r, "Can't get rooms", err)
+		writeJSON(w, http.StatusInternalServerError, jsonResponse{OK: false, Message: "Internal server error"})
+		return
+	}
+
+	resources := make([]timelineResource, 0, len(rooms))
+	for _, room := range rooms {
+		resources = append(resources, timelineResource{
+			Id:    strconv.Itoa(room.Id),
+			Title: room.RoomName,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, resources)
+}
+
+// timelineRange reads the start and end dates from the query, keeping the
+// defaults for those not given. Calendar widgets send an end date that isn't
+// included, which exclusiveEnd accounts for.
+func timelineRange(r *http.Request, start, end time.Time, exclusiveEnd bool) (time.Time, time.Time, error) {
+	var err error
+
+	if s := r.URL.Query().Get("start"); s != "" {
+		start, err = parseDay(s)
+		if err != nil {
+			return start, end, fmt.Errorf("invalid start date %q", s)
+		}
+	}
+
+	if s := r.URL.Query().Get("end"); s != "" {
+		end, err = parseDay(s)
+		if err != nil {
+			return start, end, fmt.Errorf("invalid end date %q", s)
+		}
+		if exclusiveEnd {
+			end = end.AddDate(0, 0, -1)
+		}
+	}
+
+	if end.Before(start) {
+		return start, end, errors.New("end date is before start date")
+	}
+
+	if len(calendar.Days(start, end)) > maxTimelineDays {
+		return start, end, fmt.Errorf("range is longer than %d days", maxTimelineDays)
+	}
+
+	return start, end, nil
+}
+
+// parseDay parses a date, or the date part of a time sent by a calendar widget
+func parseDay(s string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		t, err = time.Parse(time.RFC3339, s)
+	}
+	if err != nil {
+		return t, err
+	}
+	return calendar.Date(t), nil
+}
+
+// writeJSON writes v as the json response with status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	out, _ := json.MarshalIndent(v, "", "     ")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(out)
+}
+
+// today returns today's date in App.Location, the hotel's time zone
+func (repo *Repository) today() time.Time {
+	loc := repo.App.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	return calendar.Date(time.Now().In(loc))
+}
+
+// GetAdminBlocks lists the upcoming blocks and the recurring block rules
+func (repo *Repository) GetAdminBlocks(w http.ResponseWriter, r *http.Request) {
+	blocks, err := repo.DB.AllBlocks(repo.today())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	rules, err := repo.DB.AllBlockRules()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["blocks"] = blocks
+	data["rules"] = rules
+
+	err = render.Template(w, r, "admin-blocks.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+	if err != nil {
+		helpers.ServerError(w, r, err)
+	}
+}
+
+// GetAdminNewBlock displays the form to block a room
+func (repo *Repository) GetAdminNewBlock(w http.ResponseWriter, r *http.Request) {
+	today := repo.today().Format("2006-01-02")
+
+	form := forms.New(url.Values{})
+	form.Set("room_id", r.URL.Query().Get("room"))
+	form.Set("start_date", today)
+	form.Set("end_date", today)
+
+	repo.renderBlockForm(w, r, form, models.RoomRestriction{})
+}
+
+// PostAdminNewBlock blocks a room for a range of nights, once or repeating
+// every week or year
+func (repo *Repository) PostAdminNewBlock(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	block, ok, err := repo.blockFromForm(form, true)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	if !ok {
+		repo.renderBlockForm(w, r, form, models.RoomRestriction{})
+		return
+	}
+
+	if form.Get("repeat") == "" {
+		_, err = repo.DB.InsertBlock(block)
+		if errors.Is(err, repository.ErrConflict) {
+			form.Errors.Add("start_date", "The room is already booked or blocked on some of these nights")
+			repo.renderBlockForm(w, r, form, models.RoomRestriction{})
+			return
+		}
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+
+		repo.App.Session.Put(r.Context(), "flash", "Block saved")
+		http.Redirect(w, r, "/admin/blocks", http.StatusSeeOther)
+		return
+	}
+
+	rule := models.BlockRule{
+		RoomId:        block.RoomId,
+		RestrictionId: block.RestrictionId,
+		Note:          block.Note,
+		Frequency:     form.Get("repeat"),
+		StartDate:     block.CheckIn,
+		EndDate:       block.CheckOut,
+	}
+	if form.Get("until") != "" {
+		rule.Until, _ = time.Parse("2006-01-02", form.Get("until"))
+	}
+
+	// blocks are made from today, or the rule's first block if that is later,
+	// and the scheduler makes more as time goes on
+	today := repo.today()
+	rule.BlockedUntil = today.AddDate(calendar.RuleYears, 0, 0)
+	if rule.StartDate.After(today) {
+		rule.BlockedUntil = rule.StartDate.AddDate(calendar.RuleYears, 0, 0)
+	}
+	blocks := calendar.Occurrences(rule, today, rule.BlockedUntil)
+
+	_, inserted, err := repo.DB.InsertBlockRule(rule, blocks)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	if inserted < len(blocks) {
+		repo.App.Session.Put(r.Context(), "warning", fmt.Sprintf("Rule saved. %d of %d blocks were skipped because the room is already booked or blocked then", len(blocks)-inserted, len(blocks)))
+	} else {
+		repo.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Rule saved with %d blocks", inserted))
+	}
+
+	http.Redirect(w, r, "/admin/blocks", http.StatusSeeOther)
+}
+
+// GetAdminEditBlock displays the form to change a block
+func (repo *Repository) GetAdminEditBlock(w http.ResponseWriter, r *http.Request) {
+	block, ok := repo.blockFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	form := forms.New(url.Values{})
+	form.Set("room_id", strconv.Itoa(block.RoomId))
+	form.Set("restriction_id", strconv.Itoa(block.RestrictionId))
+	form.Set("start_date", block.CheckIn.Format("2006-01-02"))
+	form.Set("end_date", lastNight(block).Format("2006-01-02"))
+	form.Set("note", block.Note)
+
+	repo.renderBlockForm(w, r, form, block)
+}
+
+// PostAdminEditBlock changes the nights, type and note of a block
+func (repo *Repository) PostAdminEditBlock(w http.ResponseWriter, r *http.Request) {
+	existing, ok := repo.blockFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	// the room can't be changed, the block is deleted and made again instead
+	form := forms.New(r.PostForm)
+	form.Set("room_id", strconv.Itoa(existing.RoomId))
+	form.Del("repeat")
+
+	block, ok, err := repo.blockFromForm(form, false)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	if !ok {
+		repo.renderBlockForm(w, r, form, existing)
+		return
+	}
+
+	block.Id = existing.Id
+	err = repo.DB.UpdateBlock(block)
+	if errors.Is(err, repository.ErrConflict) {
+		form.Errors.Add("start_date", "The room is already booked or blocked on some of these nights")
+		repo.renderBlockForm(w, r, form, existing)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "Block saved")
+	http.Redirect(w, r, "/admin/blocks", http.StatusSeeOther)
+}
+
+// PostAdminDeleteBlock removes a block
+func (repo *Repository) PostAdminDeleteBlock(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+
+	err = repo.DB.DeleteBlockById(id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "Block deleted")
+	http.Redirect(w, r, "/admin/blocks", http.StatusSeeOther)
+}
+
+// PostAdminDeleteBlockRule removes a recurring rule and its blocks from
+// today on
+func (repo *Repository) PostAdminDeleteBlockRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+
+	err = repo.DB.DeleteBlockRule(id, repo.today())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "Rule and its upcoming blocks deleted")
+	http.Redirect(w, r, "/admin/blocks", http.StatusSeeOther)
+}
+
+// blockFromURL loads the block named by the id in the url, writing a not
+// found page if there isn't one
+func (repo *Repository) blockFromURL(w http.ResponseWriter, r *http.Request) (models.RoomRestriction, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return models.RoomRestriction{}, false
+	}
+
+	block, err := repo.DB.GetBlockById(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return models.RoomRestriction{}, false
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return models.RoomRestriction{}, false
+	}
+
+	return block, true
+}
+
+// blockFromForm validates the block form. The end date is the last night
+// blocked, so the block's check out is the day after.
+func (repo *Repository) blockFromForm(form *forms.Form, checkRoom bool) (models.RoomRestriction, bool, error) {
+	var block models.RoomRestriction
+
+	form.Required("room_id", "restriction_id", "start_date", "end_date")
+
+	block.RoomId, _ = strconv.Atoi(form.Get("room_id"))
+	block.RestrictionId, _ = strconv.Atoi(form.Get("restriction_id"))
+	block.Note = strings.TrimSpace(form.Get("note"))
+
+	if checkRoom && form.Get("room_id") != "" {
+		rooms, err := repo.DB.AllRooms()
+		if err != nil {
+			return block, false, err
+		}
+		if !containsRoom(rooms, block.RoomId) {
+			form.Errors.Add("room_id", "Choose a room")
+		}
+	}
+
+	if form.Get("restriction_id") != "" {
+		types, err := repo.blockTypes()
+		if err != nil {
+			return block, false, err
+		}
+		found := false
+		for _, t := range types {
+			found = found || t.Id == block.RestrictionId
+		}
+		if !found {
+			form.Errors.Add("restriction_id", "Choose a type of block")
+		}
+	}
+
+	start, err := time.Parse("2006-01-02", form.Get("start_date"))
+	if form.Get("start_date") != "" && err != nil {
+		form.Errors.Add("start_date", "Invalid date")
+	}
+
+	end, err := time.Parse("2006-01-02", form.Get("end_date"))
+	if form.Get("end_date") != "" && err != nil {
+		form.Errors.Add("end_date", "Invalid date")
+	}
+
+	if !form.Valid() {
+		return block, false, nil
+	}
+
+	if end.Before(start) {
+		form.Errors.Add("end_date", "The last night can't be before the first")
+		return block, false, nil
+	}
+
+	block.CheckIn = start
+	block.CheckOut = end.AddDate(0, 0, 1)
+	nights := int(block.CheckOut.Sub(block.CheckIn).Hours() / 24)
+
+	switch form.Get("repeat") {
+	case "":
+	case models.Weekly:
+		if nights > 7 {
+			form.Errors.Add("end_date", "A block repeating every week can't be longer than a week")
+		}
+	case models.Yearly:
+		if nights > 365 {
+			form.Errors.Add("end_date", "A block repeating every year can't be longer than a year")
+		}
+	default:
+		form.Errors.Add("repeat", "Choose how often the block repeats")
+	}
+
+	if form.Get("repeat") != "" && form.Get("until") != "" {
+		until, err := time.Parse("2006-01-02", form.Get("until"))
+		if err != nil {
+			form.Errors.Add("until", "Invalid date")
+		} else if until.Before(start) {
+			form.Errors.Add("until", "The rule can't end before its first block")
+		}
+	}
+
+	return block, form.Valid(), nil
+}
+
+// renderBlockForm shows the new block form, or the edit form if block has
+// been saved
+func (repo *Repository) renderBlockForm(w http.ResponseWriter, r *http.Request, form *forms.Form, block models.RoomRestriction) {
+	rooms, err := repo.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	types, err := repo.blockTypes()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["block"] = block
+	data["rooms"] = rooms
+	data["types"] = types
+
+	err = render.Template(w, r, "admin-block.page.tmpl", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+	if err != nil {
+		helpers.ServerError(w, r, err)
+	}
+}
+
+// blockTypes returns the restrictions a room can be blocked with, which is
+// every one but reservations
+func (repo *Repository) blockTypes() ([]models.Restriction, error) {
+	restrictions, err := repo.DB.AllRestrictions()
+	if err != nil {
+		return nil, err
+	}
+
+	var types []models.Restriction
+	for _, x := range restrictions {
+		if x.Code != models.RestrictionReservation {
+			types = append(types, x)
+		}
+	}
+
+	return types, nil
+}
+
+// lastNight returns the last night a block covers
+func lastNight(block models.RoomRestriction) time.Time {
+	return block.CheckOut.AddDate(0, 0, -1)
+}
+
+func containsRoom(rooms []models.Room, id int) bool {
+	for _, room := range rooms {
+		if room.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// restriction type codes are short lower case names, and colours css hex colours
+var (
+	restrictionCode   = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+	restrictionColour = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+// GetAdminRestrictions lists the restriction types
+func (repo *Repository) GetAdminRestrictions(w http.ResponseWriter, r *http.Request) {
+	restrictions, err := repo.DB.AllRestrictions()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	builtIn := make(map[int]bool, len(restrictions))
+	for _, x := range restrictions {
+		builtIn[x.Id] = builtInRestriction(x)
+	}
+
+	data := make(map[string]interface{})
+	data["restrictions"] = restrictions
+	data["built_in"] = builtIn
+
+	err = render.Template(w, r, "admin-restrictions.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+	if err != nil {
+		helpers.ServerError(w, r, err)
+	}
+}
+
+// GetAdminNewRestriction displays the form to add a restriction type
+func (repo *Repository) GetAdminNewRestriction(w http.ResponseWriter, r *http.Request) {
+	form := forms.New(url.Values{})
+	form.Set("colour", "#6c757d")
+
+	repo.renderRestrictionForm(w, r, form, models.Restriction{})
+}
+
+// PostAdminNewRestriction adds a restriction type
+func (repo *Repository) PostAdminNewRestriction(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	restriction := restrictionFromForm(form)
+
+	form.Required("code")
+	if form.Get("code") != "" && !restrictionCode.MatchString(restriction.Code) {
+		form.Errors.Add("code", "Use lower case letters, digits and underscores, starting with a letter")
+	}
+
+	if form.Valid() {
+		_, err = repo.DB.GetRestrictionByCode(restriction.Code)
+		if err == nil {
+			form.Errors.Add("code", "This code is already used")
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			helpers.ServerError(w, r, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		repo.renderRestrictionForm(w, r, form, models.Restriction{})
+		return
+	}
+
+	_, err = repo.DB.InsertRestriction(restriction)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "Restriction type saved")
+	http.Redirect(w, r, "/admin/restrictions", http.StatusSeeOther)
+}
+
+// GetAdminEditRestriction displays the form to change a restriction type
+func (repo *Repository) GetAdminEditRestriction(w http.ResponseWriter, r *http.Request) {
+	restriction, ok := repo.restrictionFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	form := forms.New(url.Values{})
+	form.Set("restriction_name", restriction.RestrictionName)
+	form.Set("colour", restriction.Colour)
+	if restriction.Occupancy {
+		form.Set("occupancy", "1")
+	}
+
+	repo.renderRestrictionForm(w, r, form, restriction)
+}
+
+// PostAdminEditRestriction changes the label, colour and occupancy of a
+// restriction type
+func (repo *Repository) PostAdminEditRestriction(w http.ResponseWriter, r *http.Request) {
+	existing, ok := repo.restrictionFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	// the code is what the app looks types up by, so it can't be changed
+	form := forms.New(r.PostForm)
+	restriction := restrictionFromForm(form)
+	restriction.Id = existing.Id
+	restriction.Code = existing.Code
+
+	if !form.Valid() {
+		repo.renderRestrictionForm(w, r, form, existing)
+		return
+	}
+
+	err = repo.DB.UpdateRestriction(restriction)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "Restriction type saved")
+	http.Redirect(w, r, "/admin/restrictions", http.StatusSeeOther)
+}
+
+// PostAdminDeleteRestriction deletes a restriction type that nothing uses
+func (repo *Repository) PostAdminDeleteRestriction(w http.ResponseWriter, r *http.Request) {
+	restriction, ok := repo.restrictionFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if builtInRestriction(restriction) {
+		repo.App.Session.Put(r.Context(), "error", "This restriction type is needed by the app and can't be deleted")
+		http.Redirect(w, r, "/admin/restrictions", http.StatusSeeOther)
+		return
+	}
+
+	err := repo.DB.DeleteRestriction(restriction.Id)
+	if errors.Is(err, repository.ErrInUse) {
+		repo.App.Session.Put(r.Context(), "error", "Rooms are blocked with this restriction type, delete those blocks first")
+		http.Redirect(w, r, "/admin/restrictions", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "Restriction type deleted")
+	http.Redirect(w, r, "/admin/restrictions", http.StatusSeeOther)
+}
+
+// restrictionFromURL loads the restriction type named by the id in the url,
+// writing a not found page if there isn't one
+func (repo *Repository) restrictionFromURL(w http.ResponseWriter, r *http.Request) (models.Restriction, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return models.Restriction{}, false
+	}
+
+	restriction, err := repo.DB.GetRestrictionById(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return models.Restriction{}, false
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return models.Restriction{}, false
+	}
+
+	return restriction, true
+}
+
+// restrictionFromForm validates the label and colour of the restriction type
+// form
+func restrictionFromForm(form *forms.Form) models.Restriction {
+	restriction := models.Restriction{
+		Code:            strings.TrimSpace(form.Get("code")),
+		RestrictionName: strings.TrimSpace(form.Get("restriction_name")),
+		Colour:          form.Get("colour"),
+		Occupancy:       form.Get("occupancy") == "1",
+	}
+
+	form.Required("restriction_name", "colour")
+	if form.Get("colour") != "" && !restrictionColour.MatchString(restriction.Colour) {
+		form.Errors.Add("colour", "Choose a colour like #6c757d")
+	}
+
+	return restriction
+}
+
+// renderRestrictionForm shows the new restriction type form, or the edit form
+// if restriction has been saved
+func (repo *Repository) renderRestrictionForm(w http.ResponseWriter, r *http.Request, form *forms.Form, restriction models.Restriction) {
+	data := make(map[string]interface{})
+	data["restriction"] = restriction
+	data["built_in"] = builtInRestriction(restriction)
+
+	err := render.Template(w, r, "admin-restriction.page.tmpl", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+	if err != nil {
+		helpers.ServerError(w, r, err)
+	}
+}
+
+// builtInRestriction reports whether the app looks restriction up by its code
+func builtInRestriction(restriction models.Restriction) bool {
+	return restriction.Code == models.RestrictionReservation || restriction.Code == models.RestrictionOwner
+}
+
+// GetAdminSessions lists the active sessions, admins first
+func (repo *Repository) GetAdminSessions(w http.ResponseWriter, r *http.Request) {
+	current := repo.App.Session.Token(r.Context())
+
+	var sessions []models.Session
+	err := repo.App.Session.Iterate(r.Context(), func(ctx context.Context) error {
+		s := models.Session{
+			Id:         sessionId(repo.App.Session.Token(ctx)),
+			UserId:     repo.App.Session.GetInt(ctx, "user_id"),
+			UserAgent:  repo.App.Session.GetString(ctx, "user_agent"),
+			LoggedInAt: repo.App.Session.GetTime(ctx, "logged_in_at"),
+			Expiry:     repo.App.Session.Deadline(ctx),
+			Reserving:  repo.App.Session.Exists(ctx, "reservation"),
+			Current:    repo.App.Session.Token(ctx) == current,
+		}
+
+		if s.UserId != 0 {
+			user, err := repo.DB.GetUserById(s.UserId)
+			if err != nil {
+				return err
+			}
+			s.User = user
+		}
+
+		sessions = append(sessions, s)
+		return nil
+	})
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		if (sessions[i].UserId != 0) != (sessions[j].UserId != 0) {
+			return sessions[i].UserId != 0
+		}
+		return sessions[i].Expiry.After(sessions[j].Expiry)
+	})
+
+	data := make(map[string]interface{})
+	data["sessions"] = sessions
+
+	err = render.Template(w, r, "admin-sessions.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+	if err != nil {
+		helpers.ServerError(w, r, err)
+	}
+}
+
+// PostAdminRevokeSession ends another session, logging out its user
+func (repo *Repository) PostAdminRevokeSession(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	current := repo.App.Session.Token(r.Context())
+
+	var token string
+	err := repo.App.Session.Iterate(r.Context(), func(ctx context.Context) error {
+		if sessionId(repo.App.Session.Token(ctx)) == id {
+			token = repo.App.Session.Token(ctx)
+		}
+		return nil
+	})
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	switch {
+	case token == "":
+		repo.App.Session.Put(r.Context(), "error", "Session not found, it may have already ended")
+	case token == current:
+		repo.App.Session.Put(r.Context(), "error", "Log out to end your own session")
+	default:
+		err = repo.App.Session.Store.Delete(token)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+		repo.App.Session.Put(r.Context(), "flash", "Session revoked")
+	}
+
+	http.Redirect(w, r, "/admin/sessions", http.StatusSeeOther)
+}
+
+// sessionId identifies a session on the admin pages without exposing its token
+func sessionId(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// the largest csp report read, real ones are a few hundred bytes
+const cspReportMaxBytes = 64 << 10
+
+// PostCSPReport logs a content security policy violation reported by a browser
+func (repo *Repository) PostCSPReport(w http.ResponseWriter, r *http.Request) {
+	var report csp.Report
+
+	r.Body = http.MaxBytesReader(w, r.Body, cspReportMaxBytes)
+	err := json.NewDecoder(r.Body).Decode(&report)
+	if err != nil {
+		helpers.LogError(r, "can't decode csp report", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body := report.Body
+	repo.App.Logger.WarnContext(r.Context(), "content security policy violation",
+		"document_uri", body.DocumentURI,
+		"violated_directive", body.ViolatedDirective,
+		"effective_directive", body.EffectiveDirective,
+		"blocked_uri", body.BlockedURI,
+		"source_file", body.SourceFile,
+		"line_number", body.LineNumber,
+		"disposition", body.Disposition,
+	)
+
+	w.WriteHeader(http.StatusNoContent)
 }
@@ -1,12 +1,15 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/psanodiya94/gobooking.com/internal/calendar"
 	"github.com/psanodiya94/gobooking.com/internal/driver"
 	"github.com/psanodiya94/gobooking.com/internal/models"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -34,11 +37,40 @@ var theTests = []struct {
 	{"dashboard", "/admin/dashboard", "GET", http.StatusOK},
 	{"new-res", "/admin/reservations-new", "GET", http.StatusOK},
 	{"all-res", "/admin/reservations-all", "GET", http.StatusOK},
+	{"all-res-filtered", "/admin/reservations-all?from=2050-01-01&to=2050-12-31&room=1&status=new&source=web&sort=name&dir=desc&page=2&per_page=10", "GET", http.StatusOK},
+	{"all-res-bad-page", "/admin/reservations-all?page=0", "GET", http.StatusBadRequest},
+	{"all-res-bad-sort", "/admin/reservations-all?sort=email", "GET", http.StatusBadRequest},
+	{"new-res-bad-date", "/admin/reservations-new?from=tomorrow", "GET", http.StatusBadRequest},
 	{"show-res", "/admin/reservations/new/1/show", "GET", http.StatusOK},
 	{"show-res-cal", "/admin/reservations-calendar", "GET", http.StatusOK},
 	{"process-res-cal", "/admin/process-reservations/cal/1/do?y=2020&m=1", "GET", http.StatusOK},
 	{"delete-res-cal", "/admin/delete-reservations/cal/1/do?y=2020&m=1", "GET", http.StatusOK},
+	{"delete-res-notify", "/admin/delete-reservations/all/1/do?notify=1", "GET", http.StatusOK},
 	{"show-res-cal-with-params", "/admin/reservations-calendar?y=2020&m=1", "GET", http.StatusOK},
+	{"show-res-cal-bad-month", "/admin/reservations-calendar?y=2020&m=13", "GET", http.StatusBadRequest},
+	{"show-res-cal-bad-year", "/admin/reservations-calendar?y=x&m=1", "GET", http.StatusBadRequest},
+	{"sessions", "/admin/sessions", "GET", http.StatusOK},
+	{"timeline", "/admin/reservations-timeline", "GET", http.StatusOK},
+	{"timeline-range", "/admin/reservations-timeline?start=2024-01-15&end=2024-06-30", "GET", http.StatusOK},
+	{"timeline-bad-date", "/admin/reservations-timeline?start=yesterday", "GET", http.StatusBadRequest},
+	{"timeline-backwards", "/admin/reservations-timeline?start=2024-02-01&end=2024-01-01", "GET", http.StatusBadRequest},
+	{"timeline-too-long", "/admin/reservations-timeline?start=2020-01-01&end=2024-01-01", "GET", http.StatusBadRequest},
+	{"timeline-rooms", "/admin/reservations-timeline/rooms", "GET", http.StatusOK},
+	{"blocks", "/admin/blocks", "GET", http.StatusOK},
+	{"new-block", "/admin/blocks/new", "GET", http.StatusOK},
+	{"edit-block", "/admin/blocks/2/edit", "GET", http.StatusOK},
+	{"edit-missing-block", "/admin/blocks/200/edit", "GET", http.StatusNotFound},
+	{"search-empty", "/admin/search", "GET", http.StatusOK},
+	{"import-reservations", "/admin/reservations-import", "GET", http.StatusOK},
+	{"report-departures", "/admin/reports/departures?date=2050-01-01", "GET", http.StatusOK},
+	{"report-bad-date", "/admin/reports/arrivals?date=tomorrow", "GET", http.StatusBadRequest},
+	{"report-missing", "/admin/reports/no-shows", "GET", http.StatusNotFound},
+	{"report-csv-missing", "/admin/reports/no-shows/csv", "GET", http.StatusNotFound},
+	{"csv-bad-filter", "/admin/reservations-csv?sort=email", "GET", http.StatusBadRequest},
+	{"restrictions", "/admin/restrictions", "GET", http.StatusOK},
+	{"new-restriction", "/admin/restrictions/new", "GET", http.StatusOK},
+	{"edit-restriction", "/admin/restrictions/3/edit", "GET", http.StatusOK},
+	{"edit-missing-restriction", "/admin/restrictions/200/edit", "GET", http.StatusNotFound},
 }
 
 // TestHandlers tests all routes that don't require extra tests (gets)
@@ -229,6 +261,38 @@ var postReservationTests = []struct {
 		expectedHTML:         `action="/make-reservation"`,
 		expectedLocation:     "",
 	},
+	{
+		name: "sms-opt-in",
+		postedData: url.Values{
+			"check_in":   {"2050-01-01"},
+			"check_out":  {"2050-01-02"},
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"john@smith.com"},
+			"phone":      {"555-555-5555"},
+			"room_id":    {"1"},
+			"sms_opt_in": {"1"},
+		},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedHTML:         "",
+		expectedLocation:     "/reservation-summary",
+	},
+	{
+		name: "sms-opt-in-invalid-phone",
+		postedData: url.Values{
+			"check_in":   {"2050-01-01"},
+			"check_out":  {"2050-01-02"},
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"john@smith.com"},
+			"phone":      {"call me"},
+			"room_id":    {"1"},
+			"sms_opt_in": {"1"},
+		},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedHTML:         "A valid phone number is needed for text messages",
+		expectedLocation:     "",
+	},
 	{
 		name: "database-insert-fails-reservation",
 		postedData: url.Values{
@@ -760,6 +824,29 @@ func TestLogin(t *testing.T) {
 	}
 }
 
+// TestLoginSessionSaved logs in through the session middleware, so the session
+// has to be encoded and saved
+func TestLoginSessionSaved(t *testing.T) {
+	postedData := url.Values{}
+	postedData.Add("email", "admin@admin.com")
+	postedData.Add("password", "admin")
+
+	req, _ := http.NewRequest("POST", "/user/login", strings.NewReader(postedData.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+
+	handler := session.LoadAndSave(http.HandlerFunc(Repo.PostShowLogin))
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("expected code %d, but got %d", http.StatusSeeOther, rr.Code)
+	}
+
+	if len(rr.Result().Cookies()) == 0 {
+		t.Error("expected a session cookie after logging in")
+	}
+}
+
 var adminPostShowReservationTests = []struct {
 	name                 string
 	url                  string
@@ -855,92 +942,676 @@ func TestAdminPostShowReservation(t *testing.T) {
 	}
 }
 
-var adminPostReservationCalendarTests = []struct {
-	name                 string
-	postedData           url.Values
-	expectedResponseCode int
-	expectedLocation     string
-	expectedHTML         string
-	blocks               int
-	reservations         int
-}{
-	{
-		name: "cal",
-		postedData: url.Values{
-			"y": {time.Now().Format("2006")},
-			"m": {time.Now().Format("01")},
-			fmt.Sprintf("add_block_1_%s", time.Now().AddDate(0, 0, 2).Format("2006-01-2")): {"1"},
-		},
-		expectedResponseCode: http.StatusSeeOther,
-	},
-	{
-		name: "cal-blocks",
-		postedData: url.Values{
-			"y": {time.Now().Format("2006")},
-			"m": {time.Now().Format("01")},
-		},
-		expectedResponseCode: http.StatusSeeOther,
-		blocks:               1,
-	},
-	{
-		name: "cal-res",
-		postedData: url.Values{
-			"y": {time.Now().Format("2006")},
-			"m": {time.Now().Format("01")},
-		},
-		expectedResponseCode: http.StatusSeeOther,
-		reservations:         1,
-	},
+func TestPostReservationCalendar(t *testing.T) {
+	now := time.Now()
+	firstOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
+
+	restrictions, _ := Repo.DB.GetRestrictionsForRoomsByDate([]int{1}, firstOfMonth, lastOfMonth)
+	version := calendar.Version(restrictions)
+
+	day := func(d int) string {
+		return "1_" + firstOfMonth.AddDate(0, 0, d).Format("2006-01-2")
+	}
+
+	tests := []struct {
+		name                 string
+		postedData           url.Values
+		expectedResponseCode int
+		expectedFlash        string
+		expectedError        string
+	}{
+		{"add", url.Values{"version_1": {version}, "add_block": {day(10)}}, http.StatusSeeOther, "Changes saved", ""},
+		{"remove", url.Values{"version_1": {version}, "remove_block": {"2"}}, http.StatusSeeOther, "Changes saved", ""},
+		{"no changes", url.Values{"version_1": {version}}, http.StatusSeeOther, "Changes saved", ""},
+		{"stale", url.Values{"version_1": {"old"}, "add_block": {day(10)}}, http.StatusSeeOther, "", "changed by someone else"},
+		{"stale remove", url.Values{"version_1": {"old"}, "remove_block": {"2"}}, http.StatusSeeOther, "", "changed by someone else"},
+		{"remove reservation", url.Values{"version_1": {version}, "remove_block": {"1"}}, http.StatusSeeOther, "", "changed by someone else"},
+		{"remove deleted block", url.Values{"version_1": {version}, "remove_block": {"99"}}, http.StatusSeeOther, "", "changed by someone else"},
+		{"bad block id", url.Values{"version_1": {version}, "remove_block": {"x"}}, http.StatusBadRequest, "", ""},
+		{"unknown room", url.Values{"version_1": {version}, "add_block": {"9_" + firstOfMonth.Format("2006-01-2")}}, http.StatusBadRequest, "", ""},
+		{"other month", url.Values{"version_1": {version}, "add_block": {day(40)}}, http.StatusBadRequest, "", ""},
+	}
+
+	for _, e := range tests {
+		e.postedData.Set("y", now.Format("2006"))
+		e.postedData.Set("m", now.Format("01"))
+
+		req, _ := http.NewRequest("POST", "/admin/reservations-calendar", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+
+		// set the header
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		// call the handler
+		handler := http.HandlerFunc(Repo.PostAdminReservationsCalendar)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+
+		if flash := session.GetString(ctx, "flash"); flash != e.expectedFlash {
+			t.Errorf("failed %s: expected flash %q, but got %q", e.name, e.expectedFlash, flash)
+		}
+
+		if msg := session.GetString(ctx, "error"); !strings.Contains(msg, e.expectedError) || (e.expectedError == "" && msg != "") {
+			t.Errorf("failed %s: expected error %q, but got %q", e.name, e.expectedError, msg)
+		}
+	}
 }
 
-func TestPostReservationCalendar(t *testing.T) {
-	for _, e := range adminPostReservationCalendarTests {
-		var req *http.Request
-		if e.postedData != nil {
-			req, _ = http.NewRequest("POST", "/admin/reservations-calendar", strings.NewReader(e.postedData.Encode()))
-		} else {
-			req, _ = http.NewRequest("POST", "/admin/reservations-calendar", nil)
+func TestToday(t *testing.T) {
+	defer func(loc *time.Location) { Repo.App.Location = loc }(Repo.App.Location)
+
+	// somewhere it is usually a different day than on the server
+	for _, offset := range []int{-12, 14} {
+		loc := time.FixedZone("test", offset*60*60)
+		Repo.App.Location = loc
+
+		expected := calendar.Date(time.Now().In(loc))
+		if got := Repo.today(); !got.Equal(expected) {
+			t.Errorf("UTC%+d: expected %s but got %s", offset, expected, got)
+		}
+	}
+}
+
+func TestPostAdminNewBlock(t *testing.T) {
+	block := func(changes url.Values) url.Values {
+		values := url.Values{
+			"room_id":        {"1"},
+			"restriction_id": {"3"},
+			"start_date":     {"2050-01-03"},
+			"end_date":       {"2050-01-05"},
+			"note":           {"Repaint"},
+		}
+		for k, v := range changes {
+			values[k] = v
 		}
+		return values
+	}
+
+	tests := []struct {
+		name                 string
+		postedData           url.Values
+		expectedResponseCode int
+		expectedFlash        string
+		expectedHTML         string
+	}{
+		{"once", block(nil), http.StatusSeeOther, "Block saved", ""},
+		{"weekly", block(url.Values{"repeat": {"weekly"}, "until": {"2050-02-01"}}), http.StatusSeeOther, "Rule saved with 5 blocks", ""},
+		{"yearly", block(url.Values{"repeat": {"yearly"}}), http.StatusSeeOther, "Rule saved with", ""},
+		{"conflict", block(url.Values{"note": {"conflict"}}), http.StatusOK, "", "already booked or blocked"},
+		{"missing dates", block(url.Values{"start_date": {""}}), http.StatusOK, "", "This field is required"},
+		{"invalid date", block(url.Values{"end_date": {"soon"}}), http.StatusOK, "", "Invalid date"},
+		{"backwards", block(url.Values{"end_date": {"2050-01-01"}}), http.StatusOK, "", "can&#39;t be before the first"},
+		{"unknown room", block(url.Values{"room_id": {"9"}}), http.StatusOK, "", "Choose a room"},
+		{"reservation type", block(url.Values{"restriction_id": {"1"}}), http.StatusOK, "", "Choose a type of block"},
+		{"weekly too long", block(url.Values{"repeat": {"weekly"}, "end_date": {"2050-01-20"}}), http.StatusOK, "", "longer than a week"},
+		{"unknown repeat", block(url.Values{"repeat": {"daily"}}), http.StatusOK, "", "Choose how often"},
+		{"until before start", block(url.Values{"repeat": {"weekly"}, "until": {"2049-01-01"}}), http.StatusOK, "", "end before its first block"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/blocks/new", strings.NewReader(e.postedData.Encode()))
 		ctx := getCtx(req)
 		req = req.WithContext(ctx)
 
-		now := time.Now()
-		bm := make(map[string]int)
-		rm := make(map[string]int)
+		// set the header
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		// call the handler
+		handler := http.HandlerFunc(Repo.PostAdminNewBlock)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+
+		if flash := session.GetString(ctx, "flash"); !strings.HasPrefix(flash, e.expectedFlash) || (e.expectedFlash == "" && flash != "") {
+			t.Errorf("failed %s: expected flash %q, but got %q", e.name, e.expectedFlash, flash)
+		}
+
+		if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("failed %s: expected to find %s in the form", e.name, e.expectedHTML)
+		}
+	}
+}
+
+func TestPostAdminEditBlock(t *testing.T) {
+	routes := getRoutes()
+
+	tests := []struct {
+		name                 string
+		url                  string
+		note                 string
+		expectedResponseCode int
+	}{
+		{"saved", "/admin/blocks/2/edit", "Repaint", http.StatusSeeOther},
+		{"conflict", "/admin/blocks/2/edit", "conflict", http.StatusOK},
+		{"missing", "/admin/blocks/200/edit", "Repaint", http.StatusNotFound},
+		{"delete", "/admin/blocks/2/delete", "", http.StatusSeeOther},
+		{"delete rule", "/admin/block-rules/1/delete", "", http.StatusSeeOther},
+	}
 
-		currentYear, currentMonth, _ := now.Date()
-		currentLocation := now.Location()
+	for _, e := range tests {
+		postedData := url.Values{
+			"restriction_id": {"3"},
+			"start_date":     {"2050-01-03"},
+			"end_date":       {"2050-01-05"},
+			"note":           {e.note},
+		}
 
-		firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, currentLocation)
-		lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
+		req := httptest.NewRequest("POST", e.url, strings.NewReader(postedData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
 
-		for d := firstOfMonth; d.After(lastOfMonth) == false; d = d.AddDate(0, 0, 1) {
-			rm[d.Format("2006-01-2")] = 0
-			bm[d.Format("2006-01-2")] = 0
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
 		}
 
-		if e.blocks > 0 {
-			bm[firstOfMonth.Format("2006-01-2")] = e.blocks
+		if rr.Code == http.StatusSeeOther && rr.Header().Get("Location") != "/admin/blocks" {
+			t.Errorf("failed %s: expected a redirect to the blocks page, got %s", e.name, rr.Header().Get("Location"))
 		}
+	}
+}
 
-		if e.reservations > 0 {
-			rm[lastOfMonth.Format("2006-01-2")] = e.reservations
+func TestAdminRestrictions(t *testing.T) {
+	restriction := func(changes url.Values) url.Values {
+		values := url.Values{
+			"code":             {"deep_clean"},
+			"restriction_name": {"Deep Clean"},
+			"colour":           {"#17a2b8"},
 		}
+		for k, v := range changes {
+			values[k] = v
+		}
+		return values
+	}
 
-		session.Put(ctx, "block_map_1", bm)
-		session.Put(ctx, "reservation_map_1", rm)
+	tests := []struct {
+		name                 string
+		url                  string
+		postedData           url.Values
+		expectedResponseCode int
+		expectedFlash        string
+		expectedError        string
+		expectedHTML         string
+	}{
+		{"new", "/admin/restrictions/new", restriction(nil), http.StatusSeeOther, "Restriction type saved", "", ""},
+		{"new taken code", "/admin/restrictions/new", restriction(url.Values{"code": {"owner"}}), http.StatusOK, "", "", "already used"},
+		{"new bad code", "/admin/restrictions/new", restriction(url.Values{"code": {"Deep Clean"}}), http.StatusOK, "", "", "lower case letters"},
+		{"new missing label", "/admin/restrictions/new", restriction(url.Values{"restriction_name": {""}}), http.StatusOK, "", "", "This field is required"},
+		{"new bad colour", "/admin/restrictions/new", restriction(url.Values{"colour": {"red; background: url(x)"}}), http.StatusOK, "", "", "Choose a colour"},
+		{"edit", "/admin/restrictions/3/edit", restriction(url.Values{"occupancy": {"1"}}), http.StatusSeeOther, "Restriction type saved", "", ""},
+		{"edit bad colour", "/admin/restrictions/3/edit", restriction(url.Values{"colour": {"blue"}}), http.StatusOK, "", "", "Choose a colour"},
+		{"edit missing", "/admin/restrictions/200/edit", restriction(nil), http.StatusNotFound, "", "", ""},
+		{"delete", "/admin/restrictions/7/delete", nil, http.StatusSeeOther, "Restriction type deleted", "", ""},
+		{"delete built in", "/admin/restrictions/1/delete", nil, http.StatusSeeOther, "", "needed by the app", ""},
+		{"delete in use", "/admin/restrictions/3/delete", nil, http.StatusSeeOther, "", "delete those blocks first", ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", e.url, strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
 
 		// set the header
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		rr := httptest.NewRecorder()
 
-		// call the handler
-		handler := http.HandlerFunc(Repo.PostAdminReservationsCalendar)
+		// call the handler through a router, for the id in the url
+		mux := chi.NewRouter()
+		mux.Post("/admin/restrictions/new", Repo.PostAdminNewRestriction)
+		mux.Post("/admin/restrictions/{id}/edit", Repo.PostAdminEditRestriction)
+		mux.Post("/admin/restrictions/{id}/delete", Repo.PostAdminDeleteRestriction)
+		mux.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+
+		if flash := session.GetString(ctx, "flash"); flash != e.expectedFlash {
+			t.Errorf("failed %s: expected flash %q, but got %q", e.name, e.expectedFlash, flash)
+		}
+
+		if msg := session.GetString(ctx, "error"); !strings.Contains(msg, e.expectedError) || (e.expectedError == "" && msg != "") {
+			t.Errorf("failed %s: expected error %q, but got %q", e.name, e.expectedError, msg)
+		}
+
+		if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("failed %s: expected to find %s in the form", e.name, e.expectedHTML)
+		}
+	}
+}
+
+func TestReservationFilter(t *testing.T) {
+	req := httptest.NewRequest("GET", "/admin/reservations-all?from=2050-01-01&to=2050-01-31&room=2&status=processed&source=web&sort=created&dir=desc&page=3&per_page=50", nil)
+
+	filter, err := reservationFilter(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := models.ReservationFilter{
+		From:    time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:      time.Date(2050, 1, 31, 0, 0, 0, 0, time.UTC),
+		RoomId:  2,
+		Status:  models.StatusProcessed,
+		Source:  models.SourceWeb,
+		Sort:    models.SortCreated,
+		Desc:    true,
+		Page:    3,
+		PerPage: 50,
+	}
+	if !reflect.DeepEqual(filter, expected) {
+		t.Errorf("expected %+v, got %+v", expected, filter)
+	}
+
+	filter, _ = reservationFilter(httptest.NewRequest("GET", "/admin/reservations-all", nil))
+	if filter.Page != 1 || filter.PerPage != 25 || filter.Sort != models.SortArrival || filter.Desc {
+		t.Errorf("unexpected defaults %+v", filter)
+	}
+
+	for _, query := range []string{"page=x", "per_page=7", "sort=email", "dir=up", "to=31-01-2050", "room=x", "status=cancelled"} {
+		_, err := reservationFilter(httptest.NewRequest("GET", "/admin/reservations-all?"+query, nil))
+		if err == nil {
+			t.Errorf("%s: expected an error", query)
+		}
+	}
+}
+
+func TestReservationsJSON(t *testing.T) {
+	routes := getRoutes()
+
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/reservations-json?per_page=10&page=2", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+
+	var page reservationsPage
+	err := json.Unmarshal(rr.Body.Bytes(), &page)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if page.Total != 30 || page.Pages != 3 || page.Page != 2 || page.PerPage != 10 {
+		t.Errorf("unexpected pager %+v", page)
+	}
+
+	if len(page.Reservations) != 1 || page.Reservations[0].RoomName != "General's Quarters" || page.Reservations[0].CheckIn != "2050-01-01" {
+		t.Errorf("unexpected reservations %+v", page.Reservations)
+	}
+
+	rr = httptest.NewRecorder()
+	routes.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/reservations-json?sort=email", nil))
+
+	if rr.Code != http.StatusBadRequest || rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected a json bad request, got %d", rr.Code)
+	}
+}
+
+func TestAdminDashboard(t *testing.T) {
+	routes := getRoutes()
+
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/dashboard", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+
+	for _, expected := range []string{"50%", "2 in, 1 out", "12.5 days", "Average Daily Rate", "100.00", "50.00"} {
+		if !strings.Contains(rr.Body.String(), expected) {
+			t.Errorf("expected %q on the dashboard", expected)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	routes.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/dashboard/json", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+
+	var d dashboardJSON
+	err := json.Unmarshal(rr.Body.Bytes(), &d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(d.Occupancy) != dashboardLongDays || d.Occupancy30 != 50 || d.Occupancy90 != 50 || d.Occupancy[0].Date != d.Date {
+		t.Errorf("unexpected occupancy %d days, %d%% and %d%% from %s", len(d.Occupancy), d.Occupancy30, d.Occupancy90, d.Date)
+	}
+
+	if len(d.LeadTimes) != 4 || d.LeadTimes[1].Count != 4 || d.CancellationPercent != 10 {
+		t.Errorf("unexpected bookings %+v", d)
+	}
+
+	if d.ADR == nil || *d.ADR != 100 || d.RevPAR == nil || *d.RevPAR != 50 {
+		t.Errorf("unexpected adr %v and revpar %v", d.ADR, d.RevPAR)
+	}
+}
+
+func TestAdminReports(t *testing.T) {
+	routes := getRoutes()
+
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/reports/arrivals?date=2050-01-01", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+
+	body := rr.Body.String()
+	for _, expected := range []string{"Arrivals, Saturday, January 1, 2050", "Smith, John", "/admin/reports/arrivals/1/check-in", "?date=2049-12-31", `media="print"`} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected %q in the arrivals report", expected)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	routes.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/reports/in-house?date=2050-01-01", nil))
+
+	body = rr.Body.String()
+	if !strings.Contains(body, "Checked in Dec 31 15:00") || !strings.Contains(body, "/admin/reports/in-house/2/check-out") || strings.Contains(body, "check-in") {
+		t.Error("expected the in house guest to be checked in, with a check out action")
+	}
+
+	rr = httptest.NewRecorder()
+	routes.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/reports/in-house/csv?date=2050-01-01", nil))
+
+	if rr.Header().Get("Content-Disposition") != `attachment; filename="in-house-2050-01-01.csv"` || !strings.Contains(rr.Body.String(), "JANE2345") {
+		t.Errorf("unexpected csv %q", rr.Body.String())
+	}
+}
+
+func TestPostAdminFrontDesk(t *testing.T) {
+	tests := []struct {
+		name                 string
+		url                  string
+		expectedResponseCode int
+		expectedLocation     string
+		expectedFlash        string
+		expectedError        string
+	}{
+		{"check in", "/admin/reports/arrivals/1/check-in", http.StatusSeeOther, "/admin/reports/arrivals?date=2050-01-01", "Guest checked in", ""},
+		{"check out", "/admin/reports/departures/1/check-out", http.StatusSeeOther, "/admin/reports/departures?date=2050-01-01", "Guest checked out", ""},
+		{"not checked in", "/admin/reports/departures/3/check-out", http.StatusSeeOther, "/admin/reports/departures?date=2050-01-01", "", "before they have checked in"},
+		{"missing reservation", "/admin/reports/arrivals/200/check-in", http.StatusNotFound, "", "", ""},
+		{"missing report", "/admin/reports/no-shows/1/check-out", http.StatusNotFound, "", "", ""},
+		{"bad id", "/admin/reports/in-house/x/check-out", http.StatusNotFound, "", "", ""},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{"date": {"2050-01-01"}}
+		req, _ := http.NewRequest("POST", e.url, strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+
+		// set the header
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		// call the handler through a router, for the report and id in the url
+		mux := chi.NewRouter()
+		mux.Post("/admin/reports/{report}/{id}/check-in", Repo.PostAdminCheckIn)
+		mux.Post("/admin/reports/{report}/{id}/check-out", Repo.PostAdminCheckOut)
+		mux.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+
+		if location := rr.Header().Get("Location"); location != e.expectedLocation {
+			t.Errorf("failed %s: expected location %q, but got %q", e.name, e.expectedLocation, location)
+		}
+
+		if flash := session.GetString(ctx, "flash"); flash != e.expectedFlash {
+			t.Errorf("failed %s: expected flash %q, but got %q", e.name, e.expectedFlash, flash)
+		}
+
+		if msg := session.GetString(ctx, "error"); !strings.Contains(msg, e.expectedError) || (e.expectedError == "" && msg != "") {
+			t.Errorf("failed %s: expected error %q, but got %q", e.name, e.expectedError, msg)
+		}
+	}
+}
+
+func TestReservationsCSV(t *testing.T) {
+	routes := getRoutes()
+
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/reservations-csv?from=2050-01-01&per_page=10&page=2", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/csv") || !strings.HasPrefix(rr.Header().Get("Content-Disposition"), "attachment") {
+		t.Errorf("expected a csv download, got %q and %q", rr.Header().Get("Content-Type"), rr.Header().Get("Content-Disposition"))
+	}
+
+	lines := strings.Split(strings.TrimSuffix(rr.Body.String(), "\r\n"), "\r\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "id,confirmation_code,") || !strings.Contains(lines[1], "General's Quarters,2050-01-01") {
+		t.Errorf("unexpected csv %q", rr.Body.String())
+	}
+}
+
+func TestPostAdminImportReservations(t *testing.T) {
+	const header = "first_name,last_name,email,room_name,check_in,check_out,confirmation_code\n"
+
+	tests := []struct {
+		name                 string
+		action               string
+		csv                  string
+		expectedResponseCode int
+		expectedFlash        string
+		expectedError        string
+		expectedHTML         string
+	}{
+		{"preview", "preview", header + "John,Smith,john@smith.com,General's Quarters,2030-01-01,2030-01-03,\n", http.StatusOK, "", "", "Import 1 Reservations"},
+		{"import", "import", header + "John,Smith,john@smith.com,general's quarters,2030-01-01,2030-01-03,\n", http.StatusSeeOther, "Imported 1 reservations", "", ""},
+		{"import conflict", "import", header + "John,Smith,john@smith.com,General's Quarters,2030-01-01,2030-01-03,TAKEN\n", http.StatusOK, "", "", "Nothing was imported"},
+		{"import unknown type", "import", header + "John,Smith,john@smith.com,General's Quarters,2030-01-01,2030-01-03,NOTYPE\n", http.StatusOK, "", "", "no reservation restriction type"},
+		{"import invalid", "import", header + "John,Smith,john@smith.com,Attic,2030-01-01,2030-01-03,\n", http.StatusOK, "", "", "no room Attic"},
+		{"booked", "preview", header + "John,Smith,john@smith.com,General's Quarters,2050-01-01,2050-01-03,\n", http.StatusOK, "", "", "not available for these dates"},
+		{"overlapping rows", "preview", header + "John,Smith,john@smith.com,General's Quarters,2030-01-01,2030-01-03,\nJane,Smith,jane@smith.com,General's Quarters,2030-01-02,2030-01-04,\n", http.StatusOK, "", "", "overlaps line 2"},
+		{"repeated code", "preview", header + "John,Smith,john@smith.com,General's Quarters,2030-01-01,2030-01-03,ABCD2345\nJane,Smith,jane@smith.com,General's Quarters,2030-02-01,2030-02-03,ABCD2345\n", http.StatusOK, "", "", "also on line 2"},
+		{"bad row", "preview", header + "John,Smith,john,General's Quarters,2030-01-03,2030-01-01,\n", http.StatusOK, "", "", "check_out must be after check_in"},
+		{"missing columns", "preview", "name,email\nJohn,john@smith.com\n", http.StatusOK, "", "", "missing columns"},
+		{"empty", "preview", "", http.StatusOK, "", "", "Choose a csv file"},
+		{"availability error", "preview", header + "John,Smith,john@smith.com,General's Quarters,2060-01-01,2060-01-03,\n", http.StatusInternalServerError, "", "", ""},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{"action": {e.action}, "csv": {e.csv}}
+		req, _ := http.NewRequest("POST", "/admin/reservations-import", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+
+		// set the header
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostAdminImportReservations)
 		handler.ServeHTTP(rr, req)
 
 		if rr.Code != e.expectedResponseCode {
 			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
 		}
+
+		if flash := session.GetString(ctx, "flash"); flash != e.expectedFlash {
+			t.Errorf("failed %s: expected flash %q, but got %q", e.name, e.expectedFlash, flash)
+		}
+
+		if msg := session.GetString(ctx, "error"); !strings.Contains(msg, e.expectedError) || (e.expectedError == "" && msg != "") {
+			t.Errorf("failed %s: expected error %q, but got %q", e.name, e.expectedError, msg)
+		}
+
+		if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("failed %s: expected to find %s in the page", e.name, e.expectedHTML)
+		}
+	}
+
+	// a file uploaded from the form is previewed, not imported
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	_ = mw.WriteField("action", "preview")
+	fw, _ := mw.CreateFormFile("file", "reservations.csv")
+	_, _ = fw.Write([]byte(header + "John,Smith,john@smith.com,General's Quarters,2030-01-01,2030-01-03,\n"))
+	_ = mw.Close()
+
+	req, _ := http.NewRequest("POST", "/admin/reservations-import", &body)
+	req = req.WithContext(getCtx(req))
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.PostAdminImportReservations)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Import 1 Reservations") {
+		t.Errorf("failed upload: expected a preview, got %d", rr.Code)
+	}
+}
+
+func TestAdminSearch(t *testing.T) {
+	routes := getRoutes()
+
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/search?q=smith", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+
+	body := rr.Body.String()
+	past := strings.Index(body, "Past Stays")
+	if past < 0 {
+		t.Fatal("expected the results to be grouped")
+	}
+
+	if i := strings.Index(body, "ABCD2345"); i < 0 || i > past {
+		t.Error("expected the upcoming stay before the past stays")
+	}
+
+	if i := strings.Index(body, "WXYZ6789"); i < past {
+		t.Error("expected the stay that is over under past stays")
+	}
+
+	for q, expected := range map[string]string{
+		"nobody": "No reservations match",
+		"j":      "Type at least two characters",
+	} {
+		rr = httptest.NewRecorder()
+		routes.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/search?q="+q, nil))
+
+		if !strings.Contains(rr.Body.String(), expected) {
+			t.Errorf("%s: expected %q", q, expected)
+		}
+	}
+}
+
+func TestTimelineEvents(t *testing.T) {
+	routes := getRoutes()
+
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/reservations-timeline/events?start=2024-03-01T00:00:00Z&end=2024-04-01T00:00:00Z", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+
+	var events []timelineEvent
+	err := json.Unmarshal(rr.Body.Bytes(), &events)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("expected a stay and a block, got %d events", len(events))
+	}
+
+	stay := events[0]
+	if stay.Kind != "stay" || stay.Title != "John Smith" || stay.URL != "/admin/reservations/timeline/1/show" || stay.Start != "2024-03-01" {
+		t.Errorf("unexpected stay %+v", stay)
+	}
+
+	if events[1].Kind != "block" || events[1].ResourceId != "1" {
+		t.Errorf("unexpected block %+v", events[1])
+	}
+
+	for _, query := range []string{"", "?start=2024-03-01", "?start=2024-03-01&end=2024-04-01&room=x", "?start=2024-03-01&end=2023-03-01"} {
+		rr = httptest.NewRecorder()
+		routes.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/reservations-timeline/events"+query, nil))
+
+		if rr.Code != http.StatusBadRequest || rr.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%s: expected a json bad request, got %d", query, rr.Code)
+		}
+	}
+}
+
+func TestAdminRevokeSession(t *testing.T) {
+	// an admin logged in elsewhere
+	ctx, _ := session.Load(context.Background(), "")
+	session.Put(ctx, "user_id", 1)
+	token, _, err := session.Commit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes := getRoutes()
+
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/sessions", nil))
+	if !strings.Contains(rr.Body.String(), sessionId(token)) {
+		t.Error("expected the other session to be listed")
+	}
+	if strings.Contains(rr.Body.String(), token) {
+		t.Error("session token shown on the sessions page")
+	}
+
+	for _, id := range []string{sessionId(token), "unknown"} {
+		rr = httptest.NewRecorder()
+		routes.ServeHTTP(rr, httptest.NewRequest("POST", "/admin/sessions/"+id+"/revoke", nil))
+
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/sessions" {
+			t.Errorf("%s: expected a redirect to the sessions page, got %d %s", id, rr.Code, rr.Header().Get("Location"))
+		}
+	}
+
+	if _, found, _ := session.Store.Find(token); found {
+		t.Error("expected the session to be revoked")
+	}
+}
+
+func TestPostCSPReport(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		expectedCode int
+	}{
+		{"report", `{"csp-report":{"document-uri":"http://localhost/","violated-directive":"script-src","blocked-uri":"inline"}}`, http.StatusNoContent},
+		{"invalid", `not json`, http.StatusBadRequest},
+		{"too large", `{"csp-report":{"document-uri":"` + strings.Repeat("a", cspReportMaxBytes) + `"}}`, http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/csp-report", strings.NewReader(e.body))
+		req.Header.Set("Content-Type", "application/csp-report")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostCSPReport)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedCode, rr.Code)
+		}
 	}
 }
 
@@ -7,14 +7,17 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/psanodiya94/gobooking.com/internal/config"
+	"github.com/psanodiya94/gobooking.com/internal/helpers"
+	"github.com/psanodiya94/gobooking.com/internal/logging"
 	"github.com/psanodiya94/gobooking.com/internal/models"
 	"github.com/psanodiya94/gobooking.com/internal/render"
+	"html/template"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
 	"testing"
-	"text/template"
 	"time"
 )
 
@@ -27,8 +30,7 @@ var functions = template.FuncMap{
 
 var app config.AppConfig
 var session *scs.SessionManager
-var infoLog *log.Logger
-var errorLog *log.Logger
+var logger *slog.Logger
 var templatePath = "./../../templates"
 
 func TestMain(m *testing.M) {
@@ -37,13 +39,12 @@ func TestMain(m *testing.M) {
 	gob.Register(models.Reservation{})
 	gob.Register(models.Restriction{})
 	gob.Register(map[string]int{})
+	gob.Register(time.Time{})
 
-	// initialize loggers
-	infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	errorLog = log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+	// initialize logger
+	logger = logging.New(os.Stdout, "text", slog.LevelInfo)
 
-	app.InfoLog = infoLog
-	app.ErrorLog = errorLog
+	app.Logger = logger
 
 	// change this to true when in production
 	app.InProduction = false
@@ -62,6 +63,13 @@ func TestMain(m *testing.M) {
 
 	listenForMail()
 
+	smsChan := make(chan models.SMSData)
+	app.SMSChan = smsChan
+	app.SMSCountryCode = "1"
+	defer close(smsChan)
+
+	listenForSMS()
+
 	tmplCache, err := CreateTestTemplateCache()
 	if err != nil {
 		log.Fatal("Cannot create template cache")
@@ -71,6 +79,7 @@ func TestMain(m *testing.M) {
 
 	repo := NewTestRepo(&app)
 	NewHandlers(repo)
+	helpers.NewHelpers(&app)
 	render.NewRenderer(&app)
 
 	os.Exit(m.Run())
@@ -84,6 +93,14 @@ func listenForMail() {
 	}()
 }
 
+func listenForSMS() {
+	go func() {
+		for {
+			_ = <-app.SMSChan
+		}
+	}()
+}
+
 func getRoutes() http.Handler {
 	mux := chi.NewRouter()
 
@@ -114,8 +131,18 @@ func getRoutes() http.Handler {
 	mux.Get("/user/logout", Repo.GetLogout)
 
 	mux.Get("/admin/dashboard", Repo.GetAdminDashboard)
+	mux.Get("/admin/dashboard/json", Repo.GetAdminDashboardJSON)
+	mux.Get("/admin/reports/{report}", Repo.GetAdminReport)
+	mux.Get("/admin/reports/{report}/csv", Repo.GetAdminReportCSV)
+	mux.Post("/admin/reports/{report}/{id}/check-in", Repo.PostAdminCheckIn)
+	mux.Post("/admin/reports/{report}/{id}/check-out", Repo.PostAdminCheckOut)
 	mux.Get("/admin/reservations-all", Repo.GetAdminAllReservations)
 	mux.Get("/admin/reservations-new", Repo.GetAdminNewReservations)
+	mux.Get("/admin/reservations-json", Repo.GetAdminReservationsJSON)
+	mux.Get("/admin/reservations-csv", Repo.GetAdminReservationsCSV)
+	mux.Get("/admin/reservations-import", Repo.GetAdminImportReservations)
+	mux.Post("/admin/reservations-import", Repo.PostAdminImportReservations)
+	mux.Get("/admin/search", Repo.GetAdminSearch)
 
 	mux.Get("/admin/process-reservations/{src}/{id}/do", Repo.GetAdminProcessReservation)
 	mux.Get("/admin/delete-reservations/{src}/{id}/do", Repo.GetAdminDeleteReservation)
@@ -126,6 +153,28 @@ func getRoutes() http.Handler {
 	mux.Get("/admin/reservations-calendar", Repo.GetAdminReservationsCalendar)
 	mux.Post("/admin/reservations-calendar", Repo.PostAdminReservationsCalendar)
 
+	mux.Get("/admin/reservations-timeline", Repo.GetAdminReservationsTimeline)
+	mux.Get("/admin/reservations-timeline/events", Repo.GetAdminTimelineEvents)
+	mux.Get("/admin/reservations-timeline/rooms", Repo.GetAdminTimelineRooms)
+
+	mux.Get("/admin/blocks", Repo.GetAdminBlocks)
+	mux.Get("/admin/blocks/new", Repo.GetAdminNewBlock)
+	mux.Post("/admin/blocks/new", Repo.PostAdminNewBlock)
+	mux.Get("/admin/blocks/{id}/edit", Repo.GetAdminEditBlock)
+	mux.Post("/admin/blocks/{id}/edit", Repo.PostAdminEditBlock)
+	mux.Post("/admin/blocks/{id}/delete", Repo.PostAdminDeleteBlock)
+	mux.Post("/admin/block-rules/{id}/delete", Repo.PostAdminDeleteBlockRule)
+
+	mux.Get("/admin/restrictions", Repo.GetAdminRestrictions)
+	mux.Get("/admin/restrictions/new", Repo.GetAdminNewRestriction)
+	mux.Post("/admin/restrictions/new", Repo.PostAdminNewRestriction)
+	mux.Get("/admin/restrictions/{id}/edit", Repo.GetAdminEditRestriction)
+	mux.Post("/admin/restrictions/{id}/edit", Repo.PostAdminEditRestriction)
+	mux.Post("/admin/restrictions/{id}/delete", Repo.PostAdminDeleteRestriction)
+
+	mux.Get("/admin/sessions", Repo.GetAdminSessions)
+	mux.Post("/admin/sessions/{id}/revoke", Repo.PostAdminRevokeSession)
+
 	FileServer := http.FileServer(http.Dir(filepath.Join(".", "static")))
 	mux.Handle("/static/*", http.StripPrefix("/static", FileServer))
 
@@ -0,0 +1,190 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Check reports an error if a component the app depends on is not working
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker serves the liveness and readiness probes
+type Checker struct {
+	Logger  *slog.Logger
+	Timeout time.Duration
+	checks  []namedCheck
+}
+
+// ComponentStatus is the readiness of one component
+type ComponentStatus struct {
+	Status string `json:"status"`
+}
+
+// Status is the response body of the probes
+type Status struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components,omitempty"`
+}
+
+// Statuses reported by the probes
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// New creates a checker that gives every readiness check timeout to complete
+func New(logger *slog.Logger, timeout time.Duration) *Checker {
+	return &Checker{
+		Logger:  logger,
+		Timeout: timeout,
+	}
+}
+
+// Add registers a check run by the readiness probe
+func (c *Checker) Add(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Healthz reports that the process is alive and serving requests
+func (c *Checker) Healthz(w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, http.StatusOK, Status{Status: StatusOK})
+}
+
+// Readyz runs every check and reports whether the app can serve traffic
+func (c *Checker) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), c.Timeout)
+	defer cancel()
+
+	status := Status{
+		Status:     StatusOK,
+		Components: make(map[string]ComponentStatus, len(c.checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, nc := range c.checks {
+		wg.Add(1)
+		go func(nc namedCheck) {
+			defer wg.Done()
+
+			err := nc.check(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				// the reason is only logged, probes are served without auth
+				c.Logger.WarnContext(r.Context(), "readiness check failed", "component", nc.name, "error", err)
+				status.Status = StatusUnavailable
+				status.Components[nc.name] = ComponentStatus{Status: StatusUnavailable}
+				return
+			}
+			status.Components[nc.name] = ComponentStatus{Status: StatusOK}
+		}(nc)
+	}
+	wg.Wait()
+
+	code := http.StatusOK
+	if status.Status != StatusOK {
+		code = http.StatusServiceUnavailable
+	}
+
+	writeStatus(w, code, status)
+}
+
+func writeStatus(w http.ResponseWriter, code int, status Status) {
+	out, _ := json.MarshalIndent(status, "", "  ")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_, _ = w.Write(out)
+}
+
+// Database checks the database answers a ping
+func Database(db *sql.DB) Check {
+	return func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}
+}
+
+// Dial checks a tcp connection can be opened to addr
+func Dial(addr string) Check {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// Loaded checks that loaded returns true, e.g. that a template cache is populated
+func Loaded(what string, loaded func() bool) Check {
+	return func(ctx context.Context) error {
+		if !loaded() {
+			return fmt.Errorf("%s not loaded", what)
+		}
+		return nil
+	}
+}
+
+// Migrations checks the database schema is at the version of the newest
+// migration in fsys
+func Migrations(db *sql.DB, fsys fs.FS) Check {
+	return func(ctx context.Context) error {
+		expected, err := LatestMigration(fsys)
+		if err != nil {
+			return err
+		}
+
+		var version string
+		err = db.QueryRowContext(ctx, `select version from schema_migration order by version desc limit 1`).Scan(&version)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("no migrations have been run")
+		}
+		if err != nil {
+			return err
+		}
+
+		if version != expected {
+			return fmt.Errorf("database is at migration %s, expected %s", version, expected)
+		}
+
+		return nil
+	}
+}
+
+// LatestMigration returns the version of the newest migration in fsys
+func LatestMigration(fsys fs.FS) (string, error) {
+	files, err := fs.Glob(fsys, "*.up.*")
+	if err != nil {
+		return "", err
+	}
+
+	if len(files) == 0 {
+		return "", errors.New("no migrations found")
+	}
+
+	sort.Strings(files)
+	version, _, _ := strings.Cut(files[len(files)-1], "_")
+
+	return version, nil
+}
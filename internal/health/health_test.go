@@ -0,0 +1,149 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/psanodiya94/gobooking.com/internal/logging"
+	"github.com/psanodiya94/gobooking.com/migrations"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newChecker() *Checker {
+	return New(logging.New(os.Stdout, "text", slog.LevelInfo), time.Second)
+}
+
+func readStatus(t *testing.T, rr *httptest.ResponseRecorder) Status {
+	var status Status
+	err := json.Unmarshal(rr.Body.Bytes(), &status)
+	if err != nil {
+		t.Fatalf("response is not json: %v", err)
+	}
+	return status
+}
+
+func TestHealthz(t *testing.T) {
+	c := newChecker()
+	c.Add("broken", func(ctx context.Context) error { return errors.New("down") })
+
+	rr := httptest.NewRecorder()
+	c.Healthz(rr, httptest.NewRequest("GET", "/healthz", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("liveness should not run the readiness checks, got status %d", rr.Code)
+	}
+
+	if readStatus(t, rr).Status != StatusOK {
+		t.Error("expected status ok")
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	c := newChecker()
+	c.Add("database", func(ctx context.Context) error { return nil })
+	c.Add("mail", func(ctx context.Context) error { return nil })
+
+	rr := httptest.NewRecorder()
+	c.Readyz(rr, httptest.NewRequest("GET", "/readyz", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", rr.Code)
+	}
+
+	status := readStatus(t, rr)
+	if status.Status != StatusOK || len(status.Components) != 2 {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	c.Add("templates", Loaded("template cache", func() bool { return false }))
+
+	rr = httptest.NewRecorder()
+	c.Readyz(rr, httptest.NewRequest("GET", "/readyz", nil))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503, got %d", rr.Code)
+	}
+
+	status = readStatus(t, rr)
+	if status.Status != StatusUnavailable || status.Components["templates"].Status != StatusUnavailable || status.Components["database"].Status != StatusOK {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestReadyz_Timeout(t *testing.T) {
+	c := newChecker()
+	c.Timeout = 10 * time.Millisecond
+	c.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	rr := httptest.NewRecorder()
+	c.Readyz(rr, httptest.NewRequest("GET", "/readyz", nil))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected a check that times out to fail, got status %d", rr.Code)
+	}
+}
+
+func TestDial(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Dial(l.Addr().String())(context.Background())
+	if err != nil {
+		t.Errorf("expected to reach the listener: %v", err)
+	}
+
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	err = Dial(addr)(context.Background())
+	if err == nil {
+		t.Error("expected an error dialing a closed port")
+	}
+}
+
+func TestLatestMigration(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"20250101000000_create_users.up.fizz",
+		"20250101000000_create_users.down.fizz",
+		"20250201000000_add_rooms.up.fizz",
+		"20250201000000_add_rooms.down.fizz",
+	} {
+		err := os.WriteFile(filepath.Join(dir, name), nil, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	version, err := LatestMigration(os.DirFS(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != "20250201000000" {
+		t.Errorf("expected 20250201000000, got %s", version)
+	}
+
+	_, err = LatestMigration(os.DirFS(t.TempDir()))
+	if err == nil {
+		t.Error("expected an error for a folder without migrations")
+	}
+
+	// the embedded migrations must parse too
+	_, err = LatestMigration(migrations.FS)
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -1,8 +1,12 @@
 package helpers
 
 import (
-	"fmt"
+	"crypto/rand"
+	"github.com/go-chi/chi/v5"
 	"github.com/psanodiya94/gobooking.com/internal/config"
+	"github.com/psanodiya94/gobooking.com/internal/logging"
+	"github.com/psanodiya94/gobooking.com/internal/render"
+	"log/slog"
 	"net/http"
 	"runtime/debug"
 )
@@ -15,17 +19,33 @@ func NewHelpers(a *config.AppConfig) {
 }
 
 // ClientError logs client side error
-func ClientError(w http.ResponseWriter, status int) {
-	app.InfoLog.Println("Client error with status of", status)
-	http.Error(w, http.StatusText(status), status)
+func ClientError(w http.ResponseWriter, r *http.Request, status int) {
+	attrs := append(requestAttrs(r), slog.Int("status", status))
+	app.Logger.LogAttrs(r.Context(), slog.LevelWarn, "client error", attrs...)
+
+	render.ErrorPage(w, r, status)
 }
 
 // ServerError logs server side error
-func ServerError(w http.ResponseWriter, err error) {
-	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
-	app.ErrorLog.Println(trace)
+func ServerError(w http.ResponseWriter, r *http.Request, err error) {
+	attrs := append(requestAttrs(r),
+		slog.String("error", err.Error()),
+		slog.Any("error_chain", logging.ErrorChain(err)),
+		slog.String("stack", string(debug.Stack())),
+	)
+	app.Logger.LogAttrs(r.Context(), slog.LevelError, "server error", attrs...)
+
+	render.ErrorPage(w, r, http.StatusInternalServerError)
+}
 
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+// LogError logs an error that a handler has dealt with itself, e.g. by
+// showing the user a flash message
+func LogError(r *http.Request, msg string, err error) {
+	attrs := append(requestAttrs(r),
+		slog.String("error", err.Error()),
+		slog.Any("error_chain", logging.ErrorChain(err)),
+	)
+	app.Logger.LogAttrs(r.Context(), slog.LevelWarn, msg, attrs...)
 }
 
 // IsAuthenticated returns true if user is authenticated
@@ -33,3 +53,50 @@ func IsAuthenticated(r *http.Request) bool {
 	exists := app.Session.Exists(r.Context(), "user_id")
 	return exists
 }
+
+// confirmationAlphabet leaves out letters and digits that are easily confused
+// when read out over the phone
+const confirmationAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// ConfirmationCode returns a random eight character reservation code
+func ConfirmationCode() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+
+	for i := range b {
+		b[i] = confirmationAlphabet[int(b[i])%len(confirmationAlphabet)]
+	}
+
+	return string(b)
+}
+
+// requestAttrs describes the request for error logs
+func requestAttrs(r *http.Request) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+	}
+
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		attrs = append(attrs, slog.String("route", rctx.RoutePattern()))
+	}
+
+	if id, ok := userID(r); ok {
+		attrs = append(attrs, slog.Int("user_id", id))
+	}
+
+	return attrs
+}
+
+// userID returns the logged in user, if the session has been loaded for r
+func userID(r *http.Request) (id int, ok bool) {
+	// scs panics when asked about a request it has not loaded a session for
+	defer func() {
+		if recover() != nil {
+			id, ok = 0, false
+		}
+	}()
+
+	id = app.Session.GetInt(r.Context(), "user_id")
+	return id, id != 0
+}
@@ -0,0 +1,113 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := New(buf, "json", slog.LevelInfo)
+
+	logger.Debug("hidden")
+	logger.With("component", "test").InfoContext(WithRequestID(context.Background(), "abc123"), "hello", "n", 1)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected one log line, got %d: %s", len(lines), buf.String())
+	}
+
+	var record map[string]interface{}
+	err := json.Unmarshal([]byte(lines[0]), &record)
+	if err != nil {
+		t.Fatalf("log line is not json: %v", err)
+	}
+
+	for key, want := range map[string]interface{}{
+		"msg":        "hello",
+		"request_id": "abc123",
+		"component":  "test",
+		"n":          float64(1),
+	} {
+		if record[key] != want {
+			t.Errorf("expected %s to be %v, got %v", key, want, record[key])
+		}
+	}
+}
+
+func TestNew_Text(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := New(buf, "text", slog.LevelInfo)
+
+	logger.Info("hello")
+
+	if !strings.Contains(buf.String(), "msg=hello") {
+		t.Errorf("expected a text log line, got %s", buf.String())
+	}
+
+	if strings.Contains(buf.String(), "request_id") {
+		t.Error("request id logged without one in the context")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("warn")
+	if err != nil || level != slog.LevelWarn {
+		t.Errorf("expected warn, got %v (%v)", level, err)
+	}
+
+	_, err = ParseLevel("loud")
+	if err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	if RequestID(context.Background()) != "" {
+		t.Error("expected no request id in an empty context")
+	}
+
+	id := NewRequestID()
+	if !ValidRequestID(id) {
+		t.Errorf("generated request id %q is not valid", id)
+	}
+
+	if RequestID(WithRequestID(context.Background(), id)) != id {
+		t.Error("request id not read back from the context")
+	}
+
+	for _, id := range []string{"", "has space", "new\nline", strings.Repeat("a", 65)} {
+		if ValidRequestID(id) {
+			t.Errorf("expected %q to be rejected", id)
+		}
+	}
+}
+
+func TestErrorChain(t *testing.T) {
+	root := errors.New("connection refused")
+	err := fmt.Errorf("insert reservation: %w", root)
+
+	chain := ErrorChain(err)
+	if len(chain) != 2 {
+		t.Fatalf("expected 2 errors in the chain, got %v", chain)
+	}
+
+	if !strings.Contains(chain[0], "insert reservation") || !strings.Contains(chain[1], "connection refused") {
+		t.Errorf("unexpected chain %v", chain)
+	}
+
+	chain = ErrorChain(errors.Join(errors.New("first"), err))
+	if len(chain) != 4 {
+		t.Errorf("expected the joined errors in the chain, got %v", chain)
+	}
+
+	if ErrorChain(nil) != nil {
+		t.Error("expected no chain for a nil error")
+	}
+}
@@ -0,0 +1,185 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/psanodiya94/gobooking.com/internal/assets"
+	"github.com/psanodiya94/gobooking.com/internal/config"
+	"github.com/psanodiya94/gobooking.com/internal/models"
+	"html"
+	"html/template"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Names of the email templates in the templates/emails folder
+const (
+	ReservationConfirmation = "reservation-confirmation.email.tmpl"
+	ReservationNotification = "reservation-notification.email.tmpl"
+	ReservationCancellation = "reservation-cancellation.email.tmpl"
+	ReservationReminder     = "reservation-reminder.email.tmpl"
+	ReservationWelcome      = "reservation-welcome.email.tmpl"
+	ReservationThankYou     = "reservation-thank-you.email.tmpl"
+	DailyDigest             = "daily-digest.email.tmpl"
+)
+
+var functions = template.FuncMap{
+	"readableDate": ReadableDate,
+	"formatDate":   FormatDate,
+}
+
+var app *config.AppConfig
+
+// the emails read from disk when app.UseCache is false
+var devCache = assets.NewCache(CreateTemplateCache)
+
+// ReservationData is the data used by the reservation email templates
+type ReservationData struct {
+	Reservation models.Reservation
+}
+
+// ReminderData is the data used by the pre-arrival reminder email
+type ReminderData struct {
+	Reservation models.Reservation
+	Days        int
+}
+
+// WelcomeData is the data used by the check-in day welcome email
+type WelcomeData struct {
+	Reservation  models.Reservation
+	Instructions string
+}
+
+// DigestData is the data used by the owner's daily digest email
+type DigestData struct {
+	Date            time.Time
+	Arrivals        []models.Reservation
+	Departures      []models.Reservation
+	InHouse         []models.Reservation
+	NewReservations []models.Reservation
+	Cancellations   []models.Cancellation
+	Occupancy       []models.Occupancy
+}
+
+// ReadableDate returns time in YYYY-MM-DD format
+func ReadableDate(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// FormatDate formate date with string
+func FormatDate(t time.Time, f string) string {
+	return t.Format(f)
+}
+
+// NewMailer sets the config for the mailer package
+func NewMailer(a *config.AppConfig) {
+	app = a
+}
+
+// Render executes the named email template with data and returns the html
+// body along with a plain text alternative generated from it
+func Render(name string, data interface{}) (string, string, error) {
+	tmplCache, err := templateCache()
+	if err != nil {
+		return "", "", err
+	}
+
+	t, ok := tmplCache[name]
+	if !ok {
+		return "", "", fmt.Errorf("could not get email template %s from cache", name)
+	}
+
+	htmlBuf := new(bytes.Buffer)
+	err = t.Execute(htmlBuf, data)
+	if err != nil {
+		return "", "", err
+	}
+
+	// the text part is built from the body only, so the layout styles stay out of it
+	bodyBuf := new(bytes.Buffer)
+	err = t.ExecuteTemplate(bodyBuf, "body", data)
+	if err != nil {
+		return "", "", err
+	}
+
+	return htmlBuf.String(), HTMLToText(bodyBuf.String()), nil
+}
+
+var (
+	lineBreaks = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</h[1-6]>|</tr>|</li>`)
+	tags       = regexp.MustCompile(`<[^>]*>`)
+	spaces     = regexp.MustCompile(`\s+`)
+)
+
+// HTMLToText converts an html fragment to plain text
+func HTMLToText(s string) string {
+	// whitespace in html collapses, only the break tags start new lines
+	s = spaces.ReplaceAllString(s, " ")
+	s = lineBreaks.ReplaceAllString(s, "\n")
+	s = tags.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" && (len(lines) == 0 || lines[len(lines)-1] == "") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// templateCache returns the email template cache from the app config, or
+// when it is not in use, the templates read from disk, parsed again only
+// after a file has changed
+func templateCache() (map[string]*template.Template, error) {
+	if app.UseCache {
+		return app.EmailTemplateCache, nil
+	}
+
+	return devCache.Get(app.Templates)
+}
+
+// CreateTemplateCache creates the email template cache from the emails folder of fsys
+func CreateTemplateCache(fsys fs.FS) (map[string]*template.Template, error) {
+	cache := map[string]*template.Template{}
+
+	// get all the files name in the emails folder
+	emails, err := fs.Glob(fsys, "emails/*.email.tmpl")
+	if err != nil {
+		return cache, err
+	}
+
+	layouts, err := fs.Glob(fsys, "emails/*.layout.tmpl")
+	if err != nil {
+		return cache, err
+	}
+
+	if len(layouts) == 0 {
+		return cache, errors.New("no email layouts found")
+	}
+
+	// range through all files ending with *.email.tmpl
+	for _, email := range emails {
+		name := path.Base(email)
+		ts, err := template.New(name).Funcs(functions).ParseFS(fsys, email)
+		if err != nil {
+			return cache, err
+		}
+
+		ts, err = ts.ParseFS(fsys, layouts...)
+		if err != nil {
+			return cache, err
+		}
+
+		cache[name] = ts
+	}
+
+	return cache, nil
+}
@@ -0,0 +1,88 @@
+package mailer
+
+import (
+	"github.com/psanodiya94/gobooking.com/internal/models"
+	"github.com/psanodiya94/gobooking.com/templates"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateTemplateCache(t *testing.T) {
+	cache, err := CreateTemplateCache(templates.FS)
+	if err != nil {
+		t.Error(err)
+	}
+
+	for _, name := range []string{ReservationConfirmation, ReservationNotification, ReservationCancellation, ReservationReminder, ReservationWelcome, ReservationThankYou, DailyDigest} {
+		if _, ok := cache[name]; !ok {
+			t.Errorf("email template %s not found in cache", name)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	data := ReservationData{
+		Reservation: models.Reservation{
+			FirstName: "<script>alert('x')</script>",
+			LastName:  "Smith",
+			CheckIn:   time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+			CheckOut:  time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+			Room:      models.Room{RoomName: "General's Quarters"},
+		},
+	}
+
+	htmlBody, textBody, err := Render(ReservationConfirmation, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(htmlBody, "<script>") {
+		t.Error("guest name was not escaped in html body")
+	}
+
+	if !strings.Contains(htmlBody, "&lt;script&gt;") {
+		t.Error("escaped guest name not found in html body")
+	}
+
+	if strings.Contains(textBody, "<strong>") {
+		t.Error("text body contains html tags")
+	}
+
+	if !strings.Contains(textBody, "from 2050-01-01 to 2050-01-02") {
+		t.Errorf("text body is missing the dates: %s", textBody)
+	}
+
+	_, _, err = Render("non.email.tmpl", data)
+	if err == nil {
+		t.Error("rendered an email template that does not exist")
+	}
+}
+
+func TestHTMLToText(t *testing.T) {
+	got := HTMLToText("<strong>Hello</strong><br>\n   Dear   John,<br>Tom &amp; Jerry")
+	want := "Hello\nDear John,\nTom & Jerry"
+	if got != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+}
+
+func TestRenderDailyDigest(t *testing.T) {
+	today := time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+	data := DigestData{
+		Date:      today,
+		Arrivals:  []models.Reservation{{FirstName: "John", LastName: "Smith", CheckOut: today.AddDate(0, 0, 2)}},
+		Occupancy: []models.Occupancy{{Date: today, Occupied: 1, Rooms: 2}},
+	}
+
+	_, textBody, err := Render(DailyDigest, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"Arrivals today (1)", "John Smith", "Departures today (0)", "1 of 2 rooms (50%)"} {
+		if !strings.Contains(textBody, want) {
+			t.Errorf("digest is missing %q:\n%s", want, textBody)
+		}
+	}
+}
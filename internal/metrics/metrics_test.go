@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	RegisterQueue("test", func() int { return 3 })
+	ObserveQuery("AllRooms", time.Now())
+	ReservationsCreated.Inc()
+
+	rr := httptest.NewRecorder()
+	Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("expected the prometheus text format, got %s", rr.Header().Get("Content-Type"))
+	}
+
+	body := rr.Body.String()
+	for _, want := range []string{
+		`gobooking_message_queue_depth{channel="test"} 3`,
+		`gobooking_db_query_duration_seconds_count{method="AllRooms"} 1`,
+		`gobooking_reservations_created_total 1`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in metrics output", want)
+		}
+	}
+}
@@ -27,11 +27,22 @@ type Room struct {
 // Restriction is the restriction model
 type Restriction struct {
 	Id              int
+	Code            string
 	RestrictionName string
-	CreatedAt       time.Time
-	UpdatedAt       time.Time
+	// Colour is the css colour the restriction is shown in on the calendars
+	Colour string
+	// Occupancy is true if rooms with the restriction count as occupied
+	Occupancy bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
+// Codes of the restrictions the app relies on
+const (
+	RestrictionReservation = "reservation"
+	RestrictionOwner       = "owner"
+)
+
 // Reservation is the reservation model
 type Reservation struct {
 	Id        int
@@ -46,6 +57,53 @@ type Reservation struct {
 	UpdatedAt time.Time
 	Room      Room
 	Processed int
+	SMSOptIn  bool
+	// Source is where the reservation was made
+	Source string
+	// ConfirmationCode is the code guests quote to find their reservation
+	ConfirmationCode string
+	// CheckedInAt and CheckedOutAt are when the front desk checked the guest
+	// in and out, zero until then
+	CheckedInAt  time.Time
+	CheckedOutAt time.Time
+}
+
+// Reservation sources
+const (
+	SourceWeb    = "web"
+	SourceImport = "import"
+)
+
+// Sources are the places reservations can be made from
+var Sources = []string{SourceWeb, SourceImport}
+
+// Reservation list sort orders
+const (
+	SortArrival = "arrival"
+	SortCreated = "created"
+	SortName    = "name"
+)
+
+// Reservation statuses
+const (
+	StatusNew       = "new"
+	StatusProcessed = "processed"
+)
+
+// ReservationFilter selects and orders a page of reservations. Zero values
+// don't filter.
+type ReservationFilter struct {
+	// From and To limit the check in date, inclusive
+	From   time.Time
+	To     time.Time
+	RoomId int
+	Status string
+	Source string
+	Sort   string
+	Desc   bool
+	// Page counts from 1. A PerPage of 0 returns every reservation.
+	Page    int
+	PerPage int
 }
 
 // RoomRestriction is room_restriction model
@@ -56,12 +114,145 @@ type RoomRestriction struct {
 	RoomId        int
 	ReservationId int
 	RestrictionId int
+	Note          string
+	BlockRuleId   int
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
+	Room          Room
 	Reservation   Reservation
 	Restriction   Restriction
 }
 
+// Block rule frequencies
+const (
+	Weekly = "weekly"
+	Yearly = "yearly"
+)
+
+// BlockRule repeats a block every week or every year. StartDate and EndDate
+// are the first night and the day after the last night of the first block.
+type BlockRule struct {
+	Id            int
+	RoomId        int
+	RestrictionId int
+	Note          string
+	Frequency     string
+	StartDate     time.Time
+	EndDate       time.Time
+	Until         time.Time
+	// BlockedUntil is how far ahead the rule's blocks have been made
+	BlockedUntil time.Time
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Room         Room
+	Restriction  Restriction
+}
+
+// ReservationNotification records a scheduled email sent for a reservation
+type ReservationNotification struct {
+	Id            int
+	ReservationId int
+	Kind          string
+	SentAt        time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// Cancellation is a copy of a reservation kept when it is deleted
+type Cancellation struct {
+	Id            int
+	ReservationId int
+	FirstName     string
+	LastName      string
+	Email         string
+	Phone         string
+	CheckIn       time.Time
+	CheckOut      time.Time
+	RoomId        int
+	Room          Room
+	CancelledAt   time.Time
+}
+
+// Occupancy is the number of rooms occupied on a date
+type Occupancy struct {
+	Date     time.Time
+	Occupied int
+	Rooms    int
+}
+
+// Percent returns the occupancy rate as a percentage
+func (o Occupancy) Percent() int {
+	if o.Rooms == 0 {
+		return 0
+	}
+	return o.Occupied * 100 / o.Rooms
+}
+
+// DashboardStats are the counts shown on the admin dashboard for a day
+type DashboardStats struct {
+	ArrivalsToday   int
+	DeparturesToday int
+	NewReservations int
+	// Bookings and Cancellations are those made in the 30 days up to the day
+	Bookings      int
+	Cancellations int
+	// LeadTimeDays is the average days from booking to arrival of Bookings
+	LeadTimeDays float64
+	// LeadTimes counts Bookings by days from booking to arrival: under a week,
+	// under 30 days, under 90 days and longer
+	LeadTimes [4]int
+}
+
+// CancellationPercent returns the share of the bookings made that were cancelled
+func (s DashboardStats) CancellationPercent() int {
+	if s.Bookings+s.Cancellations == 0 {
+		return 0
+	}
+	return s.Cancellations * 100 / (s.Bookings + s.Cancellations)
+}
+
+// Revenue is what the rooms that have a nightly rate earn over a range of nights
+type Revenue struct {
+	// RoomNights is the nights booked in rooms with a rate
+	RoomNights int
+	// AvailableNights is the nights of all the rooms with a rate
+	AvailableNights int
+	Revenue         float64
+}
+
+// Rated reports whether any room has a rate
+func (r Revenue) Rated() bool {
+	return r.AvailableNights > 0
+}
+
+// ADR returns the average daily rate, the revenue per night booked
+func (r Revenue) ADR() float64 {
+	if r.RoomNights == 0 {
+		return 0
+	}
+	return r.Revenue / float64(r.RoomNights)
+}
+
+// RevPAR returns the revenue per available room night
+func (r Revenue) RevPAR() float64 {
+	if r.AvailableNights == 0 {
+		return 0
+	}
+	return r.Revenue / float64(r.AvailableNights)
+}
+
+// Session describes an active session for the admin sessions page
+type Session struct {
+	Id         string
+	UserId     int
+	User       User
+	UserAgent  string
+	LoggedInAt time.Time
+	Expiry     time.Time
+	Reserving  bool
+	Current    bool
+}
+
 // MailData holds an email message
 type MailData struct {
 	To       string
@@ -69,4 +260,15 @@ type MailData struct {
 	Subject  string
 	Content  string
 	Template string
+	Data     interface{}
+	// Failed, if set, is called when the email can't be sent
+	Failed func(err error)
+}
+
+// SMSData holds a text message
+type SMSData struct {
+	To       string
+	Content  string
+	Template string
+	Data     interface{}
 }
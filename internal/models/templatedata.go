@@ -9,6 +9,7 @@ type TemplateData struct {
 	IntMap    map[string]int
 	Data      map[string]interface{}
 	CSRFToken string
+	Nonce     string
 	Flash     string
 	Warning   string
 	Error     string
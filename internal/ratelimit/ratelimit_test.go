@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	l := New("test", 60, 2)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d within the burst was limited", i+1)
+		}
+	}
+
+	ok, wait := l.Allow("a")
+	if ok {
+		t.Fatal("expected the request after the burst to be limited")
+	}
+	if wait != time.Second {
+		t.Errorf("expected to wait 1s for a token, got %s", wait)
+	}
+
+	// other clients have their own bucket
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("another client was limited")
+	}
+
+	now = now.Add(time.Second)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("expected a token to be added after a second")
+	}
+}
+
+func TestLimiter_Sweep(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	l := New("test", 60, 5)
+	l.now = func() time.Time { return now }
+
+	l.Allow("a")
+	now = now.Add(2 * sweepInterval)
+	l.Allow("b")
+
+	if _, ok := l.buckets["a"]; ok {
+		t.Error("expected the refilled bucket to be dropped")
+	}
+	if _, ok := l.buckets["b"]; !ok {
+		t.Error("expected the new bucket to be kept")
+	}
+}
+
+func TestParseProxies(t *testing.T) {
+	proxies, err := ParseProxies("10.0.0.0/8, 127.0.0.1 ::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proxies) != 3 {
+		t.Errorf("expected 3 proxies, got %d", len(proxies))
+	}
+
+	for _, bad := range []string{"10.0.0.0/99", "proxy.local"} {
+		if _, err := ParseProxies(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, _ := ParseProxies("10.0.0.0/8")
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		expected   string
+	}{
+		{"direct", "203.0.113.5:1234", "", "203.0.113.5"},
+		{"untrusted peer", "203.0.113.5:1234", "198.51.100.1", "203.0.113.5"},
+		{"trusted proxy", "10.0.0.1:1234", "198.51.100.1", "198.51.100.1"},
+		{"spoofed hop", "10.0.0.1:1234", "1.2.3.4, 198.51.100.1", "198.51.100.1"},
+		{"proxy chain", "10.0.0.1:1234", "198.51.100.1, 10.0.0.2", "198.51.100.1"},
+		{"garbage", "10.0.0.1:1234", "nonsense", "10.0.0.1"},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = e.remoteAddr
+		if e.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", e.forwarded)
+		}
+
+		if ip := proxies.ClientIP(req); ip != e.expected {
+			t.Errorf("%s: expected %s, got %s", e.name, e.expected, ip)
+		}
+	}
+}
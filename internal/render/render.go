@@ -5,12 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"github.com/justinas/nosurf"
+	"github.com/psanodiya94/gobooking.com/internal/assets"
 	"github.com/psanodiya94/gobooking.com/internal/config"
+	"github.com/psanodiya94/gobooking.com/internal/csp"
 	"github.com/psanodiya94/gobooking.com/internal/models"
-	"log"
+	"html/template"
+	"io/fs"
 	"net/http"
-	"path/filepath"
-	"text/template"
+	"path"
 	"time"
 )
 
@@ -22,7 +24,9 @@ var functions = template.FuncMap{
 }
 
 var app *config.AppConfig
-var templatePath = "./templates"
+
+// the pages read from disk when app.UseCache is false
+var devCache = assets.NewCache(CreateTemplateCache)
 
 // Add adds a & b and returns
 func Add(a, b int) int {
@@ -60,6 +64,7 @@ func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateDa
 	td.Error = app.Session.PopString(r.Context(), "error")
 	td.Warning = app.Session.PopString(r.Context(), "warning")
 	td.CSRFToken = nosurf.Token(r)
+	td.Nonce = csp.Nonce(r.Context())
 
 	if app.Session.Exists(r.Context(), "user_id") {
 		td.IsAuth = true
@@ -70,13 +75,9 @@ func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateDa
 
 // Template renders a template using html template
 func Template(w http.ResponseWriter, r *http.Request, tmpl string, tmplData *models.TemplateData) error {
-	var tmplCache map[string]*template.Template
-
-	if app.UseCache {
-		// get the t cache from the app config
-		tmplCache = app.TemplateCache
-	} else {
-		tmplCache, _ = CreateTemplateCache()
+	tmplCache, err := templateCache()
+	if err != nil {
+		return err
 	}
 
 	// get requested t from cache
@@ -89,42 +90,104 @@ func Template(w http.ResponseWriter, r *http.Request, tmpl string, tmplData *mod
 
 	tmplData = AddDefaultData(tmplData, r)
 
-	_ = t.Execute(buf, tmplData)
+	// nothing is written unless the whole page renders, so a broken
+	// template can still be answered with an error page
+	err = t.Execute(buf, tmplData)
+	if err != nil {
+		return fmt.Errorf("can't render template %s: %w", tmpl, err)
+	}
 
 	// render the t
-	_, err := buf.WriteTo(w)
+	_, err = buf.WriteTo(w)
 	if err != nil {
-		log.Println("Error writing t to browser", err)
+		app.Logger.ErrorContext(r.Context(), "can't write template to browser", "template", tmpl, "error", err)
 		return err
 	}
 
 	return nil
 }
 
-func CreateTemplateCache() (map[string]*template.Template, error) {
+// errorPages holds the title and message shown on the error page for each status
+var errorPages = map[int][2]string{
+	http.StatusForbidden:           {"Forbidden", "You don't have permission to do that."},
+	http.StatusNotFound:            {"Page not found", "The page you are looking for doesn't exist or has been moved."},
+	http.StatusMethodNotAllowed:    {"Method not allowed", "That page can't be used this way."},
+	http.StatusTooManyRequests:     {"Too many requests", "You're doing that too often, please wait a moment and try again."},
+	http.StatusInternalServerError: {"Something went wrong", "We couldn't complete your request, please try again in a moment."},
+}
+
+// ErrorPage renders the error page for status through the site layout. It
+// doesn't use the session, so it works from any middleware, and falls back
+// to a plain text response if the page itself can't be rendered.
+func ErrorPage(w http.ResponseWriter, r *http.Request, status int) {
+	page, ok := errorPages[status]
+	if !ok {
+		page = [2]string{http.StatusText(status), ""}
+	}
+
+	buf := new(bytes.Buffer)
+
+	tmplCache, err := templateCache()
+	if err == nil {
+		t, ok := tmplCache["error.page.tmpl"]
+		if !ok {
+			err = errors.New("could not get error page from cache")
+		} else {
+			err = t.Execute(buf, &models.TemplateData{
+				StringMap: map[string]string{"title": page[0], "message": page[1]},
+				IntMap:    map[string]int{"status": status},
+				Nonce:     csp.Nonce(r.Context()),
+			})
+		}
+	}
+
+	if err != nil {
+		app.Logger.ErrorContext(r.Context(), "can't render error page", "status", status, "error", err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = buf.WriteTo(w)
+}
+
+// templateCache returns the template cache from the app config, or when
+// it is not in use, the templates read from disk, parsed again only after
+// a file has changed
+func templateCache() (map[string]*template.Template, error) {
+	if app.UseCache {
+		return app.TemplateCache, nil
+	}
+
+	return devCache.Get(app.Templates)
+}
+
+// CreateTemplateCache creates the template cache from the pages and layouts in fsys
+func CreateTemplateCache(fsys fs.FS) (map[string]*template.Template, error) {
 	cache := map[string]*template.Template{}
 
 	// get all the files name in the templates folder
-	pages, err := filepath.Glob(fmt.Sprintf("%s/*.page.tmpl", templatePath))
+	pages, err := fs.Glob(fsys, "*.page.tmpl")
+	if err != nil {
+		return cache, err
+	}
+
+	layouts, err := fs.Glob(fsys, "*.layout.tmpl")
 	if err != nil {
 		return cache, err
 	}
 
 	// range through all files ending with *.page.tmpl
 	for _, page := range pages {
-		name := filepath.Base(page)
-		ts, err := template.New(name).Funcs(functions).ParseFiles(page)
-		if err != nil {
-			return cache, err
-		}
-
-		matches, err := filepath.Glob(fmt.Sprintf("%s/*.layout.tmpl", templatePath))
+		name := path.Base(page)
+		ts, err := template.New(name).Funcs(functions).ParseFS(fsys, page)
 		if err != nil {
 			return cache, err
 		}
 
-		if len(matches) > 0 {
-			ts, err = ts.ParseGlob(fmt.Sprintf("%s/*.layout.tmpl", templatePath))
+		if len(layouts) > 0 {
+			ts, err = ts.ParseFS(fsys, layouts...)
 			if err != nil {
 				return cache, err
 			}
@@ -1,9 +1,17 @@
 package render
 
 import (
+	"github.com/psanodiya94/gobooking.com/internal/csp"
+	"github.com/psanodiya94/gobooking.com/internal/forms"
 	"github.com/psanodiya94/gobooking.com/internal/models"
+	"github.com/psanodiya94/gobooking.com/templates"
+	"html/template"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 // TestAddDefaultData tests AddDefaultData function
@@ -24,8 +32,7 @@ func TestAddDefaultData(t *testing.T) {
 
 // TestTemplate tests for Template function
 func TestTemplate(t *testing.T) {
-	templatePath = "./../../templates"
-	templCache, err := CreateTemplateCache()
+	templCache, err := CreateTemplateCache(templates.FS)
 	if err != nil {
 		t.Error(err)
 	}
@@ -50,13 +57,178 @@ func TestTemplate(t *testing.T) {
 	}
 }
 
+// TestTemplate_EscapesGuestInput tests guest supplied values can't inject markup into admin pages
+func TestTemplate_EscapesGuestInput(t *testing.T) {
+	templCache, err := CreateTemplateCache(templates.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.TemplateCache = templCache
+
+	req, err := getSessionData()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// flash messages are written into a script block
+	session.Put(req.Context(), "error", `"); alert("flash`)
+
+	data := make(map[string]interface{})
+	data["reservations"] = models.Reservation{
+		Id:        1,
+		FirstName: `<script>alert("name")</script>`,
+		LastName:  `"><img src=x onerror=alert(1)>`,
+		Email:     "guest@here.com",
+		Phone:     `<b>555</b>`,
+		CheckIn:   time.Now(),
+		CheckOut:  time.Now(),
+		Room:      models.Room{RoomName: `<i>Suite</i>`},
+	}
+
+	rr := httptest.NewRecorder()
+	err = Template(rr, req, "admin-show-reservation.page.tmpl", &models.TemplateData{
+		StringMap: map[string]string{"src": "all"},
+		Data:      data,
+		Form:      forms.New(nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := rr.Body.String()
+	for _, injected := range []string{
+		`<script>alert("name")</script>`,
+		`<img src=x onerror=alert(1)>`,
+		`<b>555</b>`,
+		`<i>Suite</i>`,
+		`"); alert("flash`,
+	} {
+		if strings.Contains(body, injected) {
+			t.Errorf("guest input %s was not escaped", injected)
+		}
+	}
+
+	for _, escaped := range []string{
+		`&lt;script&gt;alert(&#34;name&#34;)&lt;/script&gt;`,
+		`&lt;i&gt;Suite&lt;/i&gt;`,
+		`notify("\"); alert(\"flash", "error")`,
+	} {
+		if !strings.Contains(body, escaped) {
+			t.Errorf("expected %s in the rendered page", escaped)
+		}
+	}
+}
+
+// TestTemplate_Nonce tests inline scripts carry the request's csp nonce
+func TestTemplate_Nonce(t *testing.T) {
+	templCache, err := CreateTemplateCache(templates.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.TemplateCache = templCache
+
+	req, err := getSessionData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = req.WithContext(csp.WithNonce(req.Context(), "test-nonce"))
+
+	rr := httptest.NewRecorder()
+	err = Template(rr, req, "majors.page.tmpl", &models.TemplateData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := rr.Body.String()
+	if strings.Contains(body, "<script>") {
+		t.Error("found an inline script without a nonce")
+	}
+
+	if !strings.Contains(body, `<script nonce="test-nonce">`) {
+		t.Error("expected the nonce on inline scripts")
+	}
+}
+
+// TestTemplate_ExecuteError tests a template that fails part way writes nothing
+func TestTemplate_ExecuteError(t *testing.T) {
+	templCache, err := CreateTemplateCache(fstest.MapFS{
+		"broken.page.tmpl": {Data: []byte(`<h1>half a page</h1>{{.Form.Errors.Get "name"}}`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.TemplateCache = templCache
+	app.UseCache = true
+	defer func() { app.UseCache = false }()
+
+	req, err := getSessionData()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	err = Template(rr, req, "broken.page.tmpl", &models.TemplateData{})
+	if err == nil {
+		t.Error("expected an error from a template that can't be executed")
+	}
+
+	if rr.Body.Len() != 0 {
+		t.Errorf("half rendered page written: %s", rr.Body.String())
+	}
+}
+
+func TestErrorPage(t *testing.T) {
+	req, err := getSessionData()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for status, title := range map[int]string{
+		http.StatusNotFound:            "Page not found",
+		http.StatusForbidden:           "Forbidden",
+		http.StatusInternalServerError: "Something went wrong",
+	} {
+		rr := httptest.NewRecorder()
+		ErrorPage(rr, req, status)
+
+		if rr.Code != status {
+			t.Errorf("expected status %d, got %d", status, rr.Code)
+		}
+
+		// rendered through the layout
+		if !strings.Contains(rr.Body.String(), "GoBooking.com") || !strings.Contains(rr.Body.String(), title) {
+			t.Errorf("%d: expected the themed error page with %q", status, title)
+		}
+	}
+}
+
+func TestErrorPage_Fallback(t *testing.T) {
+	app.TemplateCache = map[string]*template.Template{}
+	app.UseCache = true
+	defer func() { app.UseCache = false }()
+
+	req, err := getSessionData()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	ErrorPage(rr, req, http.StatusNotFound)
+
+	if rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), "Not Found") {
+		t.Errorf("expected a plain not found response, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
 func TestNewTemplates(t *testing.T) {
 	NewRenderer(app)
 }
 
 func TestCreateTemplateCache(t *testing.T) {
-	templatePath = "./../../templates"
-	_, err := CreateTemplateCache()
+	_, err := CreateTemplateCache(templates.FS)
 	if err != nil {
 		t.Error(err)
 	}
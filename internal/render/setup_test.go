@@ -4,8 +4,10 @@ import (
 	"encoding/gob"
 	"github.com/alexedwards/scs/v2"
 	"github.com/psanodiya94/gobooking.com/internal/config"
+	"github.com/psanodiya94/gobooking.com/internal/logging"
 	"github.com/psanodiya94/gobooking.com/internal/models"
-	"log"
+	"github.com/psanodiya94/gobooking.com/templates"
+	"log/slog"
 	"net/http"
 	"os"
 	"testing"
@@ -14,19 +16,16 @@ import (
 
 var session *scs.SessionManager
 var testApp config.AppConfig
-var infoLog *log.Logger
-var errorLog *log.Logger
+var logger *slog.Logger
 
 func TestMain(m *testing.M) {
 	// what am i going to put in the session
 	gob.Register(models.Reservation{})
 
-	// initialize loggers
-	infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	errorLog = log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+	// initialize logger
+	logger = logging.New(os.Stdout, "text", slog.LevelInfo)
 
-	testApp.InfoLog = infoLog
-	testApp.ErrorLog = errorLog
+	testApp.Logger = logger
 
 	// change this to true when in production
 	testApp.InProduction = false
@@ -38,6 +37,7 @@ func TestMain(m *testing.M) {
 	session.Cookie.Secure = false
 
 	testApp.Session = session
+	testApp.Templates = templates.FS
 
 	app = &testApp
 
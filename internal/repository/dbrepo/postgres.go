@@ -1,15 +1,25 @@
 package dbrepo
 
 import (
+	"cmp"
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"github.com/jackc/pgconn"
+	"github.com/psanodiya94/gobooking.com/internal/calendar"
+	"github.com/psanodiya94/gobooking.com/internal/metrics"
 	"github.com/psanodiya94/gobooking.com/internal/models"
+	"github.com/psanodiya94/gobooking.com/internal/repository"
 	"golang.org/x/crypto/bcrypt"
+	"strings"
 	"time"
 )
 
 // InsertReservation insert a reservation into database
 func (psql *dbPostgresRepo) InsertReservation(res models.Reservation) (int, error) {
+	defer metrics.ObserveQuery("InsertReservation", time.Now())
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -18,9 +28,9 @@ func (psql *dbPostgresRepo) InsertReservation(res models.Reservation) (int, erro
     				reservations (
                         first_name, last_name, email, phone, 
                         check_in, check_out, room_id, 
-                        created_at, updated_at
+                        created_at, updated_at, sms_opt_in, source, confirmation_code
             		) 
-			values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) returning id`
 	// indent on
 
 	var id int
@@ -35,6 +45,9 @@ func (psql *dbPostgresRepo) InsertReservation(res models.Reservation) (int, erro
 		res.RoomId,
 		time.Now(),
 		time.Now(),
+		res.SMSOptIn,
+		cmp.Or(res.Source, models.SourceWeb),
+		res.ConfirmationCode,
 	).Scan(&id)
 	if err != nil {
 		return 0, err
@@ -45,6 +58,8 @@ func (psql *dbPostgresRepo) InsertReservation(res models.Reservation) (int, erro
 
 // InsertRoomRestriction insert a room restriction into database
 func (psql *dbPostgresRepo) InsertRoomRestriction(res models.RoomRestriction) error {
+	defer metrics.ObserveQuery("InsertRoomRestriction", time.Now())
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -73,8 +88,124 @@ func (psql *dbPostgresRepo) InsertRoomRestriction(res models.RoomRestriction) er
 	return nil
 }
 
+// ImportReservations inserts reservations and their room restrictions in one
+// transaction. It returns repository.ErrConflict, changing nothing, if a
+// reservation overlaps another restriction or reuses a confirmation code, and
+// repository.ErrUnknownRestriction if there is no reservation restriction.
+// The rooms are locked like calendar edits lock them, so imports and calendar
+// edits of the same room are made one at a time.
+func (psql *dbPostgresRepo) ImportReservations(reservations []models.Reservation) error {
+	defer metrics.ObserveQuery("ImportReservations", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := psql.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var restrictionId int
+	err = tx.QueryRowContext(ctx, "select id from restrictions where code = $1;", models.RestrictionReservation).Scan(&restrictionId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repository.ErrUnknownRestriction
+	}
+	if err != nil {
+		return err
+	}
+
+	roomIds := make([]int, 0, len(reservations))
+	for _, res := range reservations {
+		roomIds = append(roomIds, res.RoomId)
+	}
+	err = lockRooms(ctx, tx, roomIds)
+	if err != nil {
+		return err
+	}
+
+	for _, res := range reservations {
+		// indent off
+		stmt := `
+				insert into
+				    reservations (
+				        first_name, last_name, email, phone, check_in, check_out, room_id,
+				        processed, source, confirmation_code, created_at, updated_at
+				    )
+				select
+				    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12
+				where not exists (
+				    select 1 from reservations where confirmation_code = $10
+				)
+				returning id;`
+		// indent on
+
+		var id int
+
+		err := tx.QueryRowContext(ctx, stmt,
+			res.FirstName,
+			res.LastName,
+			res.Email,
+			res.Phone,
+			res.CheckIn,
+			res.CheckOut,
+			res.RoomId,
+			res.Processed,
+			cmp.Or(res.Source, models.SourceImport),
+			res.ConfirmationCode,
+			time.Now(),
+			time.Now(),
+		).Scan(&id)
+		// a concurrent import can take the code after the check, which the
+		// unique index reports
+		var pgErr *pgconn.PgError
+		if errors.Is(err, sql.ErrNoRows) || (errors.As(err, &pgErr) && pgErr.Code == uniqueViolation) {
+			return repository.ErrConflict
+		}
+		if err != nil {
+			return err
+		}
+
+		// indent off
+		stmt = `
+				insert into
+				    room_restrictions (check_in, check_out, room_id, reservation_id, restriction_id, created_at, updated_at)
+				select
+				    $1, $2, $3, $4, $5, $6, $7
+				where not exists (
+				    select 1 from room_restrictions where room_id = $3 and check_in < $2 and check_out > $1
+				);`
+		// indent on
+
+		result, err := tx.ExecContext(ctx, stmt,
+			res.CheckIn,
+			res.CheckOut,
+			res.RoomId,
+			id,
+			restrictionId,
+			time.Now(),
+			time.Now(),
+		)
+		if err != nil {
+			return err
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return repository.ErrConflict
+		}
+	}
+
+	return tx.Commit()
+}
+
 // SearchAvailabilityForDatesByRoomId query database with dates if available for booking room
 func (psql *dbPostgresRepo) SearchAvailabilityForDatesByRoomId(roomId int, checkIn, checkOut time.Time) (bool, error) {
+	defer metrics.ObserveQuery("SearchAvailabilityForDatesByRoomId", time.Now())
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -108,6 +239,8 @@ func (psql *dbPostgresRepo) SearchAvailabilityForDatesByRoomId(roomId int, check
 
 // SearchAvailabilityForAllRooms returns a slice of available rooms, if any for given date range
 func (psql *dbPostgresRepo) SearchAvailabilityForAllRooms(checkIn, checkOut time.Time) ([]models.Room, error) {
+	defer metrics.ObserveQuery("SearchAvailabilityForAllRooms", time.Now())
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -157,6 +290,8 @@ func (psql *dbPostgresRepo) SearchAvailabilityForAllRooms(checkIn, checkOut time
 
 // GetRoomById get a room by id
 func (psql *dbPostgresRepo) GetRoomById(id int) (models.Room, error) {
+	defer metrics.ObserveQuery("GetRoomById", time.Now())
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -188,6 +323,8 @@ func (psql *dbPostgresRepo) GetRoomById(id int) (models.Room, error) {
 
 // GetUserById gets a user by id
 func (psql *dbPostgresRepo) GetUserById(id int) (models.User, error) {
+	defer metrics.ObserveQuery("GetUserById", time.Now())
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -223,6 +360,8 @@ func (psql *dbPostgresRepo) GetUserById(id int) (models.User, error) {
 
 // UpdateUser modifies user in database
 func (psql *dbPostgresRepo) UpdateUser(user models.User) error {
+	defer metrics.ObserveQuery("UpdateUser", time.Now())
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -253,6 +392,8 @@ func (psql *dbPostgresRepo) UpdateUser(user models.User) error {
 
 // Authenticate authenticates a user
 func (psql *dbPostgresRepo) Authenticate(email, password string) (int, string, error) {
+	defer metrics.ObserveQuery("Authenticate", time.Now())
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -285,29 +426,189 @@ func (psql *dbPostgresRepo) Authenticate(email, password string) (int, string, e
 	return id, hash, nil
 }
 
-// AllReservations returns a slice of all reservations
-func (psql *dbPostgresRepo) AllReservations() ([]models.Reservation, error) {
+// reservationSorts are the columns reservations can be sorted by
+var reservationSorts = map[string]string{
+	models.SortArrival: "r.check_in %[1]s, r.id %[1]s",
+	models.SortCreated: "r.created_at %[1]s, r.id %[1]s",
+	models.SortName:    "lower(r.last_name) %[1]s, lower(r.first_name) %[1]s, r.id %[1]s",
+}
+
+// FilterReservations returns a page of the reservations matching filter and
+// how many match in all
+func (psql *dbPostgresRepo) FilterReservations(filter models.ReservationFilter) ([]models.Reservation, int, error) {
+	defer metrics.ObserveQuery("FilterReservations", time.Now())
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if !filter.From.IsZero() {
+		where = append(where, "r.check_in >= "+arg(filter.From))
+	}
+	if !filter.To.IsZero() {
+		where = append(where, "r.check_in <= "+arg(filter.To))
+	}
+	if filter.RoomId != 0 {
+		where = append(where, "r.room_id = "+arg(filter.RoomId))
+	}
+	switch filter.Status {
+	case models.StatusNew:
+		where = append(where, "r.processed = 0")
+	case models.StatusProcessed:
+		where = append(where, "r.processed = 1")
+	}
+	if filter.Source != "" {
+		where = append(where, "r.source = "+arg(filter.Source))
+	}
+
+	conditions := ""
+	if len(where) > 0 {
+		conditions = "where " + strings.Join(where, " and ")
+	}
+
+	var total int
+	err := psql.DB.QueryRowContext(ctx, `select count(*) from reservations r `+conditions, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sort, ok := reservationSorts[filter.Sort]
+	if !ok {
+		sort = reservationSorts[models.SortArrival]
+	}
+	dir := "asc"
+	if filter.Desc {
+		dir = "desc"
+	}
+
+	limit := ""
+	if filter.PerPage > 0 {
+		limit = fmt.Sprintf("limit %s offset %s", arg(filter.PerPage), arg(max(filter.Page-1, 0)*filter.PerPage))
+	}
+
 	// indent off
 	query := `
 			select
     			r.id, r.first_name, r.last_name, r.email, r.phone, r.check_in, r.check_out,
-                r.room_id, r.created_at, r.updated_at, r.processed, rm.id, rm.room_name
+                r.room_id, r.created_at, r.updated_at, r.processed, r.sms_opt_in, r.source, r.confirmation_code,
+                rm.id, rm.room_name
 			from
 			    reservations r
             left join
                 rooms rm
             on
                 (r.room_id = rm.id)
+            ` + conditions + `
             order by
-                r.check_in asc;`
+                ` + fmt.Sprintf(sort, dir) + `
+            ` + limit + `;`
 	// indent on
 
 	var reservations []models.Reservation
 
-	rows, err := psql.DB.QueryContext(ctx, query)
+	rows, err := psql.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var reservation models.Reservation
+		err := rows.Scan(
+			&reservation.Id,
+			&reservation.FirstName,
+			&reservation.LastName,
+			&reservation.Email,
+			&reservation.Phone,
+			&reservation.CheckIn,
+			&reservation.CheckOut,
+			&reservation.RoomId,
+			&reservation.CreatedAt,
+			&reservation.UpdatedAt,
+			&reservation.Processed,
+			&reservation.SMSOptIn,
+			&reservation.Source,
+			&reservation.ConfirmationCode,
+			&reservation.Room.Id,
+			&reservation.Room.RoomName,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		reservations = append(reservations, reservation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return reservations, total, nil
+}
+
+// SearchReservations finds up to limit reservations by guest name, email,
+// phone or confirmation code, best matches first. Names are matched by
+// trigram similarity and full text search, so misspelt and partial names are
+// found, and emails and phone numbers by any part of them.
+func (psql *dbPostgresRepo) SearchReservations(q string, limit int) ([]models.Reservation, error) {
+	defer metrics.ObserveQuery("SearchReservations", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	q = strings.ToLower(strings.TrimSpace(q))
+
+	// the digits of the query, matched against the digits of phone numbers
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, q)
+	if len(digits) < 3 {
+		digits = ""
+	}
+
+	// indent off
+	query := `
+			select
+    			r.id, r.first_name, r.last_name, r.email, r.phone, r.check_in, r.check_out,
+                r.room_id, r.created_at, r.updated_at, r.processed, r.sms_opt_in, r.source, r.confirmation_code,
+                rm.id, rm.room_name
+			from
+			    reservations r
+            left join
+                rooms rm
+            on
+                (r.room_id = rm.id)
+            where
+                lower(r.first_name || ' ' || r.last_name) % $1
+                or lower(r.first_name || ' ' || r.last_name) like $2
+                or to_tsvector('simple', r.first_name || ' ' || r.last_name || ' ' || r.email) @@ plainto_tsquery('simple', $1)
+                or lower(r.email) like $2
+                or r.confirmation_code = upper($1)
+                or ($3 <> '' and regexp_replace(r.phone, '[^0-9]', '', 'g') like '%' || $3 || '%')
+            order by
+                greatest(
+                    case when r.confirmation_code = upper($1) then 2 else 0 end,
+                    case when lower(r.email) = $1 then 1.5 else 0 end,
+                    similarity(lower(r.first_name || ' ' || r.last_name), $1),
+                    ts_rank(to_tsvector('simple', r.first_name || ' ' || r.last_name || ' ' || r.email), plainto_tsquery('simple', $1)),
+                    case when lower(r.email) like $2 then 0.5 else 0 end,
+                    case when $3 <> '' and regexp_replace(r.phone, '[^0-9]', '', 'g') like '%' || $3 || '%' then 0.8 else 0 end
+                ) desc,
+                r.check_in desc
+            limit $4;`
+	// indent on
+
+	var reservations []models.Reservation
+
+	rows, err := psql.DB.QueryContext(ctx, query, q, "%"+escapeLike(q)+"%", digits, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -327,6 +628,9 @@ func (psql *dbPostgresRepo) AllReservations() ([]models.Reservation, error) {
 			&reservation.CreatedAt,
 			&reservation.UpdatedAt,
 			&reservation.Processed,
+			&reservation.SMSOptIn,
+			&reservation.Source,
+			&reservation.ConfirmationCode,
 			&reservation.Room.Id,
 			&reservation.Room.RoomName,
 		)
@@ -343,8 +647,15 @@ func (psql *dbPostgresRepo) AllReservations() ([]models.Reservation, error) {
 	return reservations, nil
 }
 
+// escapeLike escapes the wildcards in s for a like pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
 // AllNewReservations returns a slice of all new reservations
 func (psql *dbPostgresRepo) AllNewReservations() ([]models.Reservation, error) {
+	defer metrics.ObserveQuery("AllNewReservations", time.Now())
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -352,7 +663,7 @@ func (psql *dbPostgresRepo) AllNewReservations() ([]models.Reservation, error) {
 	query := `
 			select
     			r.id, r.first_name, r.last_name, r.email, r.phone, r.check_in, r.check_out,
-                r.room_id, r.created_at, r.updated_at, r.processed, rm.id, rm.room_name
+                r.room_id, r.created_at, r.updated_at, r.processed, r.sms_opt_in, rm.id, rm.room_name
 			from
 			    reservations r
             left join
@@ -387,6 +698,7 @@ func (psql *dbPostgresRepo) AllNewReservations() ([]models.Reservation, error) {
 			&reservation.CreatedAt,
 			&reservation.UpdatedAt,
 			&reservation.Processed,
+			&reservation.SMSOptIn,
 			&reservation.Room.Id,
 			&reservation.Room.RoomName,
 		)
@@ -405,6 +717,8 @@ func (psql *dbPostgresRepo) AllNewReservations() ([]models.Reservation, error) {
 
 // GetReservationById returns one reservation by id
 func (psql *dbPostgresRepo) GetReservationById(id int) (models.Reservation, error) {
+	defer metrics.ObserveQuery("GetReservationById", time.Now())
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -412,7 +726,8 @@ func (psql *dbPostgresRepo) GetReservationById(id int) (models.Reservation, erro
 	query := `
 			select
     			r.id, r.first_name, r.last_name, r.email, r.phone, r.check_in, r.check_out,
-                r.room_id, r.created_at, r.updated_at, r.processed,  rm.id, rm.room_name
+                r.room_id, r.created_at, r.updated_at, r.processed, r.sms_opt_in, r.source, r.confirmation_code,
+                r.checked_in_at, r.checked_out_at, rm.id, rm.room_name
 			from
 			    reservations r
             left join
@@ -424,6 +739,7 @@ func (psql *dbPostgresRepo) GetReservationById(id int) (models.Reservation, erro
 	// indent on
 
 	var reservation models.Reservation
+	var checkedIn, checkedOut sql.NullTime
 
 	row := psql.DB.QueryRowContext(ctx, query, id)
 	err := row.Scan(
@@ -438,18 +754,27 @@ func (psql *dbPostgresRepo) GetReservationById(id int) (models.Reservation, erro
 		&reservation.CreatedAt,
 		&reservation.UpdatedAt,
 		&reservation.Processed,
+		&reservation.SMSOptIn,
+		&reservation.Source,
+		&reservation.ConfirmationCode,
+		&checkedIn,
+		&checkedOut,
 		&reservation.Room.Id,
 		&reservation.Room.RoomName,
 	)
 	if err != nil {
 		return reservation, err
 	}
+	reservation.CheckedInAt = checkedIn.Time
+	reservation.CheckedOutAt = checkedOut.Time
 
 	return reservation, nil
 }
 
 // UpdateReservation updates reservation in database
 func (psql *dbPostgresRepo) UpdateReservation(reservation models.Reservation) error {
+	defer metrics.ObserveQuery("UpdateReservation", time.Now())
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -478,11 +803,40 @@ func (psql *dbPostgresRepo) UpdateReservation(reservation models.Reservation) er
 	return nil
 }
 
-// DeleteReservation deletes reservation from database
+// DeleteReservation deletes reservation from database, keeping a copy in reservation_cancellations
 func (psql *dbPostgresRepo) DeleteReservation(id int) error {
+	defer metrics.ObserveQuery("DeleteReservation", time.Now())
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	tx, err := psql.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// indent off
+	stmt := `
+			insert into
+			    reservation_cancellations (
+			        reservation_id, first_name, last_name, email, phone,
+			        check_in, check_out, room_id, cancelled_at, created_at, updated_at
+			    )
+			select
+			    id, first_name, last_name, email, phone,
+			    check_in, check_out, room_id, $2, $2, $2
+			from
+			    reservations
+			where
+			    id = $1;`
+	// indent on
+
+	_, err = tx.ExecContext(ctx, stmt, id, time.Now())
+	if err != nil {
+		return err
+	}
+
 	// indent off
 	query := `
 			delete from
@@ -491,16 +845,18 @@ func (psql *dbPostgresRepo) DeleteReservation(id int) error {
 			    id = $1;`
 	// indent on
 
-	_, err := psql.DB.ExecContext(ctx, query, id)
+	_, err = tx.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
 // UpdateProcessedForReservation updates processed field for reservation
 func (psql *dbPostgresRepo) UpdateProcessedForReservation(id, processed int) error {
+	defer metrics.ObserveQuery("UpdateProcessedForReservation", time.Now())
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -522,8 +878,94 @@ func (psql *dbPostgresRepo) UpdateProcessedForReservation(id, processed int) err
 	return nil
 }
 
+// CheckInReservation records that the guest of a reservation checked in at
+// at, unless they already had, which also marks the reservation processed. It
+// returns sql.ErrNoRows if there is no such reservation.
+func (psql *dbPostgresRepo) CheckInReservation(id int, at time.Time) error {
+	defer metrics.ObserveQuery("CheckInReservation", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// indent off
+	query := `
+			update
+			    reservations
+			set
+			    checked_in_at = coalesce(checked_in_at, $1), processed = 1, updated_at = $1
+			where
+			    id = $2;`
+	// indent on
+
+	return execOne(ctx, psql.DB, query, at, id)
+}
+
+// CheckOutReservation records that the guest of a reservation checked out at
+// at, unless they already had. It returns sql.ErrNoRows if there is no such
+// reservation and repository.ErrConflict if the guest hasn't checked in.
+func (psql *dbPostgresRepo) CheckOutReservation(id int, at time.Time) error {
+	defer metrics.ObserveQuery("CheckOutReservation", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// indent off
+	query := `
+			update
+			    reservations
+			set
+			    checked_out_at = coalesce(checked_out_at, $1), processed = 1, updated_at = $1
+			where
+			    id = $2 and checked_in_at is not null;`
+	// indent on
+
+	err := execOne(ctx, psql.DB, query, at, id)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	// nothing changed, because there is no such reservation or no check in
+	// indent off
+	query = `
+			select
+			    exists (select 1 from reservations where id = $1);`
+	// indent on
+
+	var exists bool
+	err = psql.DB.QueryRowContext(ctx, query, id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return repository.ErrConflict
+	}
+
+	return sql.ErrNoRows
+}
+
+// execOne runs a statement that should change one row, returning
+// sql.ErrNoRows if it changed none
+func execOne(ctx context.Context, db *sql.DB, query string, args ...interface{}) error {
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
 // AllRooms returns all rooms
 func (psql *dbPostgresRepo) AllRooms() ([]models.Room, error) {
+	defer metrics.ObserveQuery("AllRooms", time.Now())
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -567,6 +1009,8 @@ func (psql *dbPostgresRepo) AllRooms() ([]models.Room, error) {
 }
 
 func (psql *dbPostgresRepo) GetRestrictionsForRoomByDate(roomId int, start, end time.Time) ([]models.RoomRestriction, error) {
+	defer metrics.ObserveQuery("GetRestrictionsForRoomByDate", time.Now())
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -611,29 +1055,92 @@ func (psql *dbPostgresRepo) GetRestrictionsForRoomByDate(roomId int, start, end
 	return restrictions, nil
 }
 
-// InsertBlockForRoom insert block in calendar for date
-func (psql *dbPostgresRepo) InsertBlockForRoom(id int, startDate time.Time) error {
+// GetRestrictionsForRoomsByDate returns the restrictions between start and end
+// for the given rooms, or every room if roomIds is empty, with the guest
+// names of reservations
+func (psql *dbPostgresRepo) GetRestrictionsForRoomsByDate(roomIds []int, start, end time.Time) ([]models.RoomRestriction, error) {
+	defer metrics.ObserveQuery("GetRestrictionsForRoomsByDate", time.Now())
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	args := []interface{}{start, end}
+
 	// indent off
 	query := `
-			insert into
-			    room_restrictions (check_in, check_out, room_id, restriction_id, created_at, updated_at)
-			values
-			    ($1, $2, $3, $4, $5, $6);`
+			select
+    			rr.id, coalesce(rr.reservation_id, 0), rr.restriction_id, rr.room_id, rr.check_in, rr.check_out,
+    			rr.note, coalesce(rr.block_rule_id, 0), coalesce(r.first_name, ''), coalesce(r.last_name, ''),
+    			coalesce(rs.code, ''), coalesce(rs.restriction_name, ''), coalesce(rs.colour, '')
+			from
+			    room_restrictions rr
+            left join
+                reservations r
+            on
+                (rr.reservation_id = r.id)
+            left join
+                restrictions rs
+            on
+                (rr.restriction_id = rs.id)
+            where
+                $1 < rr.check_out and $2 >= rr.check_in`
 	// indent on
 
-	_, err := psql.DB.ExecContext(ctx, query, startDate, startDate.AddDate(0, 0, 1), id, 2, time.Now(), time.Now())
+	if len(roomIds) > 0 {
+		placeholders := make([]string, len(roomIds))
+		for i, id := range roomIds {
+			args = append(args, id)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		query += " and rr.room_id in (" + strings.Join(placeholders, ", ") + ")"
+	}
+
+	query += " order by rr.room_id, rr.check_in"
+
+	var restrictions []models.RoomRestriction
+
+	rows, err := psql.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	return nil
+	for rows.Next() {
+		var restriction models.RoomRestriction
+		err := rows.Scan(
+			&restriction.Id,
+			&restriction.ReservationId,
+			&restriction.RestrictionId,
+			&restriction.RoomId,
+			&restriction.CheckIn,
+			&restriction.CheckOut,
+			&restriction.Note,
+			&restriction.BlockRuleId,
+			&restriction.Reservation.FirstName,
+			&restriction.Reservation.LastName,
+			&restriction.Restriction.Code,
+			&restriction.Restriction.RestrictionName,
+			&restriction.Restriction.Colour,
+		)
+		if err != nil {
+			return nil, err
+		}
+		restriction.Reservation.Id = restriction.ReservationId
+		restriction.Restriction.Id = restriction.RestrictionId
+		restrictions = append(restrictions, restriction)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return restrictions, nil
 }
 
-// DeleteBlockById delete block by id
+// DeleteBlockById delete block by id, leaving reservations alone
 func (psql *dbPostgresRepo) DeleteBlockById(id int) error {
+	defer metrics.ObserveQuery("DeleteBlockById", time.Now())
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -642,7 +1149,7 @@ func (psql *dbPostgresRepo) DeleteBlockById(id int) error {
 			delete from
 			    room_restrictions
 			where
-			    id = $1;`
+			    id = $1 and reservation_id is null;`
 	// indent on
 
 	_, err := psql.DB.ExecContext(ctx, query, id)
@@ -652,3 +1159,1292 @@ func (psql *dbPostgresRepo) DeleteBlockById(id int) error {
 
 	return nil
 }
+
+// UpdateBlocks adds and removes blocks in one transaction. versions holds the
+// calendar version, between start and end, that each changed room was edited
+// from. It returns repository.ErrConflict, changing nothing, if one of those
+// rooms has changed since, a block to add overlaps another restriction or a
+// block to remove no longer exists.
+func (psql *dbPostgresRepo) UpdateBlocks(versions map[int]string, start, end time.Time, add []models.RoomRestriction, remove []int) error {
+	defer metrics.ObserveQuery("UpdateBlocks", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := psql.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = checkRoomVersions(ctx, tx, versions, start, end)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range remove {
+		// indent off
+		stmt := `
+				delete from
+				    room_restrictions
+				where
+				    id = $1 and reservation_id is null;`
+		// indent on
+
+		result, err := tx.ExecContext(ctx, stmt, id)
+		if err != nil {
+			return err
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return repository.ErrConflict
+		}
+	}
+
+	for _, block := range add {
+		// indent off
+		stmt := `
+				insert into
+				    room_restrictions (check_in, check_out, room_id, restriction_id, created_at, updated_at)
+				select
+				    $1, $2, $3, $4, $5, $6
+				where not exists (
+				    select 1 from room_restrictions where room_id = $3 and check_in < $2 and check_out > $1
+				);`
+		// indent on
+
+		result, err := tx.ExecContext(ctx, stmt,
+			block.CheckIn,
+			block.CheckOut,
+			block.RoomId,
+			block.RestrictionId,
+			time.Now(),
+			time.Now(),
+		)
+		if err != nil {
+			return err
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return repository.ErrConflict
+		}
+	}
+
+	return tx.Commit()
+}
+
+// checkRoomVersions locks the rooms in versions until the transaction ends, so
+// calendar edits of the same room are made one at a time, and returns
+// repository.ErrConflict if a room's restrictions between start and end no
+// longer match its version
+func checkRoomVersions(ctx context.Context, tx *sql.Tx, versions map[int]string, start, end time.Time) error {
+	if len(versions) == 0 {
+		return nil
+	}
+
+	ids := make([]interface{}, 0, len(versions))
+	placeholders := make([]string, 0, len(versions))
+	roomIds := make([]int, 0, len(versions))
+	for id := range versions {
+		ids = append(ids, id)
+		// the rooms come after start and end
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(ids)+2))
+		roomIds = append(roomIds, id)
+	}
+
+	err := lockRooms(ctx, tx, roomIds)
+	if err != nil {
+		return err
+	}
+
+	// indent off
+	query := `
+			select
+			    id, coalesce(reservation_id, 0), restriction_id, room_id, check_in, check_out, note
+			from
+			    room_restrictions
+			where
+			    $1 < check_out and $2 >= check_in and room_id in (` + strings.Join(placeholders, ", ") + `);`
+	// indent on
+
+	rows, err := tx.QueryContext(ctx, query, append([]interface{}{start, end}, ids...)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byRoom := make(map[int][]models.RoomRestriction, len(versions))
+	for rows.Next() {
+		var x models.RoomRestriction
+		err := rows.Scan(&x.Id, &x.ReservationId, &x.RestrictionId, &x.RoomId, &x.CheckIn, &x.CheckOut, &x.Note)
+		if err != nil {
+			return err
+		}
+		byRoom[x.RoomId] = append(byRoom[x.RoomId], x)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for id, version := range versions {
+		if calendar.Version(byRoom[id]) != version {
+			return repository.ErrConflict
+		}
+	}
+
+	return nil
+}
+
+// uniqueViolation is the postgres error code of a unique index violation
+const uniqueViolation = "23505"
+
+// lockRooms locks the rooms ids until the transaction ends, in order of id so
+// two transactions locking the same rooms don't deadlock
+func lockRooms(ctx context.Context, tx *sql.Tx, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, 0, len(ids))
+	placeholders := make([]string, 0, len(ids))
+	for _, id := range ids {
+		args = append(args, id)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+
+	// indent off
+	query := `
+			select
+			    id
+			from
+			    rooms
+			where
+			    id in (` + strings.Join(placeholders, ", ") + `)
+			order by
+			    id
+			for update;`
+	// indent on
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// restrictionColumns are the columns scanned by scanRestriction
+const restrictionColumns = `id, code, restriction_name, colour, occupancy, created_at, updated_at`
+
+// scanRestriction scans a row selected with restrictionColumns
+func scanRestriction(row scanner) (models.Restriction, error) {
+	var restriction models.Restriction
+	err := row.Scan(
+		&restriction.Id,
+		&restriction.Code,
+		&restriction.RestrictionName,
+		&restriction.Colour,
+		&restriction.Occupancy,
+		&restriction.CreatedAt,
+		&restriction.UpdatedAt,
+	)
+	return restriction, err
+}
+
+// AllRestrictions returns the restriction types
+func (psql *dbPostgresRepo) AllRestrictions() ([]models.Restriction, error) {
+	defer metrics.ObserveQuery("AllRestrictions", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select ` + restrictionColumns + ` from restrictions order by id;`
+
+	var restrictions []models.Restriction
+
+	rows, err := psql.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		restriction, err := scanRestriction(rows)
+		if err != nil {
+			return nil, err
+		}
+		restrictions = append(restrictions, restriction)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return restrictions, nil
+}
+
+// GetRestrictionById returns a restriction type by id
+func (psql *dbPostgresRepo) GetRestrictionById(id int) (models.Restriction, error) {
+	defer metrics.ObserveQuery("GetRestrictionById", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select ` + restrictionColumns + ` from restrictions where id = $1;`
+
+	return scanRestriction(psql.DB.QueryRowContext(ctx, query, id))
+}
+
+// GetRestrictionByCode returns a restriction type by code
+func (psql *dbPostgresRepo) GetRestrictionByCode(code string) (models.Restriction, error) {
+	defer metrics.ObserveQuery("GetRestrictionByCode", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select ` + restrictionColumns + ` from restrictions where code = $1;`
+
+	return scanRestriction(psql.DB.QueryRowContext(ctx, query, code))
+}
+
+// InsertRestriction adds a restriction type
+func (psql *dbPostgresRepo) InsertRestriction(restriction models.Restriction) (int, error) {
+	defer metrics.ObserveQuery("InsertRestriction", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// indent off
+	stmt := `
+			insert into
+			    restrictions (code, restriction_name, colour, occupancy, created_at, updated_at)
+			values
+			    ($1, $2, $3, $4, $5, $6)
+			returning id;`
+	// indent on
+
+	var id int
+
+	err := psql.DB.QueryRowContext(ctx, stmt,
+		restriction.Code,
+		restriction.RestrictionName,
+		restriction.Colour,
+		restriction.Occupancy,
+		time.Now(),
+		time.Now(),
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// UpdateRestriction changes the label, colour and occupancy of a restriction
+// type. Its code can't be changed.
+func (psql *dbPostgresRepo) UpdateRestriction(restriction models.Restriction) error {
+	defer metrics.ObserveQuery("UpdateRestriction", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// indent off
+	stmt := `
+			update
+			    restrictions
+			set
+			    restriction_name = $1, colour = $2, occupancy = $3, updated_at = $4
+			where
+			    id = $5;`
+	// indent on
+
+	_, err := psql.DB.ExecContext(ctx, stmt,
+		restriction.RestrictionName,
+		restriction.Colour,
+		restriction.Occupancy,
+		time.Now(),
+		restriction.Id,
+	)
+
+	return err
+}
+
+// DeleteRestriction deletes a restriction type. It returns
+// repository.ErrInUse if a room restriction or block rule has the type.
+func (psql *dbPostgresRepo) DeleteRestriction(id int) error {
+	defer metrics.ObserveQuery("DeleteRestriction", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// indent off
+	stmt := `
+			delete from
+			    restrictions
+			where
+			    id = $1
+			    and not exists (select 1 from room_restrictions where restriction_id = $1)
+			    and not exists (select 1 from block_rules where restriction_id = $1);`
+	// indent on
+
+	result, err := psql.DB.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrInUse
+	}
+
+	return nil
+}
+
+// blockColumns are the columns scanned by scanBlock
+// indent off
+const blockColumns = `
+			    rr.id, rr.room_id, rr.restriction_id, rr.check_in, rr.check_out, rr.note,
+			    coalesce(rr.block_rule_id, 0), rr.created_at, rr.updated_at,
+			    rm.id, rm.room_name, rs.id, rs.code, rs.restriction_name, rs.colour
+			from
+			    room_restrictions rr
+			left join
+			    rooms rm
+			on
+			    (rr.room_id = rm.id)
+			left join
+			    restrictions rs
+			on
+			    (rr.restriction_id = rs.id)`
+
+// indent on
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanBlock scans a row selected with blockColumns
+func scanBlock(row scanner) (models.RoomRestriction, error) {
+	var block models.RoomRestriction
+	err := row.Scan(
+		&block.Id,
+		&block.RoomId,
+		&block.RestrictionId,
+		&block.CheckIn,
+		&block.CheckOut,
+		&block.Note,
+		&block.BlockRuleId,
+		&block.CreatedAt,
+		&block.UpdatedAt,
+		&block.Room.Id,
+		&block.Room.RoomName,
+		&block.Restriction.Id,
+		&block.Restriction.Code,
+		&block.Restriction.RestrictionName,
+		&block.Restriction.Colour,
+	)
+	return block, err
+}
+
+// AllBlocks returns the blocks that end after from, soonest first
+func (psql *dbPostgresRepo) AllBlocks(from time.Time) ([]models.RoomRestriction, error) {
+	defer metrics.ObserveQuery("AllBlocks", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select ` + blockColumns + `
+			where
+			    rr.reservation_id is null and rr.check_out > $1
+			order by
+			    rr.check_in, rm.room_name;`
+
+	var blocks []models.RoomRestriction
+
+	rows, err := psql.DB.QueryContext(ctx, query, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		block, err := scanBlock(rows)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return blocks, nil
+}
+
+// GetBlockById returns a block by id
+func (psql *dbPostgresRepo) GetBlockById(id int) (models.RoomRestriction, error) {
+	defer metrics.ObserveQuery("GetBlockById", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select ` + blockColumns + `
+			where
+			    rr.id = $1 and rr.reservation_id is null;`
+
+	return scanBlock(psql.DB.QueryRowContext(ctx, query, id))
+}
+
+// InsertBlock blocks a room from check in up to check out. It returns
+// repository.ErrConflict if the room has another restriction in that time.
+func (psql *dbPostgresRepo) InsertBlock(block models.RoomRestriction) (int, error) {
+	defer metrics.ObserveQuery("InsertBlock", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// indent off
+	stmt := `
+			insert into
+			    room_restrictions (check_in, check_out, room_id, restriction_id, note, created_at, updated_at)
+			select
+			    $1, $2, $3, $4, $5, $6, $7
+			where not exists (
+			    select 1 from room_restrictions where room_id = $3 and check_in < $2 and check_out > $1
+			)
+			returning id;`
+	// indent on
+
+	var id int
+
+	err := psql.DB.QueryRowContext(ctx, stmt,
+		block.CheckIn,
+		block.CheckOut,
+		block.RoomId,
+		block.RestrictionId,
+		block.Note,
+		time.Now(),
+		time.Now(),
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, repository.ErrConflict
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// UpdateBlock changes the dates, type and note of a block. It returns
+// repository.ErrConflict if the block no longer exists or would overlap
+// another restriction.
+func (psql *dbPostgresRepo) UpdateBlock(block models.RoomRestriction) error {
+	defer metrics.ObserveQuery("UpdateBlock", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// indent off
+	stmt := `
+			update
+			    room_restrictions
+			set
+			    check_in = $1, check_out = $2, restriction_id = $3, note = $4, updated_at = $5
+			where
+			    id = $6 and reservation_id is null and not exists (
+			        select 1 from room_restrictions other
+			        where other.id <> $6 and other.room_id = room_restrictions.room_id
+			            and other.check_in < $2 and other.check_out > $1
+			    );`
+	// indent on
+
+	result, err := psql.DB.ExecContext(ctx, stmt,
+		block.CheckIn,
+		block.CheckOut,
+		block.RestrictionId,
+		block.Note,
+		time.Now(),
+		block.Id,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrConflict
+	}
+
+	return nil
+}
+
+// AllBlockRules returns the recurring block rules
+func (psql *dbPostgresRepo) AllBlockRules() ([]models.BlockRule, error) {
+	defer metrics.ObserveQuery("AllBlockRules", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// indent off
+	query := `
+			select
+			    br.id, br.room_id, br.restriction_id, br.note, br.frequency, br.start_date, br.end_date,
+			    br.until, br.blocked_until, br.created_at, br.updated_at, rm.id, rm.room_name, rs.id, rs.restriction_name
+			from
+			    block_rules br
+			left join
+			    rooms rm
+			on
+			    (br.room_id = rm.id)
+			left join
+			    restrictions rs
+			on
+			    (br.restriction_id = rs.id)
+			order by
+			    rm.room_name, br.start_date;`
+	// indent on
+
+	var rules []models.BlockRule
+
+	rows, err := psql.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rule models.BlockRule
+		var until, blockedUntil sql.NullTime
+		err := rows.Scan(
+			&rule.Id,
+			&rule.RoomId,
+			&rule.RestrictionId,
+			&rule.Note,
+			&rule.Frequency,
+			&rule.StartDate,
+			&rule.EndDate,
+			&until,
+			&blockedUntil,
+			&rule.CreatedAt,
+			&rule.UpdatedAt,
+			&rule.Room.Id,
+			&rule.Room.RoomName,
+			&rule.Restriction.Id,
+			&rule.Restriction.RestrictionName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		rule.Until = until.Time
+		rule.BlockedUntil = blockedUntil.Time
+		rules = append(rules, rule)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// InsertBlockRule saves a recurring rule with the blocks it makes up to
+// rule.BlockedUntil. Blocks that would overlap another restriction are skipped.
+// It returns the rule id and the number of blocks inserted.
+func (psql *dbPostgresRepo) InsertBlockRule(rule models.BlockRule, blocks []models.RoomRestriction) (int, int, error) {
+	defer metrics.ObserveQuery("InsertBlockRule", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := psql.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	var until sql.NullTime
+	if !rule.Until.IsZero() {
+		until = sql.NullTime{Time: rule.Until, Valid: true}
+	}
+
+	// indent off
+	stmt := `
+			insert into
+			    block_rules (room_id, restriction_id, note, frequency, start_date, end_date, until, blocked_until, created_at, updated_at)
+			values
+			    ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			returning id;`
+	// indent on
+
+	var id int
+
+	err = tx.QueryRowContext(ctx, stmt,
+		rule.RoomId,
+		rule.RestrictionId,
+		rule.Note,
+		rule.Frequency,
+		rule.StartDate,
+		rule.EndDate,
+		until,
+		rule.BlockedUntil,
+		time.Now(),
+		time.Now(),
+	).Scan(&id)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	rule.Id = id
+	inserted, err := insertRuleBlocks(ctx, tx, rule, blocks)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return id, inserted, nil
+}
+
+// ExtendBlockRule adds the blocks a rule makes after its BlockedUntil date up
+// to horizon, skipping those that would overlap another restriction, and moves
+// BlockedUntil to horizon. It returns the number of blocks inserted, which is
+// none if the rule was already extended that far.
+func (psql *dbPostgresRepo) ExtendBlockRule(rule models.BlockRule, horizon time.Time, blocks []models.RoomRestriction) (int, error) {
+	defer metrics.ObserveQuery("ExtendBlockRule", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := psql.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// lock the rule, so it is extended once however many instances try
+	// indent off
+	query := `
+			select
+			    blocked_until
+			from
+			    block_rules
+			where
+			    id = $1
+			for update;`
+	// indent on
+
+	var blockedUntil sql.NullTime
+	err = tx.QueryRowContext(ctx, query, rule.Id).Scan(&blockedUntil)
+	if err != nil {
+		return 0, err
+	}
+
+	if blockedUntil.Valid && !blockedUntil.Time.Before(horizon) {
+		return 0, nil
+	}
+
+	inserted, err := insertRuleBlocks(ctx, tx, rule, blocks)
+	if err != nil {
+		return 0, err
+	}
+
+	// indent off
+	stmt := `
+			update
+			    block_rules
+			set
+			    blocked_until = $1, updated_at = $2
+			where
+			    id = $3;`
+	// indent on
+
+	_, err = tx.ExecContext(ctx, stmt, horizon, time.Now(), rule.Id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return inserted, nil
+}
+
+// insertRuleBlocks inserts the blocks of a rule that don't overlap another
+// restriction, returning how many were inserted
+func insertRuleBlocks(ctx context.Context, tx *sql.Tx, rule models.BlockRule, blocks []models.RoomRestriction) (int, error) {
+	// indent off
+	stmt := `
+			insert into
+			    room_restrictions (check_in, check_out, room_id, restriction_id, note, block_rule_id, created_at, updated_at)
+			select
+			    $1, $2, $3, $4, $5, $6, $7, $8
+			where not exists (
+			    select 1 from room_restrictions where room_id = $3 and check_in < $2 and check_out > $1
+			);`
+	// indent on
+
+	inserted := 0
+	for _, block := range blocks {
+		result, err := tx.ExecContext(ctx, stmt,
+			block.CheckIn,
+			block.CheckOut,
+			rule.RoomId,
+			rule.RestrictionId,
+			rule.Note,
+			rule.Id,
+			time.Now(),
+			time.Now(),
+		)
+		if err != nil {
+			return 0, err
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		inserted += int(n)
+	}
+
+	return inserted, nil
+}
+
+// DeleteBlockRule deletes a recurring rule and its blocks that end after
+// from. Earlier blocks are kept as one-off blocks.
+func (psql *dbPostgresRepo) DeleteBlockRule(id int, from time.Time) error {
+	defer metrics.ObserveQuery("DeleteBlockRule", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := psql.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `delete from room_restrictions where block_rule_id = $1 and check_out > $2`, id, from)
+	if err != nil {
+		return err
+	}
+
+	// the rule's past blocks lose their rule id through the foreign key
+	_, err = tx.ExecContext(ctx, `delete from block_rules where id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ArrivalsPendingNotification returns reservations checking in between start and end
+// that have not been sent a notification of the given kind
+func (psql *dbPostgresRepo) ArrivalsPendingNotification(kind string, start, end time.Time) ([]models.Reservation, error) {
+	defer metrics.ObserveQuery("ArrivalsPendingNotification", time.Now())
+
+	// indent off
+	query := `
+			select
+    			r.id, r.first_name, r.last_name, r.email, r.phone, r.check_in, r.check_out,
+                r.room_id, r.created_at, r.updated_at, r.processed, r.sms_opt_in, r.source, r.confirmation_code,
+                r.checked_in_at, r.checked_out_at, rm.id, rm.room_name
+			from
+			    reservations r
+            left join
+                rooms rm
+            on
+                (r.room_id = rm.id)
+            where
+                r.check_in between $2 and $3
+            and
+                not exists (
+                    select
+                        1
+                    from
+                        reservation_notifications rn
+                    where
+                        rn.reservation_id = r.id and rn.kind = $1
+                )
+            order by
+                r.check_in asc;`
+	// indent on
+
+	return psql.queryReservations(query, kind, start, end)
+}
+
+// DeparturesPendingNotification returns reservations checking out between start and end
+// that have not been sent a notification of the given kind
+func (psql *dbPostgresRepo) DeparturesPendingNotification(kind string, start, end time.Time) ([]models.Reservation, error) {
+	defer metrics.ObserveQuery("DeparturesPendingNotification", time.Now())
+
+	// indent off
+	query := `
+			select
+    			r.id, r.first_name, r.last_name, r.email, r.phone, r.check_in, r.check_out,
+                r.room_id, r.created_at, r.updated_at, r.processed, r.sms_opt_in, r.source, r.confirmation_code,
+                r.checked_in_at, r.checked_out_at, rm.id, rm.room_name
+			from
+			    reservations r
+            left join
+                rooms rm
+            on
+                (r.room_id = rm.id)
+            where
+                r.check_out between $2 and $3
+            and
+                not exists (
+                    select
+                        1
+                    from
+                        reservation_notifications rn
+                    where
+                        rn.reservation_id = r.id and rn.kind = $1
+                )
+            order by
+                r.check_out asc;`
+	// indent on
+
+	return psql.queryReservations(query, kind, start, end)
+}
+
+// queryReservations runs a query selecting reservations joined with their room
+func (psql *dbPostgresRepo) queryReservations(query string, args ...interface{}) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	rows, err := psql.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var reservation models.Reservation
+		var checkedIn, checkedOut sql.NullTime
+		err := rows.Scan(
+			&reservation.Id,
+			&reservation.FirstName,
+			&reservation.LastName,
+			&reservation.Email,
+			&reservation.Phone,
+			&reservation.CheckIn,
+			&reservation.CheckOut,
+			&reservation.RoomId,
+			&reservation.CreatedAt,
+			&reservation.UpdatedAt,
+			&reservation.Processed,
+			&reservation.SMSOptIn,
+			&reservation.Source,
+			&reservation.ConfirmationCode,
+			&checkedIn,
+			&checkedOut,
+			&reservation.Room.Id,
+			&reservation.Room.RoomName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		reservation.CheckedInAt = checkedIn.Time
+		reservation.CheckedOutAt = checkedOut.Time
+		reservations = append(reservations, reservation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reservations, nil
+}
+
+// InsertReservationNotification records that a notification of the given kind was sent
+// for a reservation. It returns false if one had already been recorded.
+func (psql *dbPostgresRepo) InsertReservationNotification(reservationId int, kind string) (bool, error) {
+	defer metrics.ObserveQuery("InsertReservationNotification", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// indent off
+	query := `
+			insert into
+			    reservation_notifications (reservation_id, kind, sent_at, created_at, updated_at)
+			values
+			    ($1, $2, $3, $4, $5)
+			on conflict
+			    (reservation_id, kind)
+			do nothing;`
+	// indent on
+
+	result, err := psql.DB.ExecContext(ctx, query, reservationId, kind, time.Now(), time.Now(), time.Now())
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// InsertDigest records that the owner digest for date was sent. It returns
+// false if one had already been recorded.
+func (psql *dbPostgresRepo) InsertDigest(date time.Time) (bool, error) {
+	defer metrics.ObserveQuery("InsertDigest", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// indent off
+	query := `
+			insert into
+			    digests (digest_date, sent_at, created_at, updated_at)
+			values
+			    ($1, $2, $3, $4)
+			on conflict
+			    (digest_date)
+			do nothing;`
+	// indent on
+
+	result, err := psql.DB.ExecContext(ctx, query, date, time.Now(), time.Now(), time.Now())
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// DeleteDigest forgets that the owner digest for date was sent, so it is sent again
+func (psql *dbPostgresRepo) DeleteDigest(date time.Time) error {
+	defer metrics.ObserveQuery("DeleteDigest", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := psql.DB.ExecContext(ctx, `delete from digests where digest_date = $1;`, date)
+	return err
+}
+
+// DeleteReservationNotification forgets that a notification of the given kind
+// was sent for a reservation, so it is sent again
+func (psql *dbPostgresRepo) DeleteReservationNotification(reservationId int, kind string) error {
+	defer metrics.ObserveQuery("DeleteReservationNotification", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// indent off
+	query := `
+			delete from
+			    reservation_notifications
+			where
+			    reservation_id = $1 and kind = $2;`
+	// indent on
+
+	_, err := psql.DB.ExecContext(ctx, query, reservationId, kind)
+	return err
+}
+
+// ReservationsByCheckIn returns reservations checking in between start and end
+func (psql *dbPostgresRepo) ReservationsByCheckIn(start, end time.Time) ([]models.Reservation, error) {
+	defer metrics.ObserveQuery("ReservationsByCheckIn", time.Now())
+
+	// indent off
+	query := `
+			select
+    			r.id, r.first_name, r.last_name, r.email, r.phone, r.check_in, r.check_out,
+                r.room_id, r.created_at, r.updated_at, r.processed, r.sms_opt_in, r.source, r.confirmation_code,
+                r.checked_in_at, r.checked_out_at, rm.id, rm.room_name
+			from
+			    reservations r
+            left join
+                rooms rm
+            on
+                (r.room_id = rm.id)
+            where
+                r.check_in between $1 and $2
+            order by
+                r.check_in asc, rm.room_name asc;`
+	// indent on
+
+	return psql.queryReservations(query, start, end)
+}
+
+// ReservationsByCheckOut returns reservations checking out between start and end
+func (psql *dbPostgresRepo) ReservationsByCheckOut(start, end time.Time) ([]models.Reservation, error) {
+	defer metrics.ObserveQuery("ReservationsByCheckOut", time.Now())
+
+	// indent off
+	query := `
+			select
+    			r.id, r.first_name, r.last_name, r.email, r.phone, r.check_in, r.check_out,
+                r.room_id, r.created_at, r.updated_at, r.processed, r.sms_opt_in, r.source, r.confirmation_code,
+                r.checked_in_at, r.checked_out_at, rm.id, rm.room_name
+			from
+			    reservations r
+            left join
+                rooms rm
+            on
+                (r.room_id = rm.id)
+            where
+                r.check_out between $1 and $2
+            order by
+                r.check_out asc, rm.room_name asc;`
+	// indent on
+
+	return psql.queryReservations(query, start, end)
+}
+
+// InHouseReservations returns reservations staying the night of date
+func (psql *dbPostgresRepo) InHouseReservations(date time.Time) ([]models.Reservation, error) {
+	defer metrics.ObserveQuery("InHouseReservations", time.Now())
+
+	// indent off
+	query := `
+			select
+    			r.id, r.first_name, r.last_name, r.email, r.phone, r.check_in, r.check_out,
+                r.room_id, r.created_at, r.updated_at, r.processed, r.sms_opt_in, r.source, r.confirmation_code,
+                r.checked_in_at, r.checked_out_at, rm.id, rm.room_name
+			from
+			    reservations r
+            left join
+                rooms rm
+            on
+                (r.room_id = rm.id)
+            where
+                r.check_in <= $1 and r.check_out > $1
+            order by
+                rm.room_name asc;`
+	// indent on
+
+	return psql.queryReservations(query, date)
+}
+
+// CancellationsSince returns reservations cancelled after since
+func (psql *dbPostgresRepo) CancellationsSince(since time.Time) ([]models.Cancellation, error) {
+	defer metrics.ObserveQuery("CancellationsSince", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// indent off
+	query := `
+			select
+    			c.id, c.reservation_id, c.first_name, c.last_name, c.email, c.phone,
+                c.check_in, c.check_out, c.room_id, c.cancelled_at, coalesce(rm.room_name, '')
+			from
+			    reservation_cancellations c
+            left join
+                rooms rm
+            on
+                (c.room_id = rm.id)
+            where
+                c.cancelled_at >= $1
+            order by
+                c.cancelled_at asc;`
+	// indent on
+
+	var cancellations []models.Cancellation
+
+	rows, err := psql.DB.QueryContext(ctx, query, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c models.Cancellation
+		err := rows.Scan(
+			&c.Id,
+			&c.ReservationId,
+			&c.FirstName,
+			&c.LastName,
+			&c.Email,
+			&c.Phone,
+			&c.CheckIn,
+			&c.CheckOut,
+			&c.RoomId,
+			&c.CancelledAt,
+			&c.Room.RoomName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		c.Room.Id = c.RoomId
+		cancellations = append(cancellations, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return cancellations, nil
+}
+
+// OccupancyByDate returns the number of rooms occupied for each night between start and end, counting
+// the restriction types that are marked as occupancy
+func (psql *dbPostgresRepo) OccupancyByDate(start, end time.Time) ([]models.Occupancy, error) {
+	defer metrics.ObserveQuery("OccupancyByDate", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// indent off
+	query := `
+			select
+    			d::date, count(distinct rr.room_id), (select count(id) from rooms)
+			from
+			    generate_series($1::date, $2::date, interval '1 day') d
+            left join
+                room_restrictions rr
+            on
+                (rr.check_in <= d and rr.check_out > d
+                    and rr.restriction_id in (select id from restrictions where occupancy))
+            group by
+                d
+            order by
+                d asc;`
+	// indent on
+
+	var occupancy []models.Occupancy
+
+	rows, err := psql.DB.QueryContext(ctx, query, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var o models.Occupancy
+		err := rows.Scan(
+			&o.Date,
+			&o.Occupied,
+			&o.Rooms,
+		)
+		if err != nil {
+			return nil, err
+		}
+		occupancy = append(occupancy, o)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return occupancy, nil
+}
+
+// DashboardStats counts today's arrivals and departures, the reservations not
+// yet processed, and the bookings and cancellations made in the last 30 days
+func (psql *dbPostgresRepo) DashboardStats(today time.Time) (models.DashboardStats, error) {
+	defer metrics.ObserveQuery("DashboardStats", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// indent off
+	query := `
+			select
+			    (select count(id) from reservations where check_in = $1),
+			    (select count(id) from reservations where check_out = $1),
+			    (select count(id) from reservations where processed = 0),
+			    (select count(id) from reservation_cancellations where cancelled_at >= $2),
+			    count(*),
+			    coalesce(avg(b.lead), 0),
+			    count(*) filter (where b.lead < 7),
+			    count(*) filter (where b.lead >= 7 and b.lead < 30),
+			    count(*) filter (where b.lead >= 30 and b.lead < 90),
+			    count(*) filter (where b.lead >= 90)
+			from (
+			    select greatest(check_in - created_at::date, 0) as lead from reservations where created_at >= $2
+			) b;`
+	// indent on
+
+	var stats models.DashboardStats
+
+	err := psql.DB.QueryRowContext(ctx, query, today, today.AddDate(0, 0, -30)).Scan(
+		&stats.ArrivalsToday,
+		&stats.DeparturesToday,
+		&stats.NewReservations,
+		&stats.Cancellations,
+		&stats.Bookings,
+		&stats.LeadTimeDays,
+		&stats.LeadTimes[0],
+		&stats.LeadTimes[1],
+		&stats.LeadTimes[2],
+		&stats.LeadTimes[3],
+	)
+	if err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+// RevenueByDate totals the nights booked in rooms with a rate from start up
+// to, but not including, end and what they earn at the rooms' current rates
+func (psql *dbPostgresRepo) RevenueByDate(start, end time.Time) (models.Revenue, error) {
+	defer metrics.ObserveQuery("RevenueByDate", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// indent off
+	query := `
+			select
+			    coalesce(sum(n.nights), 0),
+			    (select count(id) from rooms where nightly_rate is not null) * ($2::date - $1::date),
+			    coalesce(sum(n.nights * n.nightly_rate), 0)
+			from (
+			    select
+			        least(r.check_out, $2::date) - greatest(r.check_in, $1::date) as nights, rm.nightly_rate
+			    from
+			        reservations r
+			    join
+			        rooms rm
+			    on
+			        (r.room_id = rm.id)
+			    where
+			        rm.nightly_rate is not null and r.check_in < $2 and r.check_out > $1
+			) n;`
+	// indent on
+
+	var revenue models.Revenue
+
+	err := psql.DB.QueryRowContext(ctx, query, start, end).Scan(
+		&revenue.RoomNights,
+		&revenue.AvailableNights,
+		&revenue.Revenue,
+	)
+	if err != nil {
+		return revenue, err
+	}
+
+	return revenue, nil
+}
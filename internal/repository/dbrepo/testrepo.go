@@ -1,8 +1,12 @@
 package dbrepo
 
 import (
+	"database/sql"
 	"errors"
+	"fmt"
+	"github.com/psanodiya94/gobooking.com/internal/calendar"
 	"github.com/psanodiya94/gobooking.com/internal/models"
+	"github.com/psanodiya94/gobooking.com/internal/repository"
 	"time"
 )
 
@@ -24,6 +28,21 @@ func (psql *testdbPostgresRepo) InsertRoomRestriction(res models.RoomRestriction
 	return nil
 }
 
+// ImportReservations inserts reservations and their room restrictions in one transaction
+func (psql *testdbPostgresRepo) ImportReservations(reservations []models.Reservation) error {
+	for _, res := range reservations {
+		// a reservation with the code TAKEN conflicts, as if it were already used
+		if res.ConfirmationCode == "TAKEN" {
+			return repository.ErrConflict
+		}
+		// the code NOTYPE stands for a database without the reservation restriction
+		if res.ConfirmationCode == "NOTYPE" {
+			return repository.ErrUnknownRestriction
+		}
+	}
+	return nil
+}
+
 // SearchAvailabilityForDatesByRoomId query database with dates if available for booking room
 func (psql *testdbPostgresRepo) SearchAvailabilityForDatesByRoomId(_ int, checkIn, _ time.Time) (bool, error) {
 	// set up a test time
@@ -97,8 +116,55 @@ func (psql *testdbPostgresRepo) Authenticate(email, password string) (int, strin
 	return 1, "", nil
 }
 
-func (psql *testdbPostgresRepo) AllReservations() ([]models.Reservation, error) {
+func (psql *testdbPostgresRepo) FilterReservations(filter models.ReservationFilter) ([]models.Reservation, int, error) {
+	var reservations []models.Reservation
+	// dummy values, 30 reservations of which one is returned
+	reservation := models.Reservation{
+		Id:        1,
+		FirstName: "John",
+		LastName:  "Smith",
+		Email:     "john@smith.com",
+		Phone:     "555-555-5555",
+		CheckIn:   time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		CheckOut:  time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+		RoomId:    1,
+		Source:    models.SourceWeb,
+		Room:      models.Room{Id: 1, RoomName: "General's Quarters"},
+	}
+	reservations = append(reservations, reservation)
+	return reservations, 30, nil
+}
+
+func (psql *testdbPostgresRepo) SearchReservations(q string, limit int) ([]models.Reservation, error) {
 	var reservations []models.Reservation
+	// if the query is "nobody", then find nothing
+	if q == "nobody" {
+		return reservations, nil
+	}
+	// dummy values, a stay to come and one that is over
+	today := time.Now().Truncate(24 * time.Hour)
+	reservations = append(reservations,
+		models.Reservation{
+			Id:               1,
+			FirstName:        "John",
+			LastName:         "Smith",
+			Email:            "john@smith.com",
+			CheckIn:          today.AddDate(0, 0, 7),
+			CheckOut:         today.AddDate(0, 0, 9),
+			ConfirmationCode: "ABCD2345",
+			Room:             models.Room{Id: 1, RoomName: "General's Quarters"},
+		},
+		models.Reservation{
+			Id:               2,
+			FirstName:        "Jon",
+			LastName:         "Smyth",
+			Email:            "jon@smyth.com",
+			CheckIn:          today.AddDate(0, 0, -9),
+			CheckOut:         today.AddDate(0, 0, -7),
+			ConfirmationCode: "WXYZ6789",
+			Room:             models.Room{Id: 1, RoomName: "General's Quarters"},
+		},
+	)
 	return reservations, nil
 }
 
@@ -124,6 +190,24 @@ func (psql *testdbPostgresRepo) UpdateProcessedForReservation(id, processed int)
 	return nil
 }
 
+func (psql *testdbPostgresRepo) CheckInReservation(id int, at time.Time) error {
+	if id > 100 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (psql *testdbPostgresRepo) CheckOutReservation(id int, at time.Time) error {
+	if id > 100 {
+		return sql.ErrNoRows
+	}
+	// the guest of reservation 3 hasn't checked in
+	if id == 3 {
+		return repository.ErrConflict
+	}
+	return nil
+}
+
 func (psql *testdbPostgresRepo) AllRooms() ([]models.Room, error) {
 	var rooms []models.Room
 	// dummy values
@@ -141,15 +225,16 @@ func (psql *testdbPostgresRepo) GetRestrictionsForRoomByDate(roomId int, start,
 	restriction := models.RoomRestriction{
 		Id:            1,
 		CheckIn:       start,
-		CheckOut:      end,
+		CheckOut:      start.AddDate(0, 0, 2),
 		RoomId:        roomId,
+		ReservationId: 1,
 		RestrictionId: 1,
 	}
 	restrictions = append(restrictions, restriction)
 	restriction = models.RoomRestriction{
-		Id:            0,
-		CheckIn:       start,
-		CheckOut:      end,
+		Id:            2,
+		CheckIn:       start.AddDate(0, 0, 5),
+		CheckOut:      start.AddDate(0, 0, 6),
 		RoomId:        roomId,
 		RestrictionId: 2,
 	}
@@ -157,10 +242,295 @@ func (psql *testdbPostgresRepo) GetRestrictionsForRoomByDate(roomId int, start,
 	return restrictions, nil
 }
 
-func (psql *testdbPostgresRepo) InsertBlockForRoom(id int, startDate time.Time) error {
-	return nil
+func (psql *testdbPostgresRepo) GetRestrictionsForRoomsByDate(roomIds []int, start, end time.Time) ([]models.RoomRestriction, error) {
+	if len(roomIds) == 0 {
+		roomIds = []int{1}
+	}
+
+	var restrictions []models.RoomRestriction
+	for _, id := range roomIds {
+		// dummy values
+		forRoom, _ := psql.GetRestrictionsForRoomByDate(id, start, end)
+		for _, x := range forRoom {
+			if x.ReservationId > 0 {
+				x.Reservation = models.Reservation{Id: x.ReservationId, FirstName: "John", LastName: "Smith"}
+				x.Restriction = testRestrictions[0]
+			} else {
+				x.Restriction = testRestrictions[1]
+			}
+			restrictions = append(restrictions, x)
+		}
+	}
+	return restrictions, nil
 }
 
 func (psql *testdbPostgresRepo) DeleteBlockById(id int) error {
 	return nil
 }
+
+func (psql *testdbPostgresRepo) UpdateBlocks(versions map[int]string, start, end time.Time, add []models.RoomRestriction, remove []int) error {
+	// if a room's version isn't the current one, it was changed; otherwise, pass
+	for roomId, version := range versions {
+		current, _ := psql.GetRestrictionsForRoomsByDate([]int{roomId}, start, end)
+		if calendar.Version(current) != version {
+			return repository.ErrConflict
+		}
+	}
+	return nil
+}
+
+func (psql *testdbPostgresRepo) AllRestrictions() ([]models.Restriction, error) {
+	return testRestrictions, nil
+}
+
+// testRestrictions are the dummy restriction types
+var testRestrictions = []models.Restriction{
+	{Id: 1, Code: models.RestrictionReservation, RestrictionName: "Reservation", Colour: "#dc3545", Occupancy: true},
+	{Id: 2, Code: models.RestrictionOwner, RestrictionName: "Owner Block", Colour: "#6f42c1"},
+	{Id: 3, Code: "maintenance", RestrictionName: "Maintenance", Colour: "#fd7e14"},
+	{Id: 4, Code: "out_of_order", RestrictionName: "Out of Order", Colour: "#343a40"},
+}
+
+func (psql *testdbPostgresRepo) GetRestrictionById(id int) (models.Restriction, error) {
+	for _, x := range testRestrictions {
+		if x.Id == id {
+			return x, nil
+		}
+	}
+	// if the id is over 100, then fail; otherwise, pass
+	if id > 100 {
+		return models.Restriction{}, sql.ErrNoRows
+	}
+	return models.Restriction{Id: id, Code: fmt.Sprintf("type_%d", id), RestrictionName: "Deep Clean", Colour: "#17a2b8"}, nil
+}
+
+func (psql *testdbPostgresRepo) GetRestrictionByCode(code string) (models.Restriction, error) {
+	for _, x := range testRestrictions {
+		if x.Code == code {
+			return x, nil
+		}
+	}
+	return models.Restriction{}, sql.ErrNoRows
+}
+
+func (psql *testdbPostgresRepo) InsertRestriction(restriction models.Restriction) (int, error) {
+	return len(testRestrictions) + 1, nil
+}
+
+func (psql *testdbPostgresRepo) UpdateRestriction(restriction models.Restriction) error {
+	return nil
+}
+
+func (psql *testdbPostgresRepo) DeleteRestriction(id int) error {
+	// if the id is one of the dummy types, then it is in use; otherwise, pass
+	if id <= len(testRestrictions) {
+		return repository.ErrInUse
+	}
+	return nil
+}
+
+func (psql *testdbPostgresRepo) AllBlocks(from time.Time) ([]models.RoomRestriction, error) {
+	var blocks []models.RoomRestriction
+	// dummy values
+	block := models.RoomRestriction{
+		Id:            2,
+		CheckIn:       from.AddDate(0, 0, 5),
+		CheckOut:      from.AddDate(0, 0, 8),
+		RoomId:        1,
+		RestrictionId: 3,
+		Note:          "Repaint",
+		Room:          models.Room{Id: 1, RoomName: "General's Quarters"},
+		Restriction:   models.Restriction{Id: 3, RestrictionName: "Maintenance"},
+	}
+	blocks = append(blocks, block)
+	return blocks, nil
+}
+
+func (psql *testdbPostgresRepo) GetBlockById(id int) (models.RoomRestriction, error) {
+	// if the id is over 100, then fail; otherwise, pass
+	if id > 100 {
+		return models.RoomRestriction{}, sql.ErrNoRows
+	}
+	today := time.Now().Truncate(24 * time.Hour)
+	block := models.RoomRestriction{
+		Id:            id,
+		CheckIn:       today.AddDate(0, 0, 5),
+		CheckOut:      today.AddDate(0, 0, 8),
+		RoomId:        1,
+		RestrictionId: 3,
+		Note:          "Repaint",
+		Room:          models.Room{Id: 1, RoomName: "General's Quarters"},
+		Restriction:   models.Restriction{Id: 3, RestrictionName: "Maintenance"},
+	}
+	return block, nil
+}
+
+func (psql *testdbPostgresRepo) InsertBlock(block models.RoomRestriction) (int, error) {
+	// if the note is "conflict", then it overlaps; otherwise, pass
+	if block.Note == "conflict" {
+		return 0, repository.ErrConflict
+	}
+	return 1, nil
+}
+
+func (psql *testdbPostgresRepo) UpdateBlock(block models.RoomRestriction) error {
+	// if the note is "conflict", then it overlaps; otherwise, pass
+	if block.Note == "conflict" {
+		return repository.ErrConflict
+	}
+	return nil
+}
+
+func (psql *testdbPostgresRepo) AllBlockRules() ([]models.BlockRule, error) {
+	var rules []models.BlockRule
+	// dummy values
+	rule := models.BlockRule{
+		Id:            1,
+		RoomId:        1,
+		RestrictionId: 2,
+		Note:          "Family weekend",
+		Frequency:     models.Weekly,
+		StartDate:     time.Date(2050, 1, 7, 0, 0, 0, 0, time.UTC),
+		EndDate:       time.Date(2050, 1, 9, 0, 0, 0, 0, time.UTC),
+		BlockedUntil:  time.Date(2051, 1, 7, 0, 0, 0, 0, time.UTC),
+		Room:          models.Room{Id: 1, RoomName: "General's Quarters"},
+		Restriction:   models.Restriction{Id: 2, RestrictionName: "Owner Block"},
+	}
+	rules = append(rules, rule)
+	return rules, nil
+}
+
+func (psql *testdbPostgresRepo) InsertBlockRule(rule models.BlockRule, blocks []models.RoomRestriction) (int, int, error) {
+	return 1, len(blocks), nil
+}
+
+func (psql *testdbPostgresRepo) ExtendBlockRule(rule models.BlockRule, horizon time.Time, blocks []models.RoomRestriction) (int, error) {
+	return len(blocks), nil
+}
+
+func (psql *testdbPostgresRepo) DeleteBlockRule(id int, from time.Time) error {
+	return nil
+}
+
+func (psql *testdbPostgresRepo) ArrivalsPendingNotification(kind string, start, end time.Time) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+	// dummy values
+	reservation := models.Reservation{
+		Id:        1,
+		FirstName: "John",
+		LastName:  "Smith",
+		Email:     "john@smith.com",
+		Phone:     "555-555-5555",
+		CheckIn:   start,
+		CheckOut:  end.AddDate(0, 0, 2),
+		RoomId:    1,
+		SMSOptIn:  true,
+	}
+	reservations = append(reservations, reservation)
+	return reservations, nil
+}
+
+func (psql *testdbPostgresRepo) DeparturesPendingNotification(kind string, start, end time.Time) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+	// dummy values
+	reservation := models.Reservation{
+		Id:        2,
+		FirstName: "Jane",
+		LastName:  "Smith",
+		Email:     "jane@smith.com",
+		CheckIn:   start.AddDate(0, 0, -2),
+		CheckOut:  end,
+		RoomId:    1,
+	}
+	reservations = append(reservations, reservation)
+	return reservations, nil
+}
+
+func (psql *testdbPostgresRepo) InsertReservationNotification(reservationId int, kind string) (bool, error) {
+	// reservation 2 has always been notified already
+	if reservationId == 2 {
+		return false, nil
+	}
+	return true, nil
+}
+
+func (psql *testdbPostgresRepo) DeleteReservationNotification(reservationId int, kind string) error {
+	return nil
+}
+
+func (psql *testdbPostgresRepo) InsertDigest(date time.Time) (bool, error) {
+	// the digest for 2050-01-01 has already been sent
+	return !date.Equal(time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)), nil
+}
+
+func (psql *testdbPostgresRepo) DeleteDigest(date time.Time) error {
+	return nil
+}
+
+func (psql *testdbPostgresRepo) ReservationsByCheckIn(start, end time.Time) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+	// dummy values
+	reservation := models.Reservation{
+		Id:        1,
+		FirstName: "John",
+		LastName:  "Smith",
+		CheckIn:   start,
+		CheckOut:  start.AddDate(0, 0, 2),
+		RoomId:    1,
+	}
+	reservations = append(reservations, reservation)
+	return reservations, nil
+}
+
+func (psql *testdbPostgresRepo) ReservationsByCheckOut(start, end time.Time) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+	return reservations, nil
+}
+
+func (psql *testdbPostgresRepo) InHouseReservations(date time.Time) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+	// a guest who has checked in
+	reservation := models.Reservation{
+		Id:               2,
+		FirstName:        "Jane",
+		LastName:         "Doe",
+		CheckIn:          date.AddDate(0, 0, -1),
+		CheckOut:         date.AddDate(0, 0, 1),
+		RoomId:           1,
+		Room:             models.Room{Id: 1, RoomName: "General's Quarters"},
+		ConfirmationCode: "JANE2345",
+		CheckedInAt:      date.AddDate(0, 0, -1).Add(15 * time.Hour),
+	}
+	reservations = append(reservations, reservation)
+	return reservations, nil
+}
+
+func (psql *testdbPostgresRepo) CancellationsSince(since time.Time) ([]models.Cancellation, error) {
+	var cancellations []models.Cancellation
+	return cancellations, nil
+}
+
+func (psql *testdbPostgresRepo) OccupancyByDate(start, end time.Time) ([]models.Occupancy, error) {
+	var occupancy []models.Occupancy
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		occupancy = append(occupancy, models.Occupancy{Date: d, Occupied: 1, Rooms: 2})
+	}
+	return occupancy, nil
+}
+
+func (psql *testdbPostgresRepo) DashboardStats(today time.Time) (models.DashboardStats, error) {
+	return models.DashboardStats{
+		ArrivalsToday:   2,
+		DeparturesToday: 1,
+		NewReservations: 3,
+		Bookings:        9,
+		Cancellations:   1,
+		LeadTimeDays:    12.5,
+		LeadTimes:       [4]int{3, 4, 1, 1},
+	}, nil
+}
+
+func (psql *testdbPostgresRepo) RevenueByDate(start, end time.Time) (models.Revenue, error) {
+	nights := int(end.Sub(start).Hours() / 24)
+	return models.Revenue{RoomNights: nights, AvailableNights: 2 * nights, Revenue: 100 * float64(nights)}, nil
+}
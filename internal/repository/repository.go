@@ -1,27 +1,72 @@
 package repository
 
 import (
+	"errors"
 	"github.com/psanodiya94/gobooking.com/internal/models"
 	"time"
 )
 
+// ErrConflict is returned when a change can't be made because the data was
+// changed by someone else first
+var ErrConflict = errors.New("changed by someone else")
+
+// ErrInUse is returned when something can't be deleted because other
+// records refer to it
+var ErrInUse = errors.New("in use")
+
+// ErrUnknownRestriction is returned when a restriction type a change needs
+// doesn't exist
+var ErrUnknownRestriction = errors.New("unknown restriction type")
+
 type DBRepo interface {
 	InsertReservation(res models.Reservation) (int, error)
 	InsertRoomRestriction(res models.RoomRestriction) error
+	ImportReservations(reservations []models.Reservation) error
 	SearchAvailabilityForDatesByRoomId(roomId int, checkIn, checkOut time.Time) (bool, error)
 	SearchAvailabilityForAllRooms(checkIn, checkOut time.Time) ([]models.Room, error)
 	GetRoomById(id int) (models.Room, error)
 	GetUserById(id int) (models.User, error)
 	UpdateUser(user models.User) error
 	Authenticate(email, password string) (int, string, error)
-	AllReservations() ([]models.Reservation, error)
+	FilterReservations(filter models.ReservationFilter) ([]models.Reservation, int, error)
+	SearchReservations(q string, limit int) ([]models.Reservation, error)
 	AllNewReservations() ([]models.Reservation, error)
 	GetReservationById(id int) (models.Reservation, error)
 	UpdateReservation(reservation models.Reservation) error
 	DeleteReservation(id int) error
 	UpdateProcessedForReservation(id, processed int) error
+	CheckInReservation(id int, at time.Time) error
+	CheckOutReservation(id int, at time.Time) error
 	AllRooms() ([]models.Room, error)
 	GetRestrictionsForRoomByDate(roomId int, start, end time.Time) ([]models.RoomRestriction, error)
-	InsertBlockForRoom(id int, startDate time.Time) error
+	GetRestrictionsForRoomsByDate(roomIds []int, start, end time.Time) ([]models.RoomRestriction, error)
 	DeleteBlockById(id int) error
+	UpdateBlocks(versions map[int]string, start, end time.Time, add []models.RoomRestriction, remove []int) error
+	AllRestrictions() ([]models.Restriction, error)
+	GetRestrictionById(id int) (models.Restriction, error)
+	GetRestrictionByCode(code string) (models.Restriction, error)
+	InsertRestriction(restriction models.Restriction) (int, error)
+	UpdateRestriction(restriction models.Restriction) error
+	DeleteRestriction(id int) error
+	AllBlocks(from time.Time) ([]models.RoomRestriction, error)
+	GetBlockById(id int) (models.RoomRestriction, error)
+	InsertBlock(block models.RoomRestriction) (int, error)
+	UpdateBlock(block models.RoomRestriction) error
+	AllBlockRules() ([]models.BlockRule, error)
+	InsertBlockRule(rule models.BlockRule, blocks []models.RoomRestriction) (int, int, error)
+	ExtendBlockRule(rule models.BlockRule, horizon time.Time, blocks []models.RoomRestriction) (int, error)
+	DeleteBlockRule(id int, from time.Time) error
+	ArrivalsPendingNotification(kind string, start, end time.Time) ([]models.Reservation, error)
+	DeparturesPendingNotification(kind string, start, end time.Time) ([]models.Reservation, error)
+	InsertReservationNotification(reservationId int, kind string) (bool, error)
+	DeleteReservationNotification(reservationId int, kind string) error
+	InsertDigest(date time.Time) (bool, error)
+	DeleteDigest(date time.Time) error
+	ReservationsByCheckIn(start, end time.Time) ([]models.Reservation, error)
+	ReservationsByCheckOut(start, end time.Time) ([]models.Reservation, error)
+	InHouseReservations(date time.Time) ([]models.Reservation, error)
+	CancellationsSince(since time.Time) ([]models.Cancellation, error)
+	OccupancyByDate(start, end time.Time) ([]models.Occupancy, error)
+	DashboardStats(today time.Time) (models.DashboardStats, error)
+	RevenueByDate(start, end time.Time) (models.Revenue, error)
 }
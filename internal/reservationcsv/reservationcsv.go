@@ -0,0 +1,233 @@
+package reservationcsv
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/asaskevich/govalidator"
+	"github.com/psanodiya94/gobooking.com/internal/models"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Header is the columns of an export. An import reads the same columns, so an
+// export can be imported again; columns it doesn't need are ignored.
+var Header = []string{
+	"id", "confirmation_code", "first_name", "last_name", "email", "phone", "room_id", "room_name",
+	"check_in", "check_out", "processed", "source", "created_at",
+}
+
+// required are the columns an import must have, besides room_id or room_name
+var required = []string{"first_name", "last_name", "email", "check_in", "check_out"}
+
+const dateLayout = "2006-01-02"
+
+var confirmationCode = regexp.MustCompile(`^[A-Z0-9]{4,16}$`)
+
+// Write writes reservations as RFC 4180 csv with a header row
+func Write(w io.Writer, reservations []models.Reservation) error {
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+
+	err := cw.Write(Header)
+	if err != nil {
+		return err
+	}
+
+	for _, x := range reservations {
+		err = cw.Write([]string{
+			strconv.Itoa(x.Id),
+			x.ConfirmationCode,
+			safe(x.FirstName),
+			safe(x.LastName),
+			safe(x.Email),
+			safe(x.Phone),
+			strconv.Itoa(x.RoomId),
+			safe(x.Room.RoomName),
+			x.CheckIn.Format(dateLayout),
+			x.CheckOut.Format(dateLayout),
+			strconv.FormatBool(x.Processed == 1),
+			x.Source,
+			x.CreatedAt.Format(time.RFC3339),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// safe stops spreadsheets from running a value that starts like a formula,
+// leaving phone numbers such as +1 555 alone
+func safe(s string) string {
+	if s == "" || !strings.ContainsAny(s[:1], "=+-@\t\r") {
+		return s
+	}
+
+	if strings.ContainsAny(s[:1], "+-") && strings.Trim(s[1:], "0123456789 ()-.") == "" {
+		return s
+	}
+
+	return "'" + s
+}
+
+// Row is a reservation read from an import, with what is wrong with it
+type Row struct {
+	// Line is the row's line in the file, counting the header as line 1
+	Line        int
+	Reservation models.Reservation
+	// RoomName is the room named by the row, for when it has no room_id
+	RoomName string
+	Errors   []string
+}
+
+// Valid reports whether nothing is wrong with the row
+func (row *Row) Valid() bool {
+	return len(row.Errors) == 0
+}
+
+// Error records what is wrong with the row
+func (row *Row) Error(format string, args ...interface{}) {
+	row.Errors = append(row.Errors, fmt.Sprintf(format, args...))
+}
+
+// ErrTooManyRows is returned by Read for a file with more than its limit of rows
+var ErrTooManyRows = errors.New("too many rows")
+
+// Read reads the reservations in an import of at most maxRows rows, checking
+// each row's values. Checks that need the database, like whether the room
+// exists and is free, are left to the caller.
+func Read(r io.Reader, maxRows int) ([]Row, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+
+	var missing []string
+	for _, name := range required {
+		if _, ok := columns[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	_, hasRoomId := columns["room_id"]
+	_, hasRoomName := columns["room_name"]
+	if !hasRoomId && !hasRoomName {
+		missing = append(missing, "room_id or room_name")
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing columns: %s", strings.Join(missing, ", "))
+	}
+
+	var rows []Row
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(rows) == maxRows {
+			return nil, fmt.Errorf("%w, at most %d can be imported at once", ErrTooManyRows, maxRows)
+		}
+
+		line, _ := cr.FieldPos(0)
+		rows = append(rows, readRow(line, record, columns))
+	}
+
+	if len(rows) == 0 {
+		return nil, errors.New("the file has no reservations")
+	}
+
+	return rows, nil
+}
+
+// readRow reads and checks one row
+func readRow(line int, record []string, columns map[string]int) Row {
+	get := func(name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	row := Row{
+		Line: line,
+		Reservation: models.Reservation{
+			FirstName:        get("first_name"),
+			LastName:         get("last_name"),
+			Email:            get("email"),
+			Phone:            get("phone"),
+			ConfirmationCode: strings.ToUpper(get("confirmation_code")),
+			Source:           models.SourceImport,
+		},
+		RoomName: get("room_name"),
+	}
+
+	for _, name := range []string{"first_name", "last_name", "email"} {
+		if get(name) == "" {
+			row.Error("%s is required", name)
+		}
+	}
+
+	if row.Reservation.Email != "" && !govalidator.IsEmail(row.Reservation.Email) {
+		row.Error("invalid email address %q", row.Reservation.Email)
+	}
+
+	if code := row.Reservation.ConfirmationCode; code != "" && !confirmationCode.MatchString(code) {
+		row.Error("confirmation_code must be 4 to 16 letters and digits")
+	}
+
+	if v := get("room_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			row.Error("invalid room_id %q", v)
+		}
+		row.Reservation.RoomId = id
+	} else if row.RoomName == "" {
+		row.Error("room_id or room_name is required")
+	}
+
+	var err error
+	row.Reservation.CheckIn, err = time.Parse(dateLayout, get("check_in"))
+	if err != nil {
+		row.Error("check_in must be a date like 2025-01-31")
+	}
+
+	row.Reservation.CheckOut, err = time.Parse(dateLayout, get("check_out"))
+	if err != nil {
+		row.Error("check_out must be a date like 2025-01-31")
+	}
+
+	if !row.Reservation.CheckIn.IsZero() && !row.Reservation.CheckOut.IsZero() && !row.Reservation.CheckOut.After(row.Reservation.CheckIn) {
+		row.Error("check_out must be after check_in")
+	}
+
+	switch strings.ToLower(get("processed")) {
+	case "", "false", "0", "no":
+	case "true", "1", "yes":
+		row.Reservation.Processed = 1
+	default:
+		row.Error("processed must be true or false")
+	}
+
+	return row
+}
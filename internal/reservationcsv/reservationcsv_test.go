@@ -0,0 +1,125 @@
+package reservationcsv
+
+import (
+	"bytes"
+	"errors"
+	"github.com/psanodiya94/gobooking.com/internal/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	var b bytes.Buffer
+	err := Write(&b, []models.Reservation{
+		{
+			Id:               7,
+			ConfirmationCode: "ABCD2345",
+			FirstName:        "=cmd()",
+			LastName:         "Smith, Jr",
+			Email:            "john@smith.com",
+			Phone:            "+1 555 0100",
+			RoomId:           1,
+			Room:             models.Room{RoomName: "General's Quarters"},
+			CheckIn:          time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+			CheckOut:         time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+			Processed:        1,
+			Source:           models.SourceWeb,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(b.String(), "\r\n")
+	if len(lines) != 3 || lines[2] != "" {
+		t.Fatalf("expected a header and a row ending in crlf, got %q", b.String())
+	}
+
+	if lines[0] != strings.Join(Header, ",") {
+		t.Errorf("unexpected header %q", lines[0])
+	}
+
+	for _, want := range []string{"7,ABCD2345,'=cmd(),\"Smith, Jr\",", ",+1 555 0100,1,General's Quarters,2050-01-01,2050-01-03,true,web,"} {
+		if !strings.Contains(lines[1], want) {
+			t.Errorf("expected %q in row %q", want, lines[1])
+		}
+	}
+}
+
+func TestSafe(t *testing.T) {
+	tests := map[string]string{
+		"john":         "john",
+		"":             "",
+		"=1+1":         "'=1+1",
+		"@SUM(A1)":     "'@SUM(A1)",
+		"+1 555 0100":  "+1 555 0100",
+		"-5":           "-5",
+		"+cmd|' /C'!A": "'+cmd|' /C'!A",
+		"\tx":          "'\tx",
+	}
+
+	for in, expected := range tests {
+		if got := safe(in); got != expected {
+			t.Errorf("safe(%q): expected %q, got %q", in, expected, got)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	in := "\ufefffirst_name,last_name,email,room_name,check_in,check_out,confirmation_code,processed\r\n" +
+		"John,Smith,john@smith.com,General's Quarters,2050-01-01,2050-01-03,abcd2345,true\r\n" +
+		",Smith,not-an-email,,2050-01-03,2050-01-01,x!,maybe\r\n"
+
+	rows, err := Read(strings.NewReader(in), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+
+	ok := rows[0]
+	if !ok.Valid() {
+		t.Errorf("expected the first row to be valid, got %v", ok.Errors)
+	}
+	if ok.Line != 2 || ok.RoomName != "General's Quarters" || ok.Reservation.ConfirmationCode != "ABCD2345" ||
+		ok.Reservation.Processed != 1 || ok.Reservation.Source != models.SourceImport {
+		t.Errorf("unexpected first row %+v", ok)
+	}
+
+	bad := rows[1]
+	if bad.Line != 3 || len(bad.Errors) != 6 {
+		t.Errorf("expected 6 errors on line 3, got %d on line %d: %v", len(bad.Errors), bad.Line, bad.Errors)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	header := "first_name,last_name,email,room_id,check_in,check_out\n"
+	row := "John,Smith,john@smith.com,1,2050-01-01,2050-01-03\n"
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", "", "empty"},
+		{"no rows", header, "no reservations"},
+		{"missing columns", "first_name,email\n" + row, "missing columns: last_name, check_in, check_out, room_id or room_name"},
+		{"too many rows", header + row + row + row, "too many rows"},
+		{"malformed", header + "John,\"Smith,john@smith.com\n", "quote"},
+	}
+
+	for _, e := range tests {
+		_, err := Read(strings.NewReader(e.in), 2)
+		if err == nil || !strings.Contains(err.Error(), e.want) {
+			t.Errorf("%s: expected an error with %q, got %v", e.name, e.want, err)
+		}
+	}
+
+	_, err := Read(strings.NewReader(header+row+row+row), 2)
+	if !errors.Is(err, ErrTooManyRows) {
+		t.Errorf("expected ErrTooManyRows, got %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package scheduler
+
+import (
+	"github.com/psanodiya94/gobooking.com/internal/calendar"
+	"github.com/psanodiya94/gobooking.com/internal/models"
+	"time"
+)
+
+// ExtendBlockRules makes the blocks of each recurring rule up to
+// calendar.RuleYears ahead of today, so rooms stay blocked as time goes on
+func (j *Jobs) ExtendBlockRules(now time.Time) error {
+	today := dateOf(now.In(j.location()))
+	horizon := today.AddDate(calendar.RuleYears, 0, 0)
+
+	rules, err := j.DB.AllBlockRules()
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		if rule.Frequency != models.Weekly && rule.Frequency != models.Yearly {
+			continue
+		}
+
+		// already made far enough ahead, or up to the rule's end
+		if !rule.BlockedUntil.Before(horizon) || (!rule.Until.IsZero() && !rule.Until.After(rule.BlockedUntil)) {
+			continue
+		}
+
+		from := rule.BlockedUntil.AddDate(0, 0, 1)
+		if from.Before(today) {
+			from = today
+		}
+
+		_, err := j.DB.ExtendBlockRule(rule, horizon, calendar.Occurrences(rule, from, horizon))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
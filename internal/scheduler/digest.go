@@ -0,0 +1,117 @@
+package scheduler
+
+import (
+	"fmt"
+	"github.com/psanodiya94/gobooking.com/internal/mailer"
+	"github.com/psanodiya94/gobooking.com/internal/models"
+	"time"
+)
+
+// number of days of occupancy shown in the digest
+const digestOccupancyDays = 7
+
+// ParseDigestAt parses a HH:MM local time into the time after midnight
+func ParseDigestAt(at string) (time.Duration, error) {
+	t, err := time.Parse("15:04", at)
+	if err != nil {
+		return 0, fmt.Errorf("invalid digest time %q, expected HH:MM", at)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// SendDailyDigest emails the property owner a summary of the day's operations
+// once the digest time has passed, unless the day's digest was already sent, by
+// another instance or an earlier run
+func (j *Jobs) SendDailyDigest(now time.Time) error {
+	local := now.In(j.location())
+	today := dateOf(local)
+
+	year, month, day := local.Date()
+	if local.Before(time.Date(year, month, day, 0, 0, 0, 0, local.Location()).Add(j.digestAt)) {
+		return nil
+	}
+
+	inserted, err := j.DB.InsertDigest(today)
+	if err != nil {
+		return err
+	}
+
+	if !inserted {
+		return nil
+	}
+
+	err = j.sendDailyDigest(now, today)
+	if err != nil {
+		// let the next run try again
+		if err := j.DB.DeleteDigest(today); err != nil {
+			j.App.Logger.Error("can't forget failed digest", "date", today.Format("2006-01-02"), "error", err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// sendDailyDigest gathers and queues the digest for today
+func (j *Jobs) sendDailyDigest(now, today time.Time) error {
+	arrivals, err := j.DB.ReservationsByCheckIn(today, today)
+	if err != nil {
+		return err
+	}
+
+	departures, err := j.DB.ReservationsByCheckOut(today, today)
+	if err != nil {
+		return err
+	}
+
+	inHouse, err := j.DB.InHouseReservations(today)
+	if err != nil {
+		return err
+	}
+
+	newReservations, err := j.DB.AllNewReservations()
+	if err != nil {
+		return err
+	}
+
+	cancellations, err := j.DB.CancellationsSince(now.Add(-24 * time.Hour))
+	if err != nil {
+		return err
+	}
+
+	occupancy, err := j.DB.OccupancyByDate(today, today.AddDate(0, 0, digestOccupancyDays-1))
+	if err != nil {
+		return err
+	}
+
+	j.App.MailChan <- models.MailData{
+		To:       j.App.OwnerEmail,
+		From:     j.App.MailFrom,
+		Subject:  fmt.Sprintf("Daily digest for %s", today.Format("Monday, January 2")),
+		Template: mailer.DailyDigest,
+		Data: mailer.DigestData{
+			Date:            today,
+			Arrivals:        arrivals,
+			Departures:      departures,
+			InHouse:         inHouse,
+			NewReservations: newReservations,
+			Cancellations:   cancellations,
+			Occupancy:       occupancy,
+		},
+		Failed: func(error) {
+			if err := j.DB.DeleteDigest(today); err != nil {
+				j.App.Logger.Error("can't forget failed digest", "date", today.Format("2006-01-02"), "error", err)
+			}
+		},
+	}
+
+	return nil
+}
+
+// location returns the time zone of the property
+func (j *Jobs) location() *time.Location {
+	if j.App.Location == nil {
+		return time.Local
+	}
+	return j.App.Location
+}
@@ -0,0 +1,188 @@
+package scheduler
+
+import (
+	"github.com/psanodiya94/gobooking.com/internal/config"
+	"github.com/psanodiya94/gobooking.com/internal/driver"
+	"github.com/psanodiya94/gobooking.com/internal/mailer"
+	"github.com/psanodiya94/gobooking.com/internal/models"
+	"github.com/psanodiya94/gobooking.com/internal/repository"
+	"github.com/psanodiya94/gobooking.com/internal/repository/dbrepo"
+	"github.com/psanodiya94/gobooking.com/internal/sms"
+	"time"
+)
+
+// Kinds of guest notifications tracked per reservation
+const (
+	NotificationReminder = "reminder"
+	NotificationWelcome  = "welcome"
+	NotificationThankYou = "thank-you"
+)
+
+// how far back to look for departures, so a stopped scheduler catches up
+const thankYouLookback = 7
+
+// Jobs holds the guest notification jobs
+type Jobs struct {
+	App *config.AppConfig
+	DB  repository.DBRepo
+	// digestAt is the time after midnight the daily digest is due
+	digestAt time.Duration
+}
+
+// NewJobs creates the guest notification jobs
+func NewJobs(a *config.AppConfig, db *driver.DataBase) *Jobs {
+	return &Jobs{
+		App: a,
+		DB:  dbrepo.NewPostgresRepo(db.SQL, a),
+	}
+}
+
+// NewTestJobs creates the guest notification jobs for testing
+func NewTestJobs(a *config.AppConfig) *Jobs {
+	return &Jobs{
+		App: a,
+		DB:  dbrepo.NewTestingRepo(a),
+	}
+}
+
+// Register adds the guest notification jobs, the extending of recurring
+// blocks, and the owner digest when App.DigestAt is set, to the scheduler. The digest is checked for on every
+// run, so one that failed is tried again later the same day.
+func (j *Jobs) Register(s *Scheduler, every time.Duration) error {
+	s.Add("arrival reminders", every, j.SendReminders)
+	s.Add("check-in welcomes", every, j.SendWelcomes)
+	s.Add("post-stay thank you", every, j.SendThankYous)
+	s.Add("recurring blocks", every, j.ExtendBlockRules)
+
+	if j.App.DigestAt != "" {
+		at, err := ParseDigestAt(j.App.DigestAt)
+		if err != nil {
+			return err
+		}
+		j.digestAt = at
+		s.Add("daily digest", every, j.SendDailyDigest)
+	}
+
+	return nil
+}
+
+// SendReminders emails guests arriving in the next App.ReminderDays days
+func (j *Jobs) SendReminders(now time.Time) error {
+	today := dateOf(now.In(j.location()))
+
+	reservations, err := j.DB.ArrivalsPendingNotification(
+		NotificationReminder, today.AddDate(0, 0, 1), today.AddDate(0, 0, j.App.ReminderDays),
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, res := range reservations {
+		days := int(res.CheckIn.Sub(today).Hours() / 24)
+
+		err = j.notify(res, NotificationReminder, models.MailData{
+			To:       res.Email,
+			From:     j.App.MailFrom,
+			Subject:  "Your upcoming stay",
+			Template: mailer.ReservationReminder,
+			Data:     mailer.ReminderData{Reservation: res, Days: days},
+		}, models.SMSData{
+			To:       res.Phone,
+			Template: sms.ReservationReminder,
+			Data:     mailer.ReminderData{Reservation: res, Days: days},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SendWelcomes emails arrival instructions to guests checking in today
+func (j *Jobs) SendWelcomes(now time.Time) error {
+	today := dateOf(now.In(j.location()))
+
+	reservations, err := j.DB.ArrivalsPendingNotification(NotificationWelcome, today, today)
+	if err != nil {
+		return err
+	}
+
+	for _, res := range reservations {
+		err = j.notify(res, NotificationWelcome, models.MailData{
+			To:       res.Email,
+			From:     j.App.MailFrom,
+			Subject:  "Welcome to GoBooking.com",
+			Template: mailer.ReservationWelcome,
+			Data:     mailer.WelcomeData{Reservation: res, Instructions: j.App.ArrivalInstructions},
+		}, models.SMSData{})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SendThankYous emails guests who checked out recently asking for a review
+func (j *Jobs) SendThankYous(now time.Time) error {
+	today := dateOf(now.In(j.location()))
+
+	reservations, err := j.DB.DeparturesPendingNotification(
+		NotificationThankYou, today.AddDate(0, 0, -thankYouLookback), today.AddDate(0, 0, -1),
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, res := range reservations {
+		err = j.notify(res, NotificationThankYou, models.MailData{
+			To:       res.Email,
+			From:     j.App.MailFrom,
+			Subject:  "Thank you for staying with us",
+			Template: mailer.ReservationThankYou,
+			Data:     mailer.ReservationData{Reservation: res},
+		}, models.SMSData{})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// notify records the notification and queues the email, and the text message
+// when the guest opted in to them, unless it was sent before. The record is
+// made first so that two instances don't both send it, and removed again if
+// the email can't be sent, so a later run tries again.
+func (j *Jobs) notify(res models.Reservation, kind string, mail models.MailData, text models.SMSData) error {
+	inserted, err := j.DB.InsertReservationNotification(res.Id, kind)
+	if err != nil {
+		return err
+	}
+
+	if !inserted {
+		return nil
+	}
+
+	mail.Failed = func(error) {
+		err := j.DB.DeleteReservationNotification(res.Id, kind)
+		if err != nil {
+			j.App.Logger.Error("can't forget failed notification", "reservation_id", res.Id, "kind", kind, "error", err)
+		}
+	}
+
+	j.App.MailChan <- mail
+
+	if res.SMSOptIn && text.Template != "" {
+		j.App.SMSChan <- text
+	}
+
+	return nil
+}
+
+// dateOf returns the calendar date of t, as stored in the reservations table
+func dateOf(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,83 @@
+package scheduler
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Job is a unit of work run periodically by the scheduler
+type Job func(now time.Time) error
+
+type entry struct {
+	name  string
+	every time.Duration
+	job   Job
+}
+
+// Scheduler runs jobs periodically in the background
+type Scheduler struct {
+	Logger  *slog.Logger
+	entries []entry
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// New creates a new scheduler
+func New(logger *slog.Logger) *Scheduler {
+	return &Scheduler{
+		Logger: logger,
+		stop:   make(chan struct{}),
+	}
+}
+
+// Add registers a job to run every interval once the scheduler is started
+func (s *Scheduler) Add(name string, every time.Duration, job Job) {
+	s.entries = append(s.entries, entry{
+		name:  name,
+		every: every,
+		job:   job,
+	})
+}
+
+// Start runs every job once straight away and then on its interval
+func (s *Scheduler) Start() {
+	for _, e := range s.entries {
+		s.wg.Add(1)
+		go s.loop(e)
+	}
+}
+
+// Stop stops all the jobs and waits for running ones to finish
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(e entry) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(e.every)
+	defer ticker.Stop()
+
+	s.run(e, time.Now())
+
+	for {
+		select {
+		case now := <-ticker.C:
+			s.run(e, now)
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *Scheduler) run(e entry, now time.Time) {
+	start := time.Now()
+	err := e.job(now)
+	if err != nil {
+		s.Logger.Error("job failed", "job", e.name, "error", err)
+		return
+	}
+	s.Logger.Info("job finished", "job", e.name, "duration", time.Since(start))
+}
@@ -0,0 +1,276 @@
+package scheduler
+
+import (
+	"errors"
+	"github.com/psanodiya94/gobooking.com/internal/mailer"
+	"github.com/psanodiya94/gobooking.com/internal/models"
+	"github.com/psanodiya94/gobooking.com/internal/repository"
+	"github.com/psanodiya94/gobooking.com/internal/sms"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	var runs, failures int32
+
+	s := New(logger)
+	s.Add("counter", 10*time.Millisecond, func(now time.Time) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	})
+	s.Add("failing", 10*time.Millisecond, func(now time.Time) error {
+		atomic.AddInt32(&failures, 1)
+		return errors.New("job failed")
+	})
+
+	s.Start()
+	time.Sleep(35 * time.Millisecond)
+	s.Stop()
+
+	if atomic.LoadInt32(&runs) < 2 {
+		t.Errorf("expected the job to run at least twice, ran %d times", runs)
+	}
+
+	if atomic.LoadInt32(&failures) < 2 {
+		t.Errorf("expected a failing job to keep running, ran %d times", failures)
+	}
+
+	stopped := atomic.LoadInt32(&runs)
+	time.Sleep(20 * time.Millisecond)
+	if atomic.LoadInt32(&runs) != stopped {
+		t.Error("job kept running after the scheduler was stopped")
+	}
+}
+
+func TestSendReminders(t *testing.T) {
+	j := NewTestJobs(&testApp)
+	now := time.Date(2050, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	err := j.SendReminders(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := <-testApp.MailChan
+	if msg.Template != mailer.ReservationReminder {
+		t.Errorf("expected template %s but got %s", mailer.ReservationReminder, msg.Template)
+	}
+
+	data, ok := msg.Data.(mailer.ReminderData)
+	if !ok {
+		t.Fatalf("expected reminder data but got %T", msg.Data)
+	}
+
+	if data.Days != 1 {
+		t.Errorf("expected reminder for 1 day ahead but got %d", data.Days)
+	}
+
+	// a reminder that can't be sent is forgotten, to be sent again
+	if msg.Failed == nil {
+		t.Error("expected the reminder to be forgotten if it can't be sent")
+	} else {
+		msg.Failed(errors.New("mail server down"))
+	}
+
+	// the guest opted in to text messages
+	text := <-testApp.SMSChan
+	if text.Template != sms.ReservationReminder {
+		t.Errorf("expected sms template %s but got %s", sms.ReservationReminder, text.Template)
+	}
+}
+
+func TestSendWelcomes(t *testing.T) {
+	j := NewTestJobs(&testApp)
+
+	err := j.SendWelcomes(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := <-testApp.MailChan
+	data, ok := msg.Data.(mailer.WelcomeData)
+	if !ok {
+		t.Fatalf("expected welcome data but got %T", msg.Data)
+	}
+
+	if data.Instructions != testApp.ArrivalInstructions {
+		t.Errorf("expected arrival instructions %q but got %q", testApp.ArrivalInstructions, data.Instructions)
+	}
+
+	if len(testApp.SMSChan) != 0 {
+		t.Error("welcome sent as a text message")
+	}
+}
+
+func TestSendThankYous(t *testing.T) {
+	j := NewTestJobs(&testApp)
+
+	err := j.SendThankYous(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the test repository reports the departure as already notified
+	if len(testApp.MailChan) != 0 {
+		t.Error("thank you email sent twice for the same reservation")
+	}
+}
+
+func TestParseDigestAt(t *testing.T) {
+	at, err := ParseDigestAt("07:30")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if at != 7*time.Hour+30*time.Minute {
+		t.Errorf("expected 7h30m but got %s", at)
+	}
+
+	_, err = ParseDigestAt("7am")
+	if err == nil {
+		t.Error("parsed an invalid digest time")
+	}
+}
+
+func TestSendDailyDigest(t *testing.T) {
+	j := NewTestJobs(&testApp)
+
+	err := j.SendDailyDigest(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := <-testApp.MailChan
+	data, ok := msg.Data.(mailer.DigestData)
+	if !ok {
+		t.Fatalf("expected digest data but got %T", msg.Data)
+	}
+
+	if len(data.Arrivals) != 1 {
+		t.Errorf("expected 1 arrival but got %d", len(data.Arrivals))
+	}
+
+	if len(data.Occupancy) != digestOccupancyDays {
+		t.Errorf("expected %d days of occupancy but got %d", digestOccupancyDays, len(data.Occupancy))
+	}
+
+	// the test repository reports the digest for 2050-01-01 as already sent
+	err = j.SendDailyDigest(time.Date(2050, 1, 1, 7, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(testApp.MailChan) != 0 {
+		t.Error("digest sent twice for the same day")
+	}
+}
+
+// digestRepo remembers which days' digests were sent
+type digestRepo struct {
+	repository.DBRepo
+	sent map[time.Time]bool
+}
+
+func (r *digestRepo) InsertDigest(date time.Time) (bool, error) {
+	if r.sent[date] {
+		return false, nil
+	}
+	r.sent[date] = true
+	return true, nil
+}
+
+func (r *digestRepo) DeleteDigest(date time.Time) error {
+	delete(r.sent, date)
+	return nil
+}
+
+func TestSendDailyDigestRetry(t *testing.T) {
+	j := NewTestJobs(&testApp)
+	j.DB = &digestRepo{DBRepo: j.DB, sent: map[time.Time]bool{}}
+	j.digestAt = 7 * time.Hour
+
+	loc := time.FixedZone("test", 2*60*60)
+	j.App.Location = loc
+	defer func() { j.App.Location = nil }()
+
+	run := func(hour int) {
+		err := j.SendDailyDigest(time.Date(2050, 1, 2, hour, 0, 0, 0, loc))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run(6)
+	if len(testApp.MailChan) != 0 {
+		t.Fatal("digest sent before its time")
+	}
+
+	// the first digest can't be sent
+	run(7)
+	msg := <-testApp.MailChan
+	msg.Failed(errors.New("mail server down"))
+
+	run(8)
+	if len(testApp.MailChan) != 1 {
+		t.Fatal("failed digest not sent again")
+	}
+
+	msg = <-testApp.MailChan
+	data := msg.Data.(mailer.DigestData)
+	if !data.Date.Equal(time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the digest for 2050-01-02 but got %s", data.Date)
+	}
+
+	run(9)
+	if len(testApp.MailChan) != 0 {
+		t.Error("digest sent twice for the same day")
+	}
+}
+
+// blockRuleRepo remembers the blocks rules were extended with
+type blockRuleRepo struct {
+	repository.DBRepo
+	horizon time.Time
+	blocks  []models.RoomRestriction
+}
+
+func (r *blockRuleRepo) ExtendBlockRule(rule models.BlockRule, horizon time.Time, blocks []models.RoomRestriction) (int, error) {
+	r.horizon = horizon
+	r.blocks = append(r.blocks, blocks...)
+	return len(blocks), nil
+}
+
+func TestExtendBlockRules(t *testing.T) {
+	j := NewTestJobs(&testApp)
+	repo := &blockRuleRepo{DBRepo: j.DB}
+	j.DB = repo
+
+	// the test rule blocks every friday from 2050-01-07 and was made up to 2051-01-07
+	err := j.ExtendBlockRules(time.Date(2048, 12, 1, 10, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(repo.blocks) != 0 {
+		t.Errorf("extended a rule already made far enough ahead with %d blocks", len(repo.blocks))
+	}
+
+	err = j.ExtendBlockRules(time.Date(2049, 6, 1, 10, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !repo.horizon.Equal(time.Date(2051, 6, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the rule to be made up to 2051-06-01 but got %s", repo.horizon.Format("2006-01-02"))
+	}
+
+	if len(repo.blocks) == 0 {
+		t.Fatal("rule not extended")
+	}
+
+	first, last := repo.blocks[0].CheckIn, repo.blocks[len(repo.blocks)-1].CheckIn
+	if !first.Equal(time.Date(2051, 1, 13, 0, 0, 0, 0, time.UTC)) || !last.Equal(time.Date(2051, 5, 26, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected blocks from 2051-01-13 to 2051-05-26 but got %s to %s", first.Format("2006-01-02"), last.Format("2006-01-02"))
+	}
+}
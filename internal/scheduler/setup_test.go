@@ -0,0 +1,28 @@
+package scheduler
+
+import (
+	"github.com/psanodiya94/gobooking.com/internal/config"
+	"github.com/psanodiya94/gobooking.com/internal/logging"
+	"github.com/psanodiya94/gobooking.com/internal/models"
+	"log/slog"
+	"os"
+	"testing"
+)
+
+var testApp config.AppConfig
+var logger *slog.Logger
+
+func TestMain(m *testing.M) {
+	// initialize logger
+	logger = logging.New(os.Stdout, "text", slog.LevelInfo)
+
+	testApp.Logger = logger
+	testApp.ReminderDays = 3
+	testApp.ArrivalInstructions = "Keys are at the front desk"
+
+	// buffered so the jobs can queue mail without a listener
+	testApp.MailChan = make(chan models.MailData, 10)
+	testApp.SMSChan = make(chan models.SMSData, 10)
+
+	os.Exit(m.Run())
+}
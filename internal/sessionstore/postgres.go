@@ -0,0 +1,172 @@
+package sessionstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// PostgresStore keeps scs sessions in the sessions table, so they survive
+// restarts and are shared by every instance of the app
+type PostgresStore struct {
+	DB     *sql.DB
+	Logger *slog.Logger
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewPostgres creates a store that deletes expired sessions every
+// cleanupInterval, or never if it is 0
+func NewPostgres(db *sql.DB, logger *slog.Logger, cleanupInterval time.Duration) *PostgresStore {
+	p := &PostgresStore{
+		DB:     db,
+		Logger: logger,
+	}
+
+	if cleanupInterval > 0 {
+		p.stop = make(chan struct{})
+		p.done = make(chan struct{})
+		go p.startCleanup(cleanupInterval)
+	}
+
+	return p
+}
+
+// Find returns the data of the session token, if it has not expired
+func (p *PostgresStore) Find(token string) ([]byte, bool, error) {
+	return p.FindCtx(context.Background(), token)
+}
+
+// FindCtx returns the data of the session token, if it has not expired
+func (p *PostgresStore) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var b []byte
+
+	err := p.DB.QueryRowContext(ctx, `select data from sessions where token = $1 and expiry > $2`,
+		token, time.Now()).Scan(&b)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return b, true, nil
+}
+
+// Commit saves the session data, replacing any saved for token before
+func (p *PostgresStore) Commit(token string, b []byte, expiry time.Time) error {
+	return p.CommitCtx(context.Background(), token, b, expiry)
+}
+
+// CommitCtx saves the session data, replacing any saved for token before
+func (p *PostgresStore) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// indent off
+	stmt := `insert into sessions (token, data, expiry)
+			values ($1, $2, $3)
+			on conflict (token) do update set data = excluded.data, expiry = excluded.expiry`
+	// indent on
+
+	_, err := p.DB.ExecContext(ctx, stmt, token, b, expiry)
+	return err
+}
+
+// Delete removes the session token
+func (p *PostgresStore) Delete(token string) error {
+	return p.DeleteCtx(context.Background(), token)
+}
+
+// DeleteCtx removes the session token
+func (p *PostgresStore) DeleteCtx(ctx context.Context, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := p.DB.ExecContext(ctx, `delete from sessions where token = $1`, token)
+	return err
+}
+
+// All returns the data of every session that has not expired, by token
+func (p *PostgresStore) All() (map[string][]byte, error) {
+	return p.AllCtx(context.Background())
+}
+
+// AllCtx returns the data of every session that has not expired, by token
+func (p *PostgresStore) AllCtx(ctx context.Context) (map[string][]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := p.DB.QueryContext(ctx, `select token, data from sessions where expiry > $1`, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make(map[string][]byte)
+	for rows.Next() {
+		var token string
+		var b []byte
+
+		err = rows.Scan(&token, &b)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions[token] = b
+	}
+
+	return sessions, rows.Err()
+}
+
+// DeleteExpired removes the sessions that have expired
+func (p *PostgresStore) DeleteExpired() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := p.DB.ExecContext(ctx, `delete from sessions where expiry < $1`, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// StopCleanup stops deleting expired sessions and waits for a running
+// cleanup to finish
+func (p *PostgresStore) StopCleanup() {
+	if p.stop == nil {
+		return
+	}
+
+	close(p.stop)
+	<-p.done
+}
+
+func (p *PostgresStore) startCleanup(interval time.Duration) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			n, err := p.DeleteExpired()
+			if err != nil {
+				p.Logger.Error("can't delete expired sessions", "error", err)
+				continue
+			}
+			if n > 0 {
+				p.Logger.Debug("deleted expired sessions", "count", n)
+			}
+		case <-p.stop:
+			return
+		}
+	}
+}
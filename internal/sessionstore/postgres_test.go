@@ -0,0 +1,124 @@
+package sessionstore
+
+import (
+	"bytes"
+	"database/sql"
+	"github.com/psanodiya94/gobooking.com/internal/driver"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+)
+
+var logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// testDB connects to the migrated database in GOBOOKING_TEST_DSN, skipping
+// the test when it is not set
+func testDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("GOBOOKING_TEST_DSN")
+	if dsn == "" {
+		t.Skip("GOBOOKING_TEST_DSN is not set")
+	}
+
+	db, err := driver.NewDatabase(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	return db
+}
+
+func TestPostgresStore(t *testing.T) {
+	p := NewPostgres(testDB(t), logger, 0)
+
+	token := "test-" + time.Now().Format("150405.000000000")
+	t.Cleanup(func() { _ = p.Delete(token) })
+
+	_, found, err := p.Find(token)
+	if err != nil || found {
+		t.Fatalf("expected no session before commit, got found %v, %v", found, err)
+	}
+
+	for _, data := range [][]byte{[]byte("first"), []byte("second")} {
+		err = p.Commit(token, data, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, found, err := p.Find(token)
+		if err != nil || !found || !bytes.Equal(b, data) {
+			t.Errorf("expected %q, got %q, found %v, %v", data, b, found, err)
+		}
+	}
+
+	all, err := p.All()
+	if err != nil || !bytes.Equal(all[token], []byte("second")) {
+		t.Errorf("expected the session in all sessions, got %q, %v", all[token], err)
+	}
+
+	err = p.Delete(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, found, _ := p.Find(token); found {
+		t.Error("found a deleted session")
+	}
+}
+
+func TestPostgresStore_Expired(t *testing.T) {
+	p := NewPostgres(testDB(t), logger, 0)
+
+	token := "expired-" + time.Now().Format("150405.000000000")
+	t.Cleanup(func() { _ = p.Delete(token) })
+
+	err := p.Commit(token, []byte("old"), time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, found, _ := p.Find(token); found {
+		t.Error("found an expired session")
+	}
+
+	all, err := p.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := all[token]; ok {
+		t.Error("expired session in all sessions")
+	}
+
+	n, err := p.DeleteExpired()
+	if err != nil || n < 1 {
+		t.Errorf("expected the expired session to be deleted, got %d, %v", n, err)
+	}
+}
+
+func TestPostgresStore_StopCleanup(t *testing.T) {
+	// nothing listens here, so each cleanup fails and is logged
+	db, err := sql.Open("pgx", "postgres://localhost:1/gobookings?connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, interval := range []time.Duration{0, 10 * time.Millisecond} {
+		p := NewPostgres(db, logger, interval)
+		time.Sleep(30 * time.Millisecond)
+
+		stopped := make(chan struct{})
+		go func() {
+			p.StopCleanup()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("StopCleanup with interval %s didn't return", interval)
+		}
+	}
+}
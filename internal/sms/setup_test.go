@@ -0,0 +1,19 @@
+package sms
+
+import (
+	"github.com/psanodiya94/gobooking.com/internal/config"
+	"github.com/psanodiya94/gobooking.com/templates"
+	"os"
+	"testing"
+)
+
+var testApp config.AppConfig
+
+func TestMain(m *testing.M) {
+	testApp.Templates = templates.FS
+	testApp.UseCache = false
+
+	app = &testApp
+
+	os.Exit(m.Run())
+}
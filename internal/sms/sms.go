@@ -0,0 +1,213 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/psanodiya94/gobooking.com/internal/assets"
+	"github.com/psanodiya94/gobooking.com/internal/config"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Names of the sms templates in the templates/sms folder
+const (
+	ReservationConfirmation = "reservation-confirmation.sms.tmpl"
+	ReservationReminder     = "reservation-reminder.sms.tmpl"
+)
+
+var functions = template.FuncMap{
+	"readableDate": ReadableDate,
+}
+
+var app *config.AppConfig
+
+// the text messages read from disk when app.UseCache is false
+var devCache = assets.NewCache(CreateTemplateCache)
+
+// Message is a text message ready to be sent
+type Message struct {
+	To   string `json:"to"`
+	From string `json:"from,omitempty"`
+	Body string `json:"body"`
+}
+
+// Sender sends text messages through a provider
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// HTTPSender sends text messages by posting them as json to a provider's api
+type HTTPSender struct {
+	URL    string
+	Token  string
+	From   string
+	Client *http.Client
+}
+
+// NewHTTPSender creates a sender for the provider api at url
+func NewHTTPSender(url, token, from string) *HTTPSender {
+	return &HTTPSender{
+		URL:    url,
+		Token:  token,
+		From:   from,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Send posts the message to the provider
+func (s *HTTPSender) Send(ctx context.Context, msg Message) error {
+	if msg.From == "" {
+		msg.From = s.From
+	}
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("sms provider returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// LogSender writes text messages to a log instead of sending them, for development
+type LogSender struct {
+	Log *slog.Logger
+}
+
+// Send logs the message
+func (s *LogSender) Send(ctx context.Context, msg Message) error {
+	s.Log.InfoContext(ctx, "sms not sent, logged instead", "to", msg.To, "body", msg.Body)
+	return nil
+}
+
+// NormalizePhone converts a phone number to E.164 format, using countryCode
+// for numbers written without an international prefix
+func NormalizePhone(phone, countryCode string) (string, error) {
+	phone = strings.TrimSpace(phone)
+
+	international := false
+	switch {
+	case strings.HasPrefix(phone, "+"):
+		international = true
+	case strings.HasPrefix(phone, "00"):
+		international = true
+		phone = phone[2:]
+	}
+
+	var digits strings.Builder
+	for _, c := range phone {
+		switch {
+		case c >= '0' && c <= '9':
+			digits.WriteRune(c)
+		case strings.ContainsRune("+ -.()/", c):
+			// formatting characters
+		default:
+			return "", fmt.Errorf("invalid character %q in phone number", c)
+		}
+	}
+
+	number := digits.String()
+	if !international {
+		// national numbers drop their trunk prefix and take the country code
+		number = countryCode + strings.TrimPrefix(number, "0")
+	}
+
+	// E.164 allows up to 15 digits including the country code
+	if len(number) < 8 || len(number) > 15 {
+		return "", errors.New("phone number has the wrong number of digits")
+	}
+
+	return "+" + number, nil
+}
+
+// ReadableDate returns time in YYYY-MM-DD format
+func ReadableDate(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// NewSMS sets the config for the sms package
+func NewSMS(a *config.AppConfig) {
+	app = a
+}
+
+// Render executes the named sms template with data
+func Render(name string, data interface{}) (string, error) {
+	tmplCache, err := templateCache()
+	if err != nil {
+		return "", err
+	}
+
+	t, ok := tmplCache[name]
+	if !ok {
+		return "", fmt.Errorf("could not get sms template %s from cache", name)
+	}
+
+	buf := new(bytes.Buffer)
+	err = t.Execute(buf, data)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// templateCache returns the sms template cache from the app config, or
+// when it is not in use, the templates read from disk, parsed again only
+// after a file has changed
+func templateCache() (map[string]*template.Template, error) {
+	if app.UseCache {
+		return app.SMSTemplateCache, nil
+	}
+
+	return devCache.Get(app.Templates)
+}
+
+// CreateTemplateCache creates the sms template cache from the sms folder of fsys
+func CreateTemplateCache(fsys fs.FS) (map[string]*template.Template, error) {
+	cache := map[string]*template.Template{}
+
+	// get all the files name in the sms folder
+	messages, err := fs.Glob(fsys, "sms/*.sms.tmpl")
+	if err != nil {
+		return cache, err
+	}
+
+	// range through all files ending with *.sms.tmpl
+	for _, message := range messages {
+		name := path.Base(message)
+		ts, err := template.New(name).Funcs(functions).ParseFS(fsys, message)
+		if err != nil {
+			return cache, err
+		}
+
+		cache[name] = ts
+	}
+
+	return cache, nil
+}
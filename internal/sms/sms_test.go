@@ -0,0 +1,120 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/psanodiya94/gobooking.com/internal/mailer"
+	"github.com/psanodiya94/gobooking.com/internal/models"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var normalizePhoneTests = []struct {
+	name     string
+	phone    string
+	expected string
+	valid    bool
+}{
+	{"national", "555-555-5555", "+15555555555", true},
+	{"national-with-trunk-prefix", "(0)20 7946 0958", "+12079460958", true},
+	{"international-plus", "+44 20 7946 0958", "+442079460958", true},
+	{"international-00", "0044 20 7946 0958", "+442079460958", true},
+	{"letters", "555-CALL-NOW", "", false},
+	{"too-short", "12345", "", false},
+	{"too-long", "+1234567890123456", "", false},
+}
+
+func TestNormalizePhone(t *testing.T) {
+	for _, e := range normalizePhoneTests {
+		got, err := NormalizePhone(e.phone, "1")
+		if e.valid && err != nil {
+			t.Errorf("%s: unexpected error %v", e.name, err)
+		}
+		if !e.valid && err == nil {
+			t.Errorf("%s: expected an error but got %s", e.name, got)
+		}
+		if e.valid && got != e.expected {
+			t.Errorf("%s: expected %s but got %s", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestHTTPSender(t *testing.T) {
+	var received Message
+	var auth string
+
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		if received.To == "+15550000000" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer stub.Close()
+
+	sender := NewHTTPSender(stub.URL, "secret", "GoBooking")
+
+	err := sender.Send(context.Background(), Message{To: "+15555555555", Body: "hello"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if received.To != "+15555555555" || received.Body != "hello" || received.From != "GoBooking" {
+		t.Errorf("provider received the wrong message: %+v", received)
+	}
+
+	if auth != "Bearer secret" {
+		t.Errorf("expected bearer token but got %q", auth)
+	}
+
+	err = sender.Send(context.Background(), Message{To: "+15550000000", Body: "hello"})
+	if err == nil {
+		t.Error("expected an error when the provider rejects the message")
+	}
+}
+
+func TestLogSender(t *testing.T) {
+	buf := new(bytes.Buffer)
+	sender := &LogSender{Log: slog.New(slog.NewTextHandler(buf, nil))}
+
+	err := sender.Send(context.Background(), Message{To: "+15555555555", Body: "hello"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !strings.Contains(buf.String(), "to=+15555555555 body=hello") {
+		t.Errorf("message not logged: %s", buf.String())
+	}
+}
+
+func TestRender(t *testing.T) {
+	data := mailer.ReminderData{
+		Reservation: models.Reservation{
+			FirstName: "John",
+			CheckIn:   time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+			Room:      models.Room{RoomName: "General's Quarters"},
+		},
+		Days: 1,
+	}
+
+	body, err := Render(ReservationReminder, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(body, "General's Quarters starts tomorrow, on 2050-01-01") {
+		t.Errorf("unexpected reminder text: %s", body)
+	}
+
+	_, err = Render("non.sms.tmpl", data)
+	if err == nil {
+		t.Error("rendered an sms template that does not exist")
+	}
+}
@@ -0,0 +1,10 @@
+// Package migrations embeds the database migrations in the binary
+package migrations
+
+import "embed"
+
+// FS holds the fizz migrations, so the readiness probe knows the schema
+// version the binary expects
+//
+//go:embed *.fizz
+var FS embed.FS
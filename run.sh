@@ -11,7 +11,8 @@ function build() {
 }
 
 function run() {
-    ./bookings -dbname=gobookings -dbuser=postgres -dbpass=Rishirich11! -cache=false -production=false
+    # settings come from config.yml, with secrets such as GOBOOKING_DB_PASSWORD from the environment
+    ./bookings -config=config.yml
 }
 
 function test() {
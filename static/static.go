@@ -0,0 +1,9 @@
+// Package static embeds the static assets in the binary
+package static
+
+import "embed"
+
+// FS holds the files served under /static
+//
+//go:embed admin css images js
+var FS embed.FS
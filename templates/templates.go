@@ -0,0 +1,10 @@
+// Package templates embeds the page, email and sms templates in the binary
+package templates
+
+import "embed"
+
+// FS holds the page and layout templates, with the email and sms templates
+// in the emails and sms folders
+//
+//go:embed *.tmpl emails/*.tmpl sms/*.tmpl
+var FS embed.FS